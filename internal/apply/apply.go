@@ -0,0 +1,589 @@
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/hooks"
+)
+
+// Action describes what happened to a single entry.
+type Action string
+
+const (
+	ActionUnchanged Action = "unchanged"
+	ActionLinked    Action = "linked"
+	ActionCopied    Action = "copied"
+	ActionWritten   Action = "written"
+	ActionCaptured  Action = "captured"
+	ActionKept      Action = "kept"
+	ActionNoTarget  Action = "no target"
+	ActionFailed    Action = "failed"
+)
+
+// Result is the outcome of applying one entry.
+type Result struct {
+	Name   string
+	Target string
+	Action Action
+	Backup string
+	// Drifted is set when the permissions enforced by the entry's mode had
+	// drifted to PrevMode and were restored.
+	Drifted  bool
+	PrevMode os.FileMode
+	// Hooks holds the hooks that ran or were skipped for this entry.
+	Hooks []hooks.Result
+	Err   error
+}
+
+// Options controls the optional parts of applying entries.
+type Options struct {
+	// Changed reports whether the last pull changed the given source.
+	Changed func(source string) bool
+	// Hooks runs entry hooks. A nil runner runs none.
+	Hooks *hooks.Runner
+	// State records what is applied to copied targets and blocks, so that
+	// targets edited since are kept rather than overwritten. A nil State
+	// keeps only targets newer than their source, as a backup.
+	State *State
+	// Force overwrites targets with local edits, keeping a backup.
+	Force bool
+}
+
+// ChangedFunc returns a Changed function for the repo-relative paths
+// touched by a pull. A source matches a changed path equal to or below it.
+func ChangedFunc(paths []string) func(source string) bool {
+	return func(source string) bool {
+		for _, p := range paths {
+			if p == source || strings.HasPrefix(p, source+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Entries applies every entry, linking, copying or writing blocks into
+// targets from repoDir.
+func Entries(repoDir string, files []config.FileEntry, opts Options) []Result {
+	results := make([]Result, 0, len(files))
+	for _, f := range files {
+		results = append(results, Entry(repoDir, f, opts))
+	}
+	return results
+}
+
+// Entry applies f to its target for the current OS.
+// A regular file in the way of a symlink is renamed to a
+// .conflict-<timestamp> backup; existing symlinks (including dangling ones
+// left by a moved source) are replaced. Block entries only rewrite their
+// block in the target. The entry's mode is enforced on the repo file for
+// symlinks and on the target for copies; blocks leave the target's mode
+// alone. pre_apply hooks run only when the target needs updating, and a
+// failing pre_apply hook leaves the target untouched. With a State, a
+// copied target or block edited since it was last applied is kept, unless
+// opts.Force is set.
+func Entry(repoDir string, f config.FileEntry, opts Options) Result {
+	res := Result{Name: f.Name}
+	target, ok := fileops.ResolveTarget(f.Targets)
+	if !ok {
+		res.Action = ActionNoTarget
+		return res
+	}
+	res.Target = target
+
+	repoFile := f.SourcePath(repoDir)
+	if _, err := os.Stat(repoFile); err != nil {
+		return res.fail(fmt.Errorf("source %s: %w", f.Source, err))
+	}
+	mode, hasMode, err := f.FileMode()
+	if err != nil {
+		return res.fail(err)
+	}
+	if err := f.ValidateOverlays(); err != nil {
+		return res.fail(err)
+	}
+	edits, err := opts.State.Edits(repoDir, f)
+	if err != nil {
+		return res.fail(err)
+	}
+	if edits == config.StatusLocalEdit || edits == config.StatusBothEdited {
+		if !opts.Force {
+			res.Action = ActionKept
+			res.Err = fmt.Errorf("%w since it was last applied", ErrLocalEdits)
+			if edits == config.StatusBothEdited {
+				res.Err = fmt.Errorf("%w, and the repo changed too", res.Err)
+			}
+			return res
+		}
+		if res, err = backupEdits(res, repoFile, target); err != nil {
+			return res.fail(err)
+		}
+	}
+
+	changed := opts.Changed != nil && opts.Changed(f.Source)
+	vars := map[string]string{
+		"SYNQ_TARGET":  target,
+		"SYNQ_METHOD":  f.ApplyMethod(),
+		"SYNQ_CHANGED": strconv.FormatBool(changed),
+	}
+	runHook := func(kind hooks.Kind) error {
+		h := opts.Hooks.Run(f, kind, vars)
+		if h == nil {
+			return nil
+		}
+		res.Hooks = append(res.Hooks, *h)
+		if h.Err != nil {
+			return fmt.Errorf("%s hook: %w", kind, h.Err)
+		}
+		return nil
+	}
+
+	if !upToDate(f, repoFile, target) {
+		if err := runHook(hooks.PreApply); err != nil {
+			return res.fail(err)
+		}
+	}
+
+	switch f.ApplyMethod() {
+	case config.MethodSymlink:
+		res = linkEntry(res, repoFile, target)
+		if hasMode && res.Err == nil {
+			res = res.ensureMode(repoFile, mode)
+		}
+	case config.MethodCopy:
+		if len(f.ActiveOverlays) > 0 {
+			res = overlayEntry(res, f, repoFile, target, mode, hasMode)
+		} else {
+			res = copyEntry(res, repoFile, target, mode, hasMode)
+		}
+		if hasMode && res.Err == nil && res.Action == ActionUnchanged {
+			res = res.ensureMode(target, mode)
+		}
+	case config.MethodBlock:
+		res = blockEntry(res, f.Block(), repoFile, target)
+	default:
+		return res.fail(fmt.Errorf("unknown method %q", f.Method))
+	}
+	if res.Err != nil {
+		return res
+	}
+	if err := recordApplied(repoDir, f, opts.State); err != nil {
+		return res.fail(fmt.Errorf("record applied content: %w", err))
+	}
+
+	applied := res.Action == ActionLinked || res.Action == ActionCopied || res.Action == ActionWritten
+	vars["SYNQ_ACTION"] = string(res.Action)
+	if applied {
+		if err := runHook(hooks.PostApply); err != nil {
+			return res.fail(err)
+		}
+	}
+	if applied || changed {
+		if err := runHook(hooks.PostChange); err != nil {
+			return res.fail(err)
+		}
+	}
+	return res
+}
+
+// upToDate reports whether target already reflects the source.
+func upToDate(f config.FileEntry, repoFile, target string) bool {
+	switch f.ApplyMethod() {
+	case config.MethodBlock:
+		same, err := sameBlock(f.Block(), repoFile, target)
+		return err == nil && same
+	case config.MethodCopy:
+		info, err := os.Lstat(target)
+		if err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+		if len(f.ActiveOverlays) > 0 {
+			same, err := sameRendered(f, repoFile, target)
+			return err == nil && same
+		}
+		same, err := fileops.SameContent(repoFile, target)
+		return err == nil && same
+	}
+	return fileops.IsSymlinkTo(target, repoFile)
+}
+
+// sameBlock reports whether target holds the block with the content of
+// repoFile.
+func sameBlock(b fileops.Block, repoFile, target string) (bool, error) {
+	current, found, err := b.Read(target)
+	if err != nil || !found {
+		return false, err
+	}
+	content, err := os.ReadFile(repoFile)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, fileops.NormalizeBlock(content)), nil
+}
+
+func linkEntry(res Result, repoFile, target string) Result {
+	if fileops.IsSymlinkTo(target, repoFile) {
+		res.Action = ActionUnchanged
+		return res
+	}
+
+	// Handle conflict: backup local file.
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		backup, err := backupFile(target)
+		if err != nil {
+			return res.fail(err)
+		}
+		res.Backup = backup
+	}
+
+	if err := fileops.CreateSymlink(repoFile, target); err != nil {
+		return res.fail(err)
+	}
+	res.Action = ActionLinked
+	return res
+}
+
+func copyEntry(res Result, repoFile, target string, mode os.FileMode, hasMode bool) Result {
+	if info, err := os.Stat(repoFile); err == nil && info.IsDir() {
+		return res.fail(fmt.Errorf("copy method supports files only"))
+	}
+	same, err := fileops.SameContent(repoFile, target)
+	if err != nil {
+		return res.fail(err)
+	}
+	if same {
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink == 0 {
+			res.Action = ActionUnchanged
+			return res
+		}
+	}
+
+	if info, err := os.Lstat(target); err == nil {
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			// Replace a symlink (e.g. from switching methods) with a real file.
+			if err := os.Remove(target); err != nil {
+				return res.fail(fmt.Errorf("remove symlink: %w", err))
+			}
+		case newerThan(info, repoFile):
+			// The target was edited after the source changed; keep a copy.
+			backup, err := backupFile(target)
+			if err != nil {
+				return res.fail(err)
+			}
+			res.Backup = backup
+		}
+	}
+	if hasMode {
+		err = fileops.CopyFileMode(repoFile, target, mode)
+	} else {
+		err = fileops.CopyFile(repoFile, target)
+	}
+	if err != nil {
+		return res.fail(err)
+	}
+	res.Action = ActionCopied
+	return res
+}
+
+func blockEntry(res Result, b fileops.Block, repoFile, target string) Result {
+	content, err := os.ReadFile(repoFile)
+	if err != nil {
+		return res.fail(fmt.Errorf("block method supports files only: %w", err))
+	}
+	same, err := sameBlock(b, repoFile, target)
+	if err != nil {
+		return res.fail(err)
+	}
+	if same {
+		res.Action = ActionUnchanged
+		return res
+	}
+
+	// The block was edited after the source changed; keep a copy of the
+	// whole file, since the rest of it is not ours to move.
+	if _, found, _ := b.Read(target); found {
+		if info, err := os.Stat(target); err == nil && newerThan(info, repoFile) {
+			backup := target + fmt.Sprintf(".conflict-%s", time.Now().Format("20060102-150405"))
+			if err := fileops.CopyFile(target, backup); err != nil {
+				return res.fail(fmt.Errorf("backup %s: %w", target, err))
+			}
+			res.Backup = backup
+		}
+	}
+	if _, err := b.Write(target, content); err != nil {
+		return res.fail(err)
+	}
+	res.Action = ActionWritten
+	return res
+}
+
+// Capture copies edits made to copy-method targets, and to the blocks of
+// block entries, back into repoDir. Edits to targets with overlays are
+// split between the source and the overlays in synq.yaml. With a State,
+// only targets edited since they were last applied are captured, and not
+// when the source changed too; without one, only targets modified more
+// recently than their source are. Either way a freshly pulled source is
+// never overwritten by a stale target.
+func Capture(repoDir string, files []config.FileEntry, st *State) []Result {
+	var results []Result
+	for _, f := range files {
+		edits, err := st.Edits(repoDir, f)
+		if err != nil {
+			results = append(results, Result{Name: f.Name}.fail(err))
+			continue
+		}
+		if edits != "" && edits != config.StatusLocalEdit {
+			continue
+		}
+		edited := edits == config.StatusLocalEdit
+		if res, ok := captureEntry(repoDir, f, edited); ok {
+			if res.Action == ActionCaptured {
+				if err := recordApplied(repoDir, f, st); err != nil {
+					res = res.fail(fmt.Errorf("record applied content: %w", err))
+				}
+			}
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// captureEntry captures the target of f. edited skips checking that the
+// target is newer than its source. ok is false when there was nothing to
+// capture.
+func captureEntry(repoDir string, f config.FileEntry, edited bool) (res Result, ok bool) {
+	switch {
+	case f.ApplyMethod() == config.MethodBlock:
+		return captureBlock(repoDir, f, edited)
+	case f.ApplyMethod() != config.MethodCopy:
+		return res, false
+	case len(f.ActiveOverlays) > 0:
+		return captureOverlays(repoDir, f, edited)
+	}
+	return captureCopy(repoDir, f, edited)
+}
+
+// captureCopy copies the target of f into repoDir.
+func captureCopy(repoDir string, f config.FileEntry, edited bool) (res Result, ok bool) {
+	res = Result{Name: f.Name}
+	target, hasTarget := fileops.ResolveTarget(f.Targets)
+	if !hasTarget {
+		return res, false
+	}
+	res.Target = target
+
+	repoFile := f.SourcePath(repoDir)
+	targetInfo, err := os.Lstat(target)
+	if err != nil || !targetInfo.Mode().IsRegular() {
+		return res, false
+	}
+	if !edited && !newerThan(targetInfo, repoFile) {
+		return res, false
+	}
+	same, err := fileops.SameContent(target, repoFile)
+	if err != nil {
+		return res.fail(err), true
+	}
+	if same {
+		return res, false
+	}
+	if err := fileops.CopyFile(target, repoFile); err != nil {
+		return res.fail(err), true
+	}
+	res.Action = ActionCaptured
+	return res, true
+}
+
+// captureBlock copies the block of f from its target into repoDir. ok is
+// false when there was nothing to capture.
+func captureBlock(repoDir string, f config.FileEntry, edited bool) (res Result, ok bool) {
+	res = Result{Name: f.Name}
+	target, hasTarget := fileops.ResolveTarget(f.Targets)
+	if !hasTarget {
+		return res, false
+	}
+	res.Target = target
+
+	repoFile := f.SourcePath(repoDir)
+	targetInfo, err := os.Stat(target)
+	if err != nil || !targetInfo.Mode().IsRegular() || (!edited && !newerThan(targetInfo, repoFile)) {
+		return res, false
+	}
+	same, err := sameBlock(f.Block(), repoFile, target)
+	if err != nil {
+		return res.fail(err), true
+	}
+	if same {
+		return res, false
+	}
+	// A removed block is restored by the next apply rather than captured.
+	content, found, err := f.Block().Read(target)
+	if err != nil {
+		return res.fail(err), true
+	}
+	if !found {
+		return res, false
+	}
+	if err := os.MkdirAll(filepath.Dir(repoFile), 0o755); err != nil {
+		return res.fail(err), true
+	}
+	if err := os.WriteFile(repoFile, content, 0o644); err != nil {
+		return res.fail(err), true
+	}
+	res.Action = ActionCaptured
+	return res, true
+}
+
+// Pending reports whether applying f would change its target.
+func Pending(repoDir string, f config.FileEntry) bool {
+	target, ok := fileops.ResolveTarget(f.Targets)
+	return ok && !upToDate(f, f.SourcePath(repoDir), target)
+}
+
+// Keep makes the repo take the version of f in its target: the file or
+// block is captured into repoDir whether or not it is newer, and a file in
+// the way of a symlink is moved into the repo and linked.
+func Keep(repoDir string, f config.FileEntry, st *State) Result {
+	res := Result{Name: f.Name}
+	target, ok := fileops.ResolveTarget(f.Targets)
+	if !ok {
+		res.Action = ActionNoTarget
+		return res
+	}
+	res.Target = target
+
+	if f.ApplyMethod() == config.MethodSymlink {
+		repoFile := f.SourcePath(repoDir)
+		info, err := os.Lstat(target)
+		if err != nil || !info.Mode().IsRegular() {
+			res.Action = ActionUnchanged
+			return res
+		}
+		if err := fileops.CopyFile(target, repoFile); err != nil {
+			return res.fail(err)
+		}
+		if err := os.Remove(target); err != nil {
+			return res.fail(err)
+		}
+		if err := fileops.CreateSymlink(repoFile, target); err != nil {
+			return res.fail(err)
+		}
+		res.Action = ActionCaptured
+		return res
+	}
+
+	res, ok = captureEntry(repoDir, f, true)
+	if !ok {
+		res.Name, res.Target, res.Action = f.Name, target, ActionUnchanged
+		return res
+	}
+	if res.Action == ActionCaptured {
+		if err := recordApplied(repoDir, f, st); err != nil {
+			return res.fail(fmt.Errorf("record applied content: %w", err))
+		}
+	}
+	return res
+}
+
+// Status reports the sync status of f on this machine. With a State, copied
+// targets and blocks that changed since they were last applied report
+// which side changed.
+func Status(repoDir string, f config.FileEntry, st *State) config.SyncStatus {
+	target, ok := fileops.ResolveTarget(f.Targets)
+	if !ok {
+		return config.StatusNoTarget
+	}
+
+	repoFile := f.SourcePath(repoDir)
+
+	// Check if repo file exists.
+	if _, err := os.Stat(repoFile); err != nil {
+		return config.StatusMissing
+	}
+
+	// Check if target exists.
+	info, err := os.Lstat(target)
+	if err != nil {
+		return config.StatusMissing
+	}
+
+	if edits, err := st.Edits(repoDir, f); err == nil && edits != "" && edits != config.StatusSynced {
+		return edits
+	}
+
+	modeFile := repoFile
+	switch f.ApplyMethod() {
+	case config.MethodBlock:
+		if same, err := sameBlock(f.Block(), repoFile, target); err != nil || !same {
+			if _, found, _ := f.Block().Read(target); !found {
+				return config.StatusUnlinked
+			}
+			return config.StatusModified
+		}
+		return config.StatusSynced
+	case config.MethodCopy:
+		if info.Mode()&os.ModeSymlink != 0 {
+			return config.StatusUnlinked
+		}
+		same, err := fileops.SameContent(repoFile, target)
+		if len(f.ActiveOverlays) > 0 {
+			same, err = sameRendered(f, repoFile, target)
+		}
+		if err != nil || !same {
+			return config.StatusModified
+		}
+		modeFile = target
+	default:
+		// Check if it's a symlink pointing to the repo file.
+		if info.Mode()&os.ModeSymlink == 0 || !fileops.IsSymlinkTo(target, repoFile) {
+			return config.StatusUnlinked
+		}
+	}
+
+	if mode, ok, _ := f.FileMode(); ok {
+		if info, err := os.Stat(modeFile); err == nil && info.Mode().Perm() != mode {
+			return config.StatusModeDrift
+		}
+	}
+	return config.StatusSynced
+}
+
+// newerThan reports whether info was modified after path. A missing path
+// counts as older.
+func newerThan(info os.FileInfo, path string) bool {
+	other, err := os.Stat(path)
+	return err != nil || info.ModTime().After(other.ModTime())
+}
+
+func backupFile(path string) (string, error) {
+	backup := path + fmt.Sprintf(".conflict-%s", time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, backup); err != nil {
+		return "", fmt.Errorf("backup %s: %w", path, err)
+	}
+	return backup, nil
+}
+
+func (r Result) ensureMode(path string, mode os.FileMode) Result {
+	prev, drifted, err := fileops.EnsureMode(path, mode)
+	if err != nil {
+		return r.fail(fmt.Errorf("set mode: %w", err))
+	}
+	r.Drifted = drifted
+	r.PrevMode = prev
+	return r
+}
+
+func (r Result) fail(err error) Result {
+	r.Action = ActionFailed
+	r.Err = err
+	return r
+}
@@ -0,0 +1,456 @@
+package apply
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/hooks"
+)
+
+func setup(t *testing.T, source string) (string, string, config.FileEntry) {
+	t.Helper()
+	tmp := t.TempDir()
+	repoDir := filepath.Join(tmp, "repo")
+	target := filepath.Join(tmp, "home", ".config", "git", "config")
+
+	entry := config.FileEntry{
+		Name:    "config",
+		Source:  source,
+		Targets: map[string]string{runtime.GOOS: target},
+	}
+	repoFile := entry.SourcePath(repoDir)
+	if err := os.MkdirAll(filepath.Dir(repoFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(repoFile, []byte("repo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return repoDir, target, entry
+}
+
+func TestEntry_LinksNestedSource(t *testing.T) {
+	repoDir, target, entry := setup(t, "home/.config/git/config")
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.Action != ActionLinked {
+		t.Errorf("Action = %q, want %q", res.Action, ActionLinked)
+	}
+	if !fileops.IsSymlinkTo(target, entry.SourcePath(repoDir)) {
+		t.Error("expected target to link to nested source")
+	}
+
+	res = Entry(repoDir, entry, Options{})
+	if res.Action != ActionUnchanged {
+		t.Errorf("second Action = %q, want %q", res.Action, ActionUnchanged)
+	}
+}
+
+func TestEntry_BacksUpRegularFile(t *testing.T) {
+	repoDir, target, entry := setup(t, "config")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.Backup == "" {
+		t.Fatal("expected a backup")
+	}
+	data, err := os.ReadFile(res.Backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "local" {
+		t.Errorf("backup content = %q, want %q", string(data), "local")
+	}
+}
+
+func TestEntry_ReplacesDanglingLink(t *testing.T) {
+	repoDir, target, entry := setup(t, "home/new/config")
+	if err := fileops.CreateSymlink(filepath.Join(repoDir, "old", "config"), target); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.Backup != "" {
+		t.Errorf("unexpected backup %q", res.Backup)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "repo" {
+		t.Errorf("content = %q, want %q", string(data), "repo")
+	}
+}
+
+func TestEntry_NoTarget(t *testing.T) {
+	repoDir, _, entry := setup(t, "config")
+	entry.Targets = map[string]string{"nonexistent_os": "/x"}
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Action != ActionNoTarget {
+		t.Errorf("Action = %q, want %q", res.Action, ActionNoTarget)
+	}
+}
+
+func TestEntry_EnforcesModeOnRepoFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not enforced on Windows")
+	}
+	repoDir, _, entry := setup(t, "home/.ssh/config")
+	entry.Mode = "0600"
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if !res.Drifted || res.PrevMode != 0o644 {
+		t.Errorf("Drifted = %v, PrevMode = %o; want true, 644", res.Drifted, res.PrevMode)
+	}
+	info, err := os.Stat(entry.SourcePath(repoDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("repo file mode = %o, want 600", info.Mode().Perm())
+	}
+	if got := Status(repoDir, entry, nil); got != config.StatusSynced {
+		t.Errorf("Status = %q, want %q", got, config.StatusSynced)
+	}
+}
+
+func TestEntry_CopyMethod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not enforced on Windows")
+	}
+	repoDir, target, entry := setup(t, "home/.pgpass")
+	entry.Method = config.MethodCopy
+	entry.Mode = "0600"
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.Action != ActionCopied {
+		t.Errorf("Action = %q, want %q", res.Action, ActionCopied)
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Fatal("expected a regular file, got symlink")
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("target mode = %o, want 600", info.Mode().Perm())
+	}
+
+	if err := os.Chmod(target, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(repoDir, entry, nil); got != config.StatusModeDrift {
+		t.Errorf("Status = %q, want %q", got, config.StatusModeDrift)
+	}
+	res = Entry(repoDir, entry, Options{})
+	if res.Action != ActionUnchanged || !res.Drifted {
+		t.Errorf("Action = %q, Drifted = %v; want unchanged, true", res.Action, res.Drifted)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	repoDir, target, entry := setup(t, "home/.pgpass")
+	entry.Method = config.MethodCopy
+	if res := Entry(repoDir, entry, Options{}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	// Untouched targets are not captured.
+	if results := Capture(repoDir, []config.FileEntry{entry}, nil); len(results) != 0 {
+		t.Fatalf("expected no captures, got %d", len(results))
+	}
+
+	if err := os.WriteFile(target, []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(target, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	results := Capture(repoDir, []config.FileEntry{entry}, nil)
+	if len(results) != 1 || results[0].Action != ActionCaptured {
+		t.Fatalf("Capture() = %+v, want one captured result", results)
+	}
+	data, err := os.ReadFile(entry.SourcePath(repoDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "edited" {
+		t.Errorf("repo content = %q, want %q", string(data), "edited")
+	}
+}
+
+func TestEntry_RunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	repoDir, _, entry := setup(t, "home/.tmux.conf")
+	entry.Hooks = &config.Hooks{PostApply: "echo applied", PostChange: "echo $SYNQ_CHANGED"}
+	runner := &hooks.Runner{
+		RepoDir: repoDir,
+		Enabled: true,
+		Timeout: 5 * time.Second,
+		Trusted: map[string]string{entry.Name: hooks.Fingerprint(entry)},
+	}
+
+	res := Entry(repoDir, entry, Options{Hooks: runner})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(res.Hooks) != 2 || res.Hooks[0].Kind != hooks.PostApply || res.Hooks[1].Output != "false" {
+		t.Errorf("Hooks = %+v, want post_apply then post_change with SYNQ_CHANGED=false", res.Hooks)
+	}
+
+	// Already linked: hooks only run when the pull changed the source.
+	res = Entry(repoDir, entry, Options{Hooks: runner})
+	if len(res.Hooks) != 0 {
+		t.Errorf("expected no hooks for unchanged entry, got %+v", res.Hooks)
+	}
+	opts := Options{Hooks: runner, Changed: ChangedFunc([]string{"home/.tmux.conf"})}
+	res = Entry(repoDir, entry, opts)
+	if len(res.Hooks) != 1 || res.Hooks[0].Kind != hooks.PostChange || res.Hooks[0].Output != "true" {
+		t.Errorf("Hooks = %+v, want a single post_change with SYNQ_CHANGED=true", res.Hooks)
+	}
+}
+
+func TestEntry_Block(t *testing.T) {
+	repoDir, target, entry := setup(t, "blocks/config")
+	entry.Method = config.MethodBlock
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("[user]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(target, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil || res.Action != ActionWritten {
+		t.Fatalf("Entry() = %q, %v; want %q", res.Action, res.Err, ActionWritten)
+	}
+	want := "[user]\n# BEGIN synq:config\nrepo\n# END synq:config\n"
+	if data, _ := os.ReadFile(target); string(data) != want {
+		t.Errorf("target = %q, want %q", data, want)
+	}
+	if got := Status(repoDir, entry, nil); got != config.StatusSynced {
+		t.Errorf("Status() = %q, want synced", got)
+	}
+	if res := Entry(repoDir, entry, Options{}); res.Action != ActionUnchanged {
+		t.Errorf("second Action = %q, want unchanged", res.Action)
+	}
+
+	// Edits inside the block are captured; edits outside are not.
+	edited := "[core]\n[user]\n# BEGIN synq:config\nedited\n# END synq:config\n"
+	if err := os.WriteFile(target, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(target, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(repoDir, entry, nil); got != config.StatusModified {
+		t.Errorf("Status() = %q, want modified", got)
+	}
+	results := Capture(repoDir, []config.FileEntry{entry}, nil)
+	if len(results) != 1 || results[0].Action != ActionCaptured {
+		t.Fatalf("Capture() = %+v", results)
+	}
+	if data, _ := os.ReadFile(entry.SourcePath(repoDir)); string(data) != "edited\n" {
+		t.Errorf("source = %q, want the block content", data)
+	}
+	if data, _ := os.ReadFile(target); string(data) != edited {
+		t.Errorf("target changed by capture: %q", data)
+	}
+}
+
+func TestEntry_Overlays(t *testing.T) {
+	repoDir, target, entry := setup(t, "vscode/settings.json")
+	entry.Overlays = map[string]map[string]any{
+		config.OverlayOS + runtime.GOOS: {"editor.fontSize": 16},
+	}
+	entry.ActiveOverlays = entry.OverlayKeys(nil)
+	if err := os.WriteFile(entry.SourcePath(repoDir), []byte("{\n  \"editor.fontSize\": 12\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Files: []config.FileEntry{entry}}
+	if err := config.SaveRepoConfigIn(repoDir, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Entry(repoDir, entry, Options{})
+	if res.Err != nil || res.Action != ActionCopied {
+		t.Fatalf("Entry() = %q, %v; want %q", res.Action, res.Err, ActionCopied)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "{\n  \"editor.fontSize\": 16\n}\n" {
+		t.Errorf("target = %q, want the overlay applied", data)
+	}
+	if got := Status(repoDir, entry, nil); got != config.StatusSynced {
+		t.Errorf("Status() = %q, want synced", got)
+	}
+
+	// An edit to the overlaid key goes to the overlay, others to the source.
+	edited := "{\n  \"editor.fontSize\": 18,\n  \"files.autoSave\": \"off\"\n}\n"
+	if err := os.WriteFile(target, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(target, later, later); err != nil {
+		t.Fatal(err)
+	}
+	results := Capture(repoDir, []config.FileEntry{entry}, nil)
+	if len(results) != 1 || results[0].Action != ActionCaptured {
+		t.Fatalf("Capture() = %+v, want one captured result", results)
+	}
+	want := "{\n  \"editor.fontSize\": 12,\n  \"files.autoSave\": \"off\"\n}\n"
+	if data, _ := os.ReadFile(entry.SourcePath(repoDir)); string(data) != want {
+		t.Errorf("source = %q, want %q", data, want)
+	}
+	saved, err := config.LoadRepoConfigIn(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Files[0].Overlays[config.OverlayOS+runtime.GOOS]["editor.fontSize"]; got != 18 {
+		t.Errorf("overlay fontSize = %v, want 18", got)
+	}
+}
+
+func TestEntry_KeepsLocalEdits(t *testing.T) {
+	repoDir, target, entry := setup(t, "home/.pgpass")
+	entry.Method = config.MethodCopy
+	st, err := LoadState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{State: st}
+	if res := Entry(repoDir, entry, opts); res.Action != ActionCopied {
+		t.Fatalf("Entry() = %q, %v; want copied", res.Action, res.Err)
+	}
+	if got := Status(repoDir, entry, st); got != config.StatusSynced {
+		t.Errorf("Status() = %q, want synced", got)
+	}
+
+	// Only the repo changed: apply it.
+	repoFile := entry.SourcePath(repoDir)
+	if err := os.WriteFile(repoFile, []byte("remote"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(repoDir, entry, st); got != config.StatusRemoteEdit {
+		t.Errorf("Status() = %q, want remote edit", got)
+	}
+	if res := Entry(repoDir, entry, opts); res.Action != ActionCopied {
+		t.Fatalf("Entry() = %q, %v; want copied", res.Action, res.Err)
+	}
+
+	// Only the target changed: capture it, even though it is not newer.
+	if err := os.WriteFile(target, []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(target, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(repoDir, entry, st); got != config.StatusLocalEdit {
+		t.Errorf("Status() = %q, want local edit", got)
+	}
+	if results := Capture(repoDir, []config.FileEntry{entry}, st); len(results) != 1 || results[0].Action != ActionCaptured {
+		t.Fatalf("Capture() = %+v, want one captured result", results)
+	}
+	if got := Status(repoDir, entry, st); got != config.StatusSynced {
+		t.Errorf("Status() after capture = %q, want synced", got)
+	}
+
+	// Both changed: neither side is overwritten without Force.
+	if err := os.WriteFile(target, []byte("local again"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(repoFile, []byte("remote again"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(repoDir, entry, st); got != config.StatusBothEdited {
+		t.Errorf("Status() = %q, want both edited", got)
+	}
+	if results := Capture(repoDir, []config.FileEntry{entry}, st); len(results) != 0 {
+		t.Errorf("Capture() = %+v, want none", results)
+	}
+	res := Entry(repoDir, entry, opts)
+	if res.Action != ActionKept || !errors.Is(res.Err, ErrLocalEdits) {
+		t.Fatalf("Entry() = %q, %v; want kept", res.Action, res.Err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "local again" {
+		t.Errorf("target = %q, want the local edit", data)
+	}
+	base, ok, err := st.Base(target)
+	if err != nil || !ok || string(base) != "local" {
+		t.Errorf("Base() = %q, %v, %v; want the last applied content", base, ok, err)
+	}
+
+	opts.Force = true
+	res = Entry(repoDir, entry, opts)
+	if res.Action != ActionCopied || res.Backup == "" {
+		t.Fatalf("forced Entry() = %+v, want copied with a backup", res)
+	}
+	if data, _ := os.ReadFile(res.Backup); string(data) != "local again" {
+		t.Errorf("backup = %q, want the local edit", data)
+	}
+	if got := Status(repoDir, entry, st); got != config.StatusSynced {
+		t.Errorf("Status() = %q, want synced", got)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	repoDir, target, entry := setup(t, "home/.gitconfig")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !Pending(repoDir, entry) {
+		t.Fatal("Pending() = false for a file in the way of a link")
+	}
+
+	res := Keep(repoDir, entry, nil)
+	if res.Err != nil || res.Action != ActionCaptured {
+		t.Fatalf("Keep() = %q, %v; want captured", res.Action, res.Err)
+	}
+	if data, _ := os.ReadFile(entry.SourcePath(repoDir)); string(data) != "local" {
+		t.Errorf("source = %q, want the local version", data)
+	}
+	if !fileops.IsSymlinkTo(target, entry.SourcePath(repoDir)) {
+		t.Error("target is not linked to the source")
+	}
+	if Pending(repoDir, entry) {
+		t.Error("Pending() = true after Keep()")
+	}
+}
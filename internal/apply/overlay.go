@@ -0,0 +1,189 @@
+package apply
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/merge"
+)
+
+// rendered returns the content of f's target: its source with the active
+// overlays applied.
+func rendered(f config.FileEntry, repoFile string) ([]byte, error) {
+	base, err := os.ReadFile(repoFile)
+	if err != nil {
+		return nil, err
+	}
+	format, err := merge.Format(f)
+	if err != nil {
+		return nil, err
+	}
+	out, err := merge.Render(format, base, activePatches(f))
+	if err != nil {
+		return nil, fmt.Errorf("apply overlays: %w", err)
+	}
+	return out, nil
+}
+
+func activePatches(f config.FileEntry) []map[string]any {
+	patches := make([]map[string]any, len(f.ActiveOverlays))
+	for i, key := range f.ActiveOverlays {
+		patches[i] = f.Overlays[key]
+	}
+	return patches
+}
+
+// sameRendered reports whether target holds the rendered source of f.
+func sameRendered(f config.FileEntry, repoFile, target string) (bool, error) {
+	want, err := rendered(f, repoFile)
+	if err != nil {
+		return false, err
+	}
+	got, err := os.ReadFile(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(got, want), nil
+}
+
+// overlayEntry copies the source of f with its overlays applied to target,
+// the way copyEntry copies a plain source.
+func overlayEntry(res Result, f config.FileEntry, repoFile, target string, mode os.FileMode, hasMode bool) Result {
+	content, err := rendered(f, repoFile)
+	if err != nil {
+		return res.fail(err)
+	}
+	info, statErr := os.Lstat(target)
+	if statErr == nil && info.Mode().IsRegular() {
+		if current, err := os.ReadFile(target); err == nil && bytes.Equal(current, content) {
+			res.Action = ActionUnchanged
+			return res
+		}
+	}
+
+	perm := os.FileMode(0o644)
+	if src, err := os.Stat(repoFile); err == nil {
+		perm = src.Mode().Perm()
+	}
+	if hasMode {
+		perm = mode.Perm()
+	}
+	if statErr == nil {
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if err := os.Remove(target); err != nil {
+				return res.fail(fmt.Errorf("remove symlink: %w", err))
+			}
+		case newerThan(info, repoFile):
+			backup, err := backupFile(target)
+			if err != nil {
+				return res.fail(err)
+			}
+			res.Backup = backup
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return res.fail(fmt.Errorf("create parent dir: %w", err))
+	}
+	if err := os.WriteFile(target, content, perm); err != nil {
+		return res.fail(err)
+	}
+	if hasMode {
+		if err := os.Chmod(target, perm); err != nil {
+			return res.fail(err)
+		}
+	}
+	res.Action = ActionCopied
+	return res
+}
+
+// captureOverlays splits edits to the target of f between its source and
+// the active overlays in synq.yaml. ok is false when there was nothing to
+// capture.
+func captureOverlays(repoDir string, f config.FileEntry, edited bool) (res Result, ok bool) {
+	res = Result{Name: f.Name}
+	target, hasTarget := fileops.ResolveTarget(f.Targets)
+	if !hasTarget {
+		return res, false
+	}
+	res.Target = target
+
+	repoFile := f.SourcePath(repoDir)
+	targetInfo, err := os.Lstat(target)
+	if err != nil || !targetInfo.Mode().IsRegular() || (!edited && !newerThan(targetInfo, repoFile)) {
+		return res, false
+	}
+	same, err := sameRendered(f, repoFile, target)
+	if err != nil {
+		return res.fail(err), true
+	}
+	if same {
+		return res, false
+	}
+
+	format, err := merge.Format(f)
+	if err != nil {
+		return res.fail(err), true
+	}
+	base, err := os.ReadFile(repoFile)
+	if err != nil {
+		return res.fail(err), true
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return res.fail(err), true
+	}
+	newBase, patches, err := merge.Split(format, base, activePatches(f), content)
+	if err != nil {
+		return res.fail(fmt.Errorf("split edits: %w", err)), true
+	}
+
+	if !bytes.Equal(newBase, base) {
+		if err := os.WriteFile(repoFile, newBase, 0o644); err != nil {
+			return res.fail(err), true
+		}
+	}
+	if err := saveOverlays(repoDir, f, patches); err != nil {
+		return res.fail(err), true
+	}
+	res.Action = ActionCaptured
+	return res, true
+}
+
+// saveOverlays writes the active overlays of f back to synq.yaml when
+// they changed.
+func saveOverlays(repoDir string, f config.FileEntry, patches []map[string]any) error {
+	changed := false
+	for i, key := range f.ActiveOverlays {
+		if !reflect.DeepEqual(patches[i], f.Overlays[key]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if f.Include != "" {
+		return fmt.Errorf("overlays of %s are defined in %s; edit them there", f.Name, f.Include)
+	}
+	cfg, err := config.LoadRepoConfigIn(repoDir)
+	if err != nil {
+		return err
+	}
+	idx := cfg.FindFile(f.Name)
+	if idx == -1 {
+		return fmt.Errorf("entry %s not found in %s", f.Name, config.RepoConfigFile)
+	}
+	for i, key := range f.ActiveOverlays {
+		cfg.Files[idx].Overlays[key] = patches[i]
+	}
+	return config.SaveRepoConfigIn(repoDir, cfg)
+}
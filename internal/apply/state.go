@@ -0,0 +1,261 @@
+package apply
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"gopkg.in/yaml.v3"
+)
+
+// StateFile records what was last applied to each copied target and block
+// on this machine. It lives in the local config dir, never in the repo.
+const StateFile = "apply-state.yaml"
+
+// BaseDir holds the content last applied to targets, named by its hash, so
+// that edits on both sides can be shown against it.
+const BaseDir = "applied"
+
+// Record is what was last applied to one target.
+type Record struct {
+	// Hash is the SHA-256 of the content written to the target.
+	Hash    string    `yaml:"hash"`
+	Applied time.Time `yaml:"applied"`
+}
+
+// State maps target keys, as returned by FileEntry.TargetKey, to what was
+// last applied to them. A nil State records nothing, and entries are
+// compared by modification time alone.
+type State struct {
+	configDir string
+	records   map[string]Record
+}
+
+// stateMu serializes writes to the state file by the daemon's source loops.
+var stateMu sync.Mutex
+
+// LoadState reads the apply state from configDir.
+func LoadState(configDir string) (*State, error) {
+	records, err := readRecords(configDir)
+	if err != nil {
+		return nil, err
+	}
+	return &State{configDir: configDir, records: records}, nil
+}
+
+func readRecords(configDir string) (map[string]Record, error) {
+	records := map[string]Record{}
+	data, err := os.ReadFile(filepath.Join(configDir, StateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", StateFile, err)
+	}
+	return records, nil
+}
+
+// Lookup returns the record for a target key.
+func (s *State) Lookup(key string) (Record, bool) {
+	if s == nil {
+		return Record{}, false
+	}
+	r, ok := s.records[key]
+	return r, ok
+}
+
+// Base returns the content last applied to a target key.
+func (s *State) Base(key string) ([]byte, bool, error) {
+	r, ok := s.Lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.configDir, BaseDir, r.Hash))
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// record notes that content was applied to a target key, keeping a copy
+// of it. The state file is read again first, so records written by other
+// source loops are kept.
+func (s *State) record(key string, content []byte) error {
+	if s == nil {
+		return nil
+	}
+	hash := hashOf(content)
+	if r, ok := s.records[key]; ok && r.Hash == hash {
+		return nil
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	records, err := readRecords(s.configDir)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(s.configDir, BaseDir)
+	if err := os.MkdirAll(base, 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(base, hash), content, 0o600); err != nil {
+		return err
+	}
+	old := records[key].Hash
+	records[key] = Record{Hash: hash, Applied: time.Now().UTC()}
+	data, err := yaml.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.configDir, StateFile), data, 0o644); err != nil {
+		return err
+	}
+	s.records = records
+
+	// Drop the previous copy unless another target still uses it.
+	if old != "" && old != hash {
+		for _, r := range records {
+			if r.Hash == old {
+				return nil
+			}
+		}
+		_ = os.Remove(filepath.Join(base, old))
+	}
+	return nil
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Contents is what a target holds and what the repo wants it to hold.
+type Contents struct {
+	Target []byte
+	// Present is false when the target, or its block, does not exist.
+	Present bool
+	Source  []byte
+}
+
+// ReadContents reads the contents of f's target and source: the file
+// itself for copies, with overlays applied, or the block for block
+// entries. ok is false for symlinked entries, whose target is the source,
+// and for directories.
+func ReadContents(repoDir string, f config.FileEntry) (c Contents, ok bool, err error) {
+	target, hasTarget := fileops.ResolveTarget(f.Targets)
+	if !hasTarget {
+		return c, false, nil
+	}
+	repoFile := f.SourcePath(repoDir)
+	switch f.ApplyMethod() {
+	case config.MethodBlock:
+		source, err := os.ReadFile(repoFile)
+		if err != nil {
+			return c, false, err
+		}
+		c.Source = fileops.NormalizeBlock(source)
+		c.Target, c.Present, err = f.Block().Read(target)
+		return c, err == nil, err
+	case config.MethodCopy:
+		if info, err := os.Stat(repoFile); err != nil || info.IsDir() {
+			return c, false, err
+		}
+		if len(f.ActiveOverlays) > 0 {
+			c.Source, err = rendered(f, repoFile)
+		} else {
+			c.Source, err = os.ReadFile(repoFile)
+		}
+		if err != nil {
+			return c, false, err
+		}
+		if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() {
+			if c.Target, err = os.ReadFile(target); err != nil {
+				return c, false, err
+			}
+			c.Present = true
+		}
+		return c, true, nil
+	}
+	return c, false, nil
+}
+
+// Edits classifies how the target of f and the repo changed since the
+// target was last applied: synced, local edit, remote edit or both edited.
+// It returns "" when there is no record to compare with, when the target
+// is missing, or for entries that are not copied or written into their
+// target.
+func (s *State) Edits(repoDir string, f config.FileEntry) (config.SyncStatus, error) {
+	key, ok := f.TargetKey()
+	if !ok {
+		return "", nil
+	}
+	r, ok := s.Lookup(key)
+	if !ok {
+		return "", nil
+	}
+	c, ok, err := ReadContents(repoDir, f)
+	if err != nil || !ok || !c.Present {
+		return "", err
+	}
+	return classify(r.Hash, c), nil
+}
+
+func classify(applied string, c Contents) config.SyncStatus {
+	local := hashOf(c.Target) != applied
+	remote := hashOf(c.Source) != applied
+	switch {
+	case bytes.Equal(c.Target, c.Source):
+		return config.StatusSynced
+	case local && remote:
+		return config.StatusBothEdited
+	case local:
+		return config.StatusLocalEdit
+	default:
+		return config.StatusRemoteEdit
+	}
+}
+
+// ErrLocalEdits is wrapped by the error of an entry whose target was not
+// written because that would lose local edits.
+var ErrLocalEdits = errors.New("target has local edits")
+
+// recordApplied records what f's target holds after applying it.
+func recordApplied(repoDir string, f config.FileEntry, s *State) error {
+	if s == nil {
+		return nil
+	}
+	key, _ := f.TargetKey()
+	c, ok, err := ReadContents(repoDir, f)
+	if err != nil || !ok || !c.Present {
+		return err
+	}
+	return s.record(key, c.Target)
+}
+
+// backupEdits keeps a copy of a target whose local edits are about to be
+// overwritten, unless applying it keeps one anyway because the target is
+// newer than its source.
+func backupEdits(res Result, repoFile, target string) (Result, error) {
+	info, err := os.Stat(target)
+	if err != nil || newerThan(info, repoFile) {
+		return res, nil
+	}
+	backup := target + fmt.Sprintf(".conflict-%s", time.Now().Format("20060102-150405"))
+	if err := fileops.CopyFile(target, backup); err != nil {
+		return res, fmt.Errorf("backup %s: %w", target, err)
+	}
+	res.Backup = backup
+	return res, nil
+}
@@ -2,24 +2,47 @@ package cli
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
 	"github.com/ihavespoons/synq/internal/fileops"
 	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/ignore"
 	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/merge"
 	"github.com/spf13/cobra"
 )
 
 func newAddCmd() *cobra.Command {
-	var name string
+	var (
+		name, source, method string
+		repoName, comment    string
+		mergeFormat          string
+		ignores, profiles    []string
+	)
 
 	cmd := &cobra.Command{
-		Use:   "add <file>",
-		Short: "Add a file to synq management",
-		Args:  cobra.ExactArgs(1),
+		Use:   "add <path>",
+		Short: "Add a file or directory to synq management",
+		Long: `Add a file or directory to synq management.
+
+With --method block only a marked block of the file is managed, for files
+that installers also write to:
+
+  # BEGIN synq:<name>
+  ...
+  # END synq:<name>
+
+An existing block with the entry's name is taken over; otherwise an empty
+block is appended to the file for you to fill in. The rest of the file is
+never touched, and edits inside the block sync like any other change.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log := logger.Get()
 
@@ -29,64 +52,183 @@ func newAddCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("resolve path: %w", err)
 			}
-			if _, err := os.Stat(absPath); err != nil {
+			info, err := os.Stat(absPath)
+			if err != nil {
 				return fmt.Errorf("file not found: %s", absPath)
 			}
 
-			// Determine name.
-			if name == "" {
-				name = filepath.Base(absPath)
+			switch method {
+			case config.MethodSymlink, config.MethodCopy, config.MethodBlock:
+			default:
+				return fmt.Errorf("unknown method %q (want %s, %s or %s)", method, config.MethodSymlink, config.MethodCopy, config.MethodBlock)
+			}
+			if method != config.MethodSymlink && info.IsDir() {
+				return fmt.Errorf("the %s method supports files only", method)
+			}
+			if comment != "" && method != config.MethodBlock {
+				return fmt.Errorf("--comment only applies to the block method")
+			}
+			if mergeFormat != "" {
+				if err := merge.Validate(mergeFormat); err != nil {
+					return err
+				}
 			}
-			log.Debug().Str("file", absPath).Str("name", name).Msg("adding file")
 
-			repoDir := config.RepoDir(configDir)
-			repoFilePath := filepath.Join(repoDir, name)
+			repo, cfg, err := openRepo(repoName)
+			if err != nil {
+				return err
+			}
+			if err := writable(repo); err != nil {
+				return err
+			}
 
-			// 2. Copy file into repo.
-			if err := fileops.CopyFile(absPath, repoFilePath); err != nil {
-				return fmt.Errorf("copy to repo: %w", err)
+			// Determine name and source.
+			tildePath := fileops.TildePath(absPath)
+			if name == "" {
+				name = filepath.Base(absPath)
+				// Fall back to the home-relative path when the base name is
+				// already used by a different file on this OS.
+				if idx := cfg.FindFile(name); idx != -1 && targetTaken(cfg.Files[idx], tildePath) {
+					name = strings.TrimPrefix(tildePath, "~/")
+				}
+			}
+			key, _ := config.FileEntry{Name: name, Method: method, Targets: map[string]string{runtime.GOOS: absPath}}.TargetKey()
+			if owner, ok := targetOwner(key, repo.Name); ok {
+				return fmt.Errorf("%s is already managed by %s as %q", tildePath, owner.Repo, owner.Name)
+			}
+			idx := cfg.FindFile(name)
+			if idx != -1 {
+				entry := cfg.Files[idx]
+				if entry.Include != "" {
+					return fmt.Errorf("%q is defined in %s; edit it there or use --name", name, entry.Include)
+				}
+				if targetTaken(entry, tildePath) {
+					return fmt.Errorf("name %q is already used by %s on %s; use --name", name, entry.Targets[runtime.GOOS], runtime.GOOS)
+				}
+				if source != "" && source != entry.Source {
+					return fmt.Errorf("%q is stored at %s; use 'synq mv %s %s' to move it", name, entry.Source, name, source)
+				}
+				source = entry.Source
+			}
+			if source == "" {
+				source = fileops.DefaultSource(absPath)
+				if method == config.MethodBlock {
+					source = "blocks/" + name
+				}
 			}
-			fmt.Printf("✓ Copied %s to repo as %s\n", filepath.Base(absPath), name)
+			if err := config.ValidateSource(source); err != nil {
+				return err
+			}
+			if other := cfg.FindSource(source); other != -1 && other != idx {
+				return fmt.Errorf("source %s is already used by %q", source, cfg.Files[other].Name)
+			}
+			log.Debug().Str("file", absPath).Str("name", name).Str("path", source).Str("source", repo.Name).Msg("adding file")
 
-			// 3. Replace original with symlink.
-			if err := fileops.CreateSymlink(repoFilePath, absPath); err != nil {
-				return fmt.Errorf("create symlink: %w", err)
+			repoDir := repo.Dir
+			entry := config.FileEntry{
+				Name:   name,
+				Source: source,
+				Mode:   config.FormatMode(info.Mode()),
+			}
+			if method != config.MethodSymlink {
+				entry.Method = method
+			}
+			if method == config.MethodBlock {
+				// The rest of the file is not ours, so neither is its mode.
+				entry.Mode = ""
+				entry.Comment = comment
+			}
+			entry.Merge = mergeFormat
+			repoFilePath := entry.SourcePath(repoDir)
+			if fileops.IsSymlinkTo(absPath, repoFilePath) {
+				return fmt.Errorf("%s is already managed as %q", tildePath, name)
 			}
-			fmt.Printf("✓ Created symlink %s -> %s\n", fileops.TildePath(absPath), name)
 
-			// 4. Update repo config.
-			cfg, err := config.LoadRepoConfig(configDir)
-			if err != nil {
-				return fmt.Errorf("load repo config: %w", err)
+			// 2. Copy file into repo. Ignored files inside a directory are
+			// copied too, so the target keeps working, but never staged.
+			// Blocks store only what is between their markers.
+			switch {
+			case method == config.MethodBlock:
+				if err := addBlock(entry, absPath, repoFilePath); err != nil {
+					return err
+				}
+			case info.IsDir():
+				if err := fileops.CopyPath(absPath, repoFilePath); err != nil {
+					return fmt.Errorf("copy to repo: %w", err)
+				}
+				entry.Ignore = ignores
+				if idx != -1 {
+					entry.Ignore = appendMissing(cfg.Files[idx].Ignore, ignores)
+				}
+				m, err := ignore.ForRepo(repoDir, []config.FileEntry{entry})
+				if err != nil {
+					return fmt.Errorf("load %s: %w", ignore.FileName, err)
+				}
+				skipped, err := countIgnored(repoFilePath, source, m)
+				if err != nil {
+					return fmt.Errorf("scan %s: %w", source, err)
+				}
+				fmt.Printf("✓ Copied %s/ to repo as %s (%d ignored)\n", filepath.Base(absPath), source, skipped)
+			default:
+				if err := fileops.CopyPath(absPath, repoFilePath); err != nil {
+					return fmt.Errorf("copy to repo: %w", err)
+				}
+				fmt.Printf("✓ Copied %s to repo as %s\n", filepath.Base(absPath), source)
 			}
 
-			// Check if entry already exists.
-			found := false
-			for i, f := range cfg.Files {
-				if f.Name == name {
-					cfg.Files[i].Targets[runtime.GOOS] = fileops.TildePath(absPath)
-					found = true
-					break
+			// 3. Replace original with symlink. Copies stay in place.
+			if method == config.MethodSymlink {
+				if info.IsDir() {
+					if err := os.RemoveAll(absPath); err != nil {
+						return fmt.Errorf("remove original directory: %w", err)
+					}
 				}
+				if err := fileops.CreateSymlink(repoFilePath, absPath); err != nil {
+					return fmt.Errorf("create symlink: %w", err)
+				}
+				fmt.Printf("✓ Created symlink %s -> %s\n", tildePath, source)
 			}
-			if !found {
-				cfg.Files = append(cfg.Files, config.FileEntry{
-					Name:   name,
-					Source: name,
-					Targets: map[string]string{
-						runtime.GOOS: fileops.TildePath(absPath),
-					},
-				})
+
+			// 4. Update repo config.
+			if idx != -1 {
+				if cfg.Files[idx].Targets == nil {
+					cfg.Files[idx].Targets = map[string]string{}
+				}
+				cfg.Files[idx].Targets[runtime.GOOS] = tildePath
+				cfg.Files[idx].Ignore = appendMissing(cfg.Files[idx].Ignore, ignores)
+				cfg.Files[idx].Mode = entry.Mode
+				cfg.Files[idx].Method = entry.Method
+				cfg.Files[idx].Comment = entry.Comment
+				if entry.Merge != "" {
+					cfg.Files[idx].Merge = entry.Merge
+				}
+				cfg.Files[idx].Profiles = appendMissing(cfg.Files[idx].Profiles, profiles)
+			} else {
+				entry.Targets = map[string]string{
+					runtime.GOOS: tildePath,
+				}
+				entry.Ignore = ignores
+				entry.Profiles = profiles
+				cfg.Files = append(cfg.Files, entry)
 			}
 
-			if err := config.SaveRepoConfig(configDir, cfg); err != nil {
+			if err := config.SaveRepoConfigIn(repoDir, cfg); err != nil {
 				return fmt.Errorf("save repo config: %w", err)
 			}
+			if err := activateProfiles(profiles); err != nil {
+				return err
+			}
 
 			// 5. Commit + push.
-			if err := gitops.CommitAndPush(repoDir, fmt.Sprintf("Add %s", name)); err != nil {
+			filter, err := stageFilter(repoDir, cfg)
+			if err != nil {
+				return err
+			}
+			message := fmt.Sprintf("Add %s", name)
+			if err := gitops.CommitAndPush(repoDir, message, filter); err != nil {
 				return fmt.Errorf("commit and push: %w", err)
 			}
+			record(sourceEvents(repo, events.Event{Type: events.Pushed, Name: name, Message: message})...)
 			fmt.Printf("✓ Committed and pushed\n")
 
 			return nil
@@ -94,5 +236,119 @@ func newAddCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&name, "name", "", "name for the file in the repo (defaults to filename)")
+	cmd.Flags().StringVar(&source, "source", "", "path inside the repo (defaults to home/<path relative to ~>)")
+	cmd.Flags().StringVar(&repoName, "repo", "", "source repo to add the file to (defaults to the default repo)")
+	cmd.Flags().StringVar(&method, "method", config.MethodSymlink, "how the file is applied: symlink, copy or block")
+	cmd.Flags().StringVar(&mergeFormat, "merge", "", "merge concurrent edits key by key: json, yaml, toml or ini")
+	cmd.Flags().StringVar(&comment, "comment", "", "comment prefix of the block markers (default \"#\")")
+	cmd.Flags().StringArrayVar(&ignores, "ignore", nil, "glob of files to leave out of the repo, relative to a directory (repeatable)")
+	cmd.Flags().StringArrayVar(&profiles, "profile", nil, "only apply the file on machines with this profile active (repeatable)")
 	return cmd
 }
+
+// addBlock stores the content of entry's block in target at repoFile,
+// appending an empty block to target when it has none yet.
+func addBlock(entry config.FileEntry, target, repoFile string) error {
+	b := entry.Block()
+	content, found, err := b.Read(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(repoFile), 0o755); err != nil {
+		return fmt.Errorf("copy to repo: %w", err)
+	}
+	if err := os.WriteFile(repoFile, content, 0o644); err != nil {
+		return fmt.Errorf("copy to repo: %w", err)
+	}
+	if found {
+		fmt.Printf("✓ Copied block %s of %s to repo as %s\n", entry.Name, filepath.Base(target), entry.Source)
+		return nil
+	}
+	if _, err := b.Write(target, nil); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Added an empty %s block to %s; edit between its markers\n", entry.Name, fileops.TildePath(target))
+	return nil
+}
+
+// activateProfiles makes sure the profiles of a file added on this machine
+// are active here, so it keeps applying after the next sync.
+func activateProfiles(profiles []string) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	state, err := config.LoadLocalState(configDir)
+	if err != nil {
+		return fmt.Errorf("load local state: %w", err)
+	}
+	var added []string
+	for _, p := range profiles {
+		if !slices.Contains(state.Profiles, p) {
+			state.Profiles = append(state.Profiles, p)
+			added = append(added, p)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if err := config.SaveLocalState(configDir, state); err != nil {
+		return fmt.Errorf("save local state: %w", err)
+	}
+	fmt.Printf("✓ Activated profile %s on this machine\n", strings.Join(added, ", "))
+	return nil
+}
+
+// appendMissing appends the values of add that are not already in existing.
+func appendMissing(existing, add []string) []string {
+	for _, p := range add {
+		if !slices.Contains(existing, p) {
+			existing = append(existing, p)
+		}
+	}
+	return existing
+}
+
+// countIgnored counts files under dir (stored at source) that m ignores.
+func countIgnored(dir, source string, m *ignore.Matcher) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." || !m.Match(source+"/"+filepath.ToSlash(rel), d.IsDir()) {
+			return nil
+		}
+		if d.IsDir() {
+			n, err := countFiles(path)
+			count += n
+			if err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+func countFiles(dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return err
+	})
+	return count, err
+}
+
+// targetTaken reports whether entry already manages a different file on this OS.
+func targetTaken(entry config.FileEntry, tildePath string) bool {
+	t, ok := entry.Targets[runtime.GOOS]
+	return ok && fileops.ExpandPath(t) != fileops.ExpandPath(tildePath)
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/layers"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect a repo's synq.yaml",
+	}
+
+	cmd.AddCommand(newConfigShowCmd())
+	return cmd
+}
+
+// effectiveEntry is an entry of the merged config with where it comes from.
+type effectiveEntry struct {
+	config.FileEntry `yaml:",inline"`
+	From             string `yaml:"from"`
+	ReadOnly         bool   `yaml:"read_only,omitempty"`
+}
+
+type effectiveScript struct {
+	config.Script `yaml:",inline"`
+	From          string `yaml:"from"`
+}
+
+// overriddenEntry is a layer entry replaced by a higher one.
+type overriddenEntry struct {
+	Name string `yaml:"name"`
+	From string `yaml:"from"`
+	By   string `yaml:"by"`
+}
+
+type effectiveConfig struct {
+	Files      []effectiveEntry  `yaml:"files"`
+	Scripts    []effectiveScript `yaml:"scripts,omitempty"`
+	Overridden []overriddenEntry `yaml:"overridden,omitempty"`
+}
+
+func newConfigShowCmd() *cobra.Command {
+	var (
+		effective  bool
+		sourceName string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print synq.yaml, or the config in effect on this machine",
+		Long: `Print synq.yaml, or the config in effect on this machine.
+
+With --effective the entries of included files and extended layers are
+merged in, in order of precedence: synq.yaml, then its includes, then its
+layers. Each entry names where it comes from; layer entries are read-only.
+Layer entries replaced by a higher entry with the same name or target are
+listed under overridden, resolved with this machine's profiles.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, cfg, err := openRepo(sourceName)
+			if err != nil {
+				return err
+			}
+			if !effective {
+				data, err := os.ReadFile(filepath.Join(repo.Dir, config.RepoConfigFile))
+				if err != nil {
+					return fmt.Errorf("read repo config: %w", err)
+				}
+				fmt.Print(string(data))
+				return nil
+			}
+
+			out := effectiveConfig{Files: []effectiveEntry{}}
+			for _, f := range cfg.Files {
+				from := config.RepoConfigFile
+				if f.Include != "" {
+					from = f.Include
+				}
+				out.Files = append(out.Files, effectiveEntry{FileEntry: f, From: from})
+			}
+			for _, s := range cfg.Scripts {
+				from := config.RepoConfigFile
+				if s.Include != "" {
+					from = s.Include
+				}
+				out.Scripts = append(out.Scripts, effectiveScript{Script: s, From: from})
+			}
+
+			list, err := layers.Resolve(configDir, cfg, loadState().Profiles)
+			if err != nil {
+				return err
+			}
+			for _, l := range list {
+				for _, f := range l.Files {
+					out.Files = append(out.Files, effectiveEntry{FileEntry: f, From: l.Name(), ReadOnly: true})
+				}
+				for _, name := range sortedKeys(l.Overridden) {
+					out.Overridden = append(out.Overridden, overriddenEntry{Name: name, From: l.Name(), By: l.Overridden[name]})
+				}
+			}
+
+			data, err := yaml.Marshal(&out)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&effective, "effective", false, "merge includes and layers and show where each entry comes from")
+	cmd.Flags().StringVar(&sourceName, "source", "", "show the config of this source")
+	return cmd
+}
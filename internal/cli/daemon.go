@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
 
+	"github.com/ihavespoons/synq/internal/config"
 	"github.com/ihavespoons/synq/internal/daemon"
+	"github.com/ihavespoons/synq/internal/fileops"
 	"github.com/ihavespoons/synq/internal/logger"
 	"github.com/spf13/cobra"
 )
@@ -14,6 +18,33 @@ func newDaemonCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "daemon",
 		Short: "Manage the synq background daemon",
+		Long: `Manage the synq background daemon.
+
+The daemon commits and pushes edits to managed files as they happen, and
+pulls remote changes every poll interval. The daemon.schedule settings in
+the local synq.yaml pause its pulls and pushes:
+
+  quiet_hours        daily windows, such as "22:00-07:00"
+  pause_on_battery   pause while the machine runs on battery
+  pause_interfaces   pause while a matching interface is up, such as "usb*"
+  min_push_interval  the least time between two pushes, such as "15m"
+
+Edits made while paused are committed locally and pushed in one batch
+afterwards.
+
+The daemon.notify settings make it pull as soon as a remote changes, with
+polling as the fallback:
+
+  check_remote    ask the remote with git ls-remote and pull only if it moved
+  webhook_listen  host:port where a POST, such as a push webhook, triggers
+                  a pull; add ?source=NAME to pull one source only
+  webhook_secret  required unless webhook_listen is a loopback address;
+                  the local synq.yaml must then be readable only by you
+  events_url      a server-sent events stream, such as an ntfy topic
+  peer_port       announce pushes to machines on the local network by UDP
+                  broadcast on this port, and listen for theirs
+
+Restart the daemon after changing these settings.`,
 	}
 
 	cmd.AddCommand(
@@ -25,6 +56,10 @@ func newDaemonCmd() *cobra.Command {
 	return cmd
 }
 
+// startupGrace is how long daemon start waits for the background daemon to
+// fail before reporting success.
+const startupGrace = time.Second
+
 func newDaemonStartCmd() *cobra.Command {
 	var foreground bool
 
@@ -34,9 +69,28 @@ func newDaemonStartCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log := logger.Get()
 
+			mgr := installedService()
 			if foreground {
-				// Run the main loop directly.
-				return daemon.Run(configDir)
+				// A manual run next to the service-managed instance would
+				// fight it over the repo.
+				if mgr != nil && !daemon.UnderServiceManager() {
+					if st, err := mgr.Status(); err == nil && st.Running {
+						return fmt.Errorf("the synq service is already running under %s; run 'synq daemon stop' first", mgr.Name())
+					}
+				}
+
+				// Run the main loop directly, keeping a log file since
+				// nothing reads stderr of a background daemon.
+				logFile, err := logger.InitFile(verbose, filepath.Join(configDir, logger.FileName))
+				if err != nil {
+					return fmt.Errorf("open log file: %w", err)
+				}
+				defer func() { _ = logFile.Close() }()
+				if err := daemon.Run(configDir, cmd.Root().Version); err != nil {
+					logger.Get().Error().Err(err).Msg("daemon stopped")
+					return err
+				}
+				return nil
 			}
 
 			// Check if already running.
@@ -45,6 +99,16 @@ func newDaemonStartCmd() *cobra.Command {
 				return nil
 			}
 
+			// Let the service manager supervise the daemon when the
+			// service is installed.
+			if mgr != nil {
+				if err := mgr.Start(); err != nil {
+					return fmt.Errorf("start service: %w", err)
+				}
+				fmt.Printf("Daemon started by %s\n", mgr.Name())
+				return nil
+			}
+
 			// Start self in background with --foreground.
 			exe, err := os.Executable()
 			if err != nil {
@@ -61,18 +125,28 @@ func newDaemonStartCmd() *cobra.Command {
 			bgCmd.Stderr = nil
 			bgCmd.Stdin = nil
 
-			// Detach from parent.
-			bgCmd.SysProcAttr = nil
+			// Detach from the terminal's session.
+			bgCmd.SysProcAttr = daemon.DetachAttr()
 
 			if err := bgCmd.Start(); err != nil {
 				return fmt.Errorf("start daemon: %w", err)
 			}
 
-			// Release the process so it continues after we exit.
-			if err := bgCmd.Process.Release(); err != nil {
-				log.Warn().Err(err).Msg("release process")
+			// Catch a daemon that exits right away, e.g. because another
+			// instance holds the lock.
+			exited := make(chan error, 1)
+			go func() { exited <- bgCmd.Wait() }()
+			select {
+			case err := <-exited:
+				logPath := fileops.TildePath(filepath.Join(configDir, logger.FileName))
+				if err == nil {
+					err = fmt.Errorf("exited")
+				}
+				return fmt.Errorf("daemon failed to start (%v); see %s", err, logPath)
+			case <-time.After(startupGrace):
 			}
 
+			log.Debug().Int("pid", bgCmd.Process.Pid).Msg("daemon detached")
 			fmt.Printf("Daemon started (PID %d)\n", bgCmd.Process.Pid)
 			return nil
 		},
@@ -88,6 +162,17 @@ func newDaemonStopCmd() *cobra.Command {
 		Short: "Stop the synq daemon",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			running, pid := daemon.IsRunning(configDir)
+			// Stop a supervised daemon through its service manager, or
+			// it is restarted right away.
+			if mgr := installedService(); mgr != nil {
+				if st, err := mgr.Status(); err == nil && st.Running {
+					if err := mgr.Stop(); err != nil {
+						return fmt.Errorf("stop service: %w", err)
+					}
+					fmt.Printf("Daemon stopped by %s\n", mgr.Name())
+					return nil
+				}
+			}
 			if !running {
 				fmt.Println("Daemon is not running")
 				return nil
@@ -110,11 +195,33 @@ func newDaemonStatusCmd() *cobra.Command {
 		Short: "Check if the synq daemon is running",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			running, pid := daemon.IsRunning(configDir)
-			if running {
-				fmt.Printf("Daemon is running (PID %d)\n", pid)
-			} else {
+			supervisor := ""
+			if mgr := installedService(); mgr != nil {
+				if st, err := mgr.Status(); err == nil && st.Running {
+					running, pid, supervisor = true, st.PID, mgr.Name()
+				}
+			}
+			switch {
+			case supervisor != "":
+				fmt.Printf("Daemon is running (PID %d, supervised by %s)\n", pid, supervisor)
+			case running:
+				fmt.Printf("Daemon is running (PID %d, not supervised)\n", pid)
+			default:
 				fmt.Println("Daemon is not running")
 			}
+			if state, err := config.LoadLocalState(configDir); err == nil {
+				sched, err := daemon.NewSchedule(state.Daemon.Schedule)
+				if err != nil {
+					fmt.Printf("⚠ Invalid schedule: %v\n", err)
+				} else if reason, _ := sched.Paused(time.Now()); reason != "" {
+					fmt.Printf("Paused: %s; changes are committed locally and pushed afterwards\n", reason)
+				}
+				for _, r := range state.Repos(configDir) {
+					if r.Peer != "" {
+						fmt.Printf("Pull only: %s, from peer %s, which serves it read-only\n", r.Name, r.Peer)
+					}
+				}
+			}
 			return nil
 		},
 	}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/layers"
+	"github.com/spf13/cobra"
+)
+
+func newDiffCmd() *cobra.Command {
+	var source string
+
+	cmd := &cobra.Command{
+		Use:   "diff [name]...",
+		Short: "Show local and repo edits to copied files and blocks",
+		Long: `Show how copied targets and blocks differ from the repo.
+
+For an entry whose target synq wrote before, the edits made to the target
+and the changes made in the repo since are each shown as a diff against
+what synq last wrote, so edits on both sides can be told apart. Otherwise
+the target is compared with the repo directly. Symlinked entries always
+match the repo and are not shown.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, cfg, err := openRepo(source)
+			if err != nil {
+				return err
+			}
+			type entry struct {
+				dir string
+				f   config.FileEntry
+			}
+			var entries []entry
+			for _, f := range activeFiles(repo, cfg) {
+				entries = append(entries, entry{repo.Dir, f})
+			}
+			if len(cfg.Extends) > 0 {
+				profiles := loadState().Profiles
+				list, err := layers.Resolve(configDir, cfg, profiles)
+				if err != nil {
+					return err
+				}
+				for _, l := range list {
+					for _, f := range l.ActiveFiles(profiles) {
+						entries = append(entries, entry{l.Dir, f})
+					}
+				}
+			}
+			for _, name := range args {
+				if !slices.ContainsFunc(entries, func(e entry) bool { return e.f.Name == name }) {
+					return fmt.Errorf("no active entry named %q", name)
+				}
+			}
+
+			tmp, err := os.MkdirTemp("", "synq-diff-")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = os.RemoveAll(tmp) }()
+
+			st := applyState()
+			shown := 0
+			for _, e := range entries {
+				if len(args) > 0 && !slices.Contains(args, e.f.Name) {
+					continue
+				}
+				n, err := diffEntry(tmp, st, e.dir, e.f)
+				if err != nil {
+					return fmt.Errorf("%s: %w", e.f.Name, err)
+				}
+				shown += n
+			}
+			if shown == 0 {
+				fmt.Println("✓ Targets match the repo")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&source, "source", "", "show entries of this source")
+	return cmd
+}
+
+// diffEntry prints the diffs of one entry, writing the contents to compare
+// into tmp. It returns how many diffs it printed.
+func diffEntry(tmp string, st *apply.State, repoDir string, f config.FileEntry) (int, error) {
+	c, ok, err := apply.ReadContents(repoDir, f)
+	if err != nil || !ok || string(c.Target) == string(c.Source) {
+		return 0, err
+	}
+	target, _ := fileops.ResolveTarget(f.Targets)
+	key, _ := f.TargetKey()
+	write := func(name string, content []byte) (string, error) {
+		p := filepath.Join(tmp, name)
+		return p, os.WriteFile(p, content, 0o600)
+	}
+	targetFile, err := write("target", c.Target)
+	if err != nil {
+		return 0, err
+	}
+	sourceFile, err := write("source", c.Source)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := st.Edits(repoDir, f)
+	if err != nil {
+		return 0, err
+	}
+	base, hasBase, err := st.Base(key)
+	if err != nil {
+		return 0, err
+	}
+	if status == "" || !hasBase {
+		fmt.Printf("%s (%s)\n", f.Name, fileops.TildePath(target))
+		return printDiff(sourceFile, targetFile, "repo", fileops.TildePath(target))
+	}
+
+	fmt.Printf("%s (%s, %s)\n", f.Name, fileops.TildePath(target), status)
+	baseFile, err := write("base", base)
+	if err != nil {
+		return 0, err
+	}
+	shown := 0
+	for _, side := range []struct{ file, label string }{
+		{targetFile, fileops.TildePath(target)},
+		{sourceFile, "repo"},
+	} {
+		n, err := printDiff(baseFile, side.file, "last applied", side.label)
+		if err != nil {
+			return shown, err
+		}
+		shown += n
+	}
+	return shown, nil
+}
+
+func printDiff(a, b, labelA, labelB string) (int, error) {
+	out, err := gitops.DiffFiles(a, b, labelA, labelB)
+	if err != nil || out == "" {
+		return 0, err
+	}
+	fmt.Print(out)
+	return 1, nil
+}
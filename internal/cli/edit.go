@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/merge"
+	"github.com/spf13/cobra"
+)
+
+func newEditCmd() *cobra.Command {
+	var (
+		sourceName string
+		noPush     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "edit <name>",
+		Short: "Edit a managed file in the repo, then commit, push and apply it",
+		Long: `Edit a managed file in the repo, then commit, push and apply it.
+
+The repo's copy of the file is opened in $VISUAL or $EDITOR. Edits made
+to this machine's target are captured first, so they are not lost. Once
+the editor exits, JSON, YAML, TOML and INI files are checked for syntax
+errors, and a file that does not parse can be edited again or dropped.
+The change is shown as a diff, committed with the keys it touches, pushed
+and applied to the target. Per-machine overlays stay in synq.yaml; the
+file edited is the one shared by every machine.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			// 1. Find the entry and its source.
+			repo, cfg, err := openRepo(sourceName)
+			if err != nil {
+				return err
+			}
+			if err := writable(repo); err != nil {
+				return err
+			}
+			idx := cfg.FindFile(name)
+			if idx == -1 && len(cfg.Extends) > 0 {
+				return fmt.Errorf("file %q not found in synq config; entries from extended layers are read-only, override them with 'synq add'", name)
+			}
+			if idx == -1 {
+				return fmt.Errorf("file %q not found in synq config", name)
+			}
+			f := cfg.Files[idx]
+			repoDir := repo.Dir
+			repoFile := f.SourcePath(repoDir)
+			info, err := os.Stat(repoFile)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return fmt.Errorf("%s is a directory; edit the files in %s instead", name, repoFile)
+			}
+
+			// 2. Capture edits to the target, so the editor starts from them.
+			active := slices.ContainsFunc(activeFiles(repo, cfg), func(e config.FileEntry) bool { return e.Name == name })
+			if active {
+				f.ActiveOverlays = f.OverlayKeys(loadState().Profiles)
+				printResults(apply.Capture(repoDir, []config.FileEntry{f}, applyState()))
+				if _, err := gitops.CommitPaths(repoDir, "Capture local edits to "+name, f.Source); err != nil {
+					return fmt.Errorf("commit captured edits: %w", err)
+				}
+			}
+			before, err := os.ReadFile(repoFile)
+			if err != nil {
+				return err
+			}
+
+			// 3. Edit a copy until it is valid, or given up on.
+			format, err := merge.Format(f)
+			known := err == nil
+			after, err := editValid(filepath.Base(repoFile), before, format, known)
+			if err != nil {
+				return err
+			}
+			if string(after) == string(before) {
+				fmt.Printf("✓ No changes to %s\n", name)
+				return nil
+			}
+			showDiff(before, after, f.Source, f.Source, useColor())
+			if err := os.WriteFile(repoFile, after, info.Mode().Perm()); err != nil {
+				return err
+			}
+
+			// 4. Commit and push.
+			message := editMessage(name, format, known, before, after)
+			if _, err := gitops.CommitPaths(repoDir, message, f.Source); err != nil {
+				return fmt.Errorf("commit: %w", err)
+			}
+			fmt.Printf("✓ Committed %q\n", message)
+			if noPush {
+				fmt.Println("⚠ Not pushed; run 'synq sync' to push it")
+			} else if err := gitops.Push(repoDir); err != nil {
+				record(sourceEvents(repo, events.Event{Type: events.Failed, Name: "push", Message: err.Error()})...)
+				fmt.Printf("⚠ Push failed: %v; run 'synq sync' to push it\n", err)
+			} else {
+				record(sourceEvents(repo, events.Event{Type: events.Pushed, Name: name, Message: message})...)
+				fmt.Println("✓ Pushed")
+			}
+
+			// 5. Apply the new version to this machine's target.
+			if !active {
+				fmt.Printf("⚠ %s is not active on this machine; not applied\n", name)
+				return nil
+			}
+			printResults([]apply.Result{apply.Entry(repoDir, f, applyOptions(repoDir))})
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&sourceName, "source", "", "source repo the file belongs to")
+	cmd.Flags().BoolVar(&noPush, "no-push", false, "commit the change without pushing it")
+	return cmd
+}
+
+// editValid opens content in the editor and returns the result. If format
+// is known, the result must parse; otherwise the user is asked whether to
+// edit it again, and the edit is dropped if not.
+func editValid(name string, content []byte, format string, known bool) ([]byte, error) {
+	in := bufio.NewReader(os.Stdin)
+	for {
+		out, err := editContent(name, content)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			return out, nil
+		}
+		err = merge.Check(format, out)
+		if err == nil {
+			return out, nil
+		}
+		fmt.Printf("✗ %s is not valid %s: %v\n", name, format, err)
+		fmt.Print("Edit again? [Y/n] ")
+		line, readErr := in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if (readErr != nil && line == "") || strings.HasPrefix(answer, "n") {
+			if readErr != nil {
+				fmt.Println()
+			}
+			return nil, fmt.Errorf("edit dropped; %s is unchanged", name)
+		}
+		content = out
+	}
+}
+
+// maxKeys is how many changed keys a commit message names.
+const maxKeys = 3
+
+// editMessage describes an edit to the named entry, naming the keys it
+// changes when the format is known.
+func editMessage(name, format string, known bool, before, after []byte) string {
+	message := "Edit " + name
+	if !known {
+		return message
+	}
+	keys, err := merge.ChangedKeys(format, before, after)
+	if err != nil || len(keys) == 0 {
+		return message
+	}
+	if len(keys) > maxKeys {
+		keys = append(keys[:maxKeys], fmt.Sprintf("%d more", len(keys)-maxKeys))
+	}
+	return message + ": " + strings.Join(keys, ", ")
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/events"
+	"github.com/spf13/cobra"
+)
+
+func newEventsCmd() *cobra.Command {
+	var (
+		since  string
+		follow bool
+		types  []string
+		asJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show the journal of sync activity on this machine",
+		Long: `Show the journal of sync activity on this machine.
+
+synq sync, the daemon and the file commands append to events.jsonl in the
+config dir: pushes, pulls, conflicts, backups, applied entries, hooks and
+scripts. The daemon's own log is written to daemon.log next to it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := parseSince(since, time.Now())
+			if err != nil {
+				return err
+			}
+			show := func(e events.Event) {
+				if len(types) > 0 && !slices.Contains(types, string(e.Type)) {
+					return
+				}
+				if asJSON {
+					line, _ := json.Marshal(e)
+					fmt.Println(string(line))
+					return
+				}
+				fmt.Println(formatEvent(e))
+			}
+
+			list, offset, err := events.Read(configDir, from)
+			if err != nil {
+				return fmt.Errorf("read events: %w", err)
+			}
+			for _, e := range list {
+				show(e)
+			}
+			if !follow {
+				if len(list) == 0 && !asJSON {
+					fmt.Println("No events recorded.")
+				}
+				return nil
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			return events.Follow(ctx, configDir, offset, 500*time.Millisecond, show)
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "24h", "show events newer than a duration (2h) or date (2006-01-02, RFC 3339); empty for all")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing new events as they are recorded")
+	cmd.Flags().StringSliceVar(&types, "type", nil, "only show events of these types")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print events as JSON lines")
+	return cmd
+}
+
+// parseSince parses --since as a duration before now, a date or a timestamp.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: want a duration, a date or an RFC 3339 time", s)
+}
+
+func formatEvent(e events.Event) string {
+	parts := []string{e.Time.Local().Format("2006-01-02 15:04:05"), fmt.Sprintf("%-8s", e.Type)}
+	if e.Name != "" {
+		parts = append(parts, e.Name)
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k+"="+e.Data[k])
+	}
+	return strings.TrimRight(strings.Join(parts, "  "), " ")
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/hooks"
+	"github.com/spf13/cobra"
+)
+
+func newHooksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hooks",
+		Short: "Review, trust and enable entry hooks",
+		Long: `Review, trust and enable entry hooks.
+
+Hooks arrive with the repo, so they never run until hooks are enabled on
+this machine and the exact commands of an entry have been trusted. Any
+change to an entry's hooks has to be trusted again.`,
+	}
+
+	cmd.AddCommand(
+		newHooksListCmd(),
+		newHooksTrustCmd(),
+		newHooksUntrustCmd(),
+		newHooksToggleCmd("enable", "Allow trusted hooks to run on this machine", true),
+		newHooksToggleCmd("disable", "Stop running hooks on this machine", false),
+	)
+	return cmd
+}
+
+func newHooksListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List entry hooks and whether they are trusted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+
+			if state.Hooks.Enabled {
+				fmt.Println("Hooks are enabled on this machine.")
+			} else {
+				fmt.Println("Hooks are disabled on this machine. Use 'synq hooks enable' to allow trusted hooks to run.")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "\nNAME\tHOOK\tTRUSTED\tCOMMAND"); err != nil {
+				return err
+			}
+			for _, f := range cfg.Files {
+				trusted := hooks.IsTrusted(state.Hooks.Trusted, f)
+				for _, kind := range []hooks.Kind{hooks.PreApply, hooks.PostApply, hooks.PostChange} {
+					command := hooks.Command(f.Hooks, kind)
+					if command == "" {
+						continue
+					}
+					if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, kind, yesNo(trusted), command); err != nil {
+						return err
+					}
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newHooksTrustCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "trust [name...]",
+		Short: "Trust the current hook commands of entries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all && len(args) == 0 {
+				return fmt.Errorf("name an entry or pass --all")
+			}
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+
+			var entries []config.FileEntry
+			if all {
+				for _, f := range cfg.Files {
+					if f.Hooks != nil {
+						entries = append(entries, f)
+					}
+				}
+			}
+			for _, name := range args {
+				idx := cfg.FindFile(name)
+				if idx == -1 {
+					return fmt.Errorf("file %q not found in synq config", name)
+				}
+				if cfg.Files[idx].Hooks == nil {
+					return fmt.Errorf("%q has no hooks", name)
+				}
+				entries = append(entries, cfg.Files[idx])
+			}
+
+			if state.Hooks.Trusted == nil {
+				state.Hooks.Trusted = map[string]string{}
+			}
+			for _, f := range entries {
+				for _, kind := range []hooks.Kind{hooks.PreApply, hooks.PostApply, hooks.PostChange} {
+					if command := hooks.Command(f.Hooks, kind); command != "" {
+						fmt.Printf("  %s %s: %s\n", f.Name, kind, command)
+					}
+				}
+				state.Hooks.Trusted[f.Name] = hooks.Fingerprint(f)
+				fmt.Printf("✓ Trusted hooks for %s\n", f.Name)
+			}
+
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			if !state.Hooks.Enabled {
+				fmt.Println("Hooks are disabled on this machine; use 'synq hooks enable' to run them.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "trust the hooks of every entry")
+	return cmd
+}
+
+func newHooksUntrustCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "untrust <name>...",
+		Short: "Stop trusting the hooks of entries",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			for _, name := range args {
+				delete(state.Hooks.Trusted, name)
+				fmt.Printf("✓ Untrusted hooks for %s\n", name)
+			}
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+func newHooksToggleCmd(use, short string, enabled bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			state.Hooks.Enabled = enabled
+			if state.Hooks.Timeout == "" {
+				state.Hooks.Timeout = config.DefaultHookTimeout
+			}
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			fmt.Printf("✓ Hooks %sd\n", use)
+			return nil
+		},
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
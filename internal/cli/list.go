@@ -3,85 +3,157 @@ package cli
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/ihavespoons/synq/internal/apply"
 	"github.com/ihavespoons/synq/internal/config"
 	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/layers"
+	"github.com/ihavespoons/synq/internal/trust"
 	"github.com/spf13/cobra"
 )
 
 func newListCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		all        bool
+		sourceName string
+	)
+
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all managed files and their status",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRepoConfig(configDir)
-			if err != nil {
-				return fmt.Errorf("load repo config: %w", err)
+			state := loadState()
+			repos := state.Repos(configDir)
+			if sourceName != "" {
+				repo, err := state.Repo(configDir, sourceName)
+				if err != nil {
+					return err
+				}
+				repos = []config.Repo{repo}
 			}
-
-			if len(cfg.Files) == 0 {
-				fmt.Println("No files managed by synq. Use 'synq add <file>' to get started.")
-				return nil
+			cfgs := make([]*config.Config, len(repos))
+			// Name the source only once there is more than one, and where
+			// entries come from once any come from includes or layers.
+			showSource := len(state.Sources) > 0
+			showFrom := false
+			for i, repo := range repos {
+				cfg, err := config.LoadRepoConfigIn(repo.Dir)
+				if err != nil {
+					return fmt.Errorf("load %s config: %w", repo.Name, err)
+				}
+				cfgs[i] = cfg
+				showFrom = showFrom || len(cfg.Include) > 0 || len(cfg.Extends) > 0
 			}
 
-			repoDir := config.RepoDir(configDir)
-
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			if _, err := fmt.Fprintln(w, "NAME\tTARGET\tSTATUS"); err != nil {
+			header := "NAME\tTARGET\tSTATUS\tPROFILES"
+			if showFrom {
+				header += "\tFROM"
+			}
+			if showSource {
+				header = "SOURCE\t" + header
+			}
+			if _, err := fmt.Fprintln(w, header); err != nil {
 				return err
 			}
 
-			for _, f := range cfg.Files {
-				target, hasTarget := fileops.ResolveTarget(f.Targets)
-				status := getStatus(f, repoDir, target, hasTarget)
+			st := applyState()
+			total, hidden := 0, 0
+			for i, repo := range repos {
+				cfg := cfgs[i]
+				shadowed, err := config.Shadowed(configDir, state, repo.Name, cfg.Files)
+				if err != nil {
+					return err
+				}
+				total += len(cfg.Files)
+
+				row := func(dir string, f config.FileEntry, status config.SyncStatus, from string) error {
+					active := config.InProfiles(f.Profiles, state.Profiles)
+					if !active && !all {
+						hidden++
+						return nil
+					}
+					if !active {
+						status = config.StatusInactive
+					} else if status == "" {
+						f.ActiveOverlays = f.OverlayKeys(state.Profiles)
+						status = apply.Status(dir, f, st)
+					}
+
+					target, hasTarget := fileops.ResolveTarget(f.Targets)
+					targetDisplay := "(no target for this OS)"
+					if hasTarget {
+						targetDisplay = fileops.TildePath(target)
+					}
+					profiles := "-"
+					if len(f.Profiles) > 0 {
+						profiles = strings.Join(f.Profiles, ",")
+					}
+
+					line := fmt.Sprintf("%s\t%s\t%s\t%s", f.Name, targetDisplay, status, profiles)
+					if showFrom {
+						line += "\t" + from
+					}
+					if showSource {
+						line = repo.Name + "\t" + line
+					}
+					_, err := fmt.Fprintln(w, line)
+					return err
+				}
 
-				targetDisplay := "(no target for this OS)"
-				if hasTarget {
-					targetDisplay = fileops.TildePath(target)
+				for _, f := range cfg.Files {
+					var status config.SyncStatus
+					if c, ok := shadowed[f.Name]; ok {
+						status = config.StatusShadowed + config.SyncStatus(" by "+c.Repo+"/"+c.Name)
+					}
+					from := "-"
+					if f.Include != "" {
+						from = f.Include
+					}
+					if err := row(repo.Dir, f, status, from); err != nil {
+						return err
+					}
 				}
 
-				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, targetDisplay, status); err != nil {
-					return err
+				if len(cfg.Extends) == 0 {
+					continue
+				}
+				list, err := layers.Resolve(configDir, cfg, state.Profiles)
+				if err != nil {
+					fmt.Printf("⚠ %v\n", err)
+					continue
+				}
+				for _, l := range list {
+					total += len(l.Files)
+					for _, f := range l.Files {
+						if err := row(l.Dir, f, "", l.Name()+" (read-only)"); err != nil {
+							return err
+						}
+					}
 				}
 			}
 
-			return w.Flush()
+			if total == 0 {
+				fmt.Println("No files managed by synq. Use 'synq add <file>' to get started.")
+				return nil
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if hidden > 0 {
+				fmt.Printf("\n%d file(s) in inactive profiles hidden; use --all to show them.\n", hidden)
+			}
+			if held, err := trust.LoadHeld(configDir); err == nil && len(held) > 0 {
+				fmt.Println()
+				printHeld(held)
+			}
+			return nil
 		},
 	}
-}
-
-func getStatus(f config.FileEntry, repoDir, target string, hasTarget bool) config.SyncStatus {
-	if !hasTarget {
-		return config.StatusNoTarget
-	}
-
-	repoFile := filepath.Join(repoDir, f.Source)
-
-	// Check if repo file exists.
-	if _, err := os.Stat(repoFile); os.IsNotExist(err) {
-		return config.StatusMissing
-	}
-
-	// Check if target exists.
-	info, err := os.Lstat(target)
-	if os.IsNotExist(err) {
-		return config.StatusMissing
-	}
-	if err != nil {
-		return config.StatusMissing
-	}
-
-	// Check if it's a symlink pointing to the repo file.
-	if info.Mode()&os.ModeSymlink == 0 {
-		return config.StatusUnlinked
-	}
-
-	if !fileops.IsSymlinkTo(target, repoFile) {
-		return config.StatusUnlinked
-	}
 
-	// Check if repo has uncommitted changes for this file.
-	return config.StatusSynced
+	cmd.Flags().BoolVar(&all, "all", false, "include files whose profiles are not active on this machine")
+	cmd.Flags().StringVar(&sourceName, "source", "", "only list files of this source")
+	return cmd
 }
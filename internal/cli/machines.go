@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/machines"
+	"github.com/spf13/cobra"
+)
+
+func newMachinesCmd() *cobra.Command {
+	var staleAfter time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "machines",
+		Short: "List machines syncing this repo",
+		Long: `List machines syncing this repo.
+
+Every running daemon records a heartbeat under machines/ in the repo. A
+machine is stale when it has not reported for longer than --stale, and
+behind when the commit it last applied is missing changes to managed files.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repoDir := config.RepoDir(configDir)
+			list, err := machines.Load(repoDir)
+			if err != nil {
+				return fmt.Errorf("load machines: %w", err)
+			}
+			if len(list) == 0 {
+				fmt.Println("No machines have reported yet. Heartbeats are written by 'synq daemon'.")
+				return nil
+			}
+
+			self := ""
+			if state, err := config.LoadLocalState(configDir); err == nil {
+				self = state.MachineID
+			}
+			head, _ := gitops.Head(repoDir)
+			now := time.Now()
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "MACHINE\tID\tOS\tVERSION\tLAST SEEN\tLAST SYNC\tSTATUS"); err != nil {
+				return err
+			}
+			for _, hb := range list {
+				host := hb.Hostname
+				if hb.ID == self {
+					host += " (this machine)"
+				}
+				row := []string{
+					host,
+					shortID(hb.ID),
+					hb.OS + "/" + hb.Arch,
+					hb.Version,
+					ago(now, hb.LastSeen),
+					ago(now, hb.LastSync),
+					machineStatus(repoDir, head, hb, now, staleAfter),
+				}
+				if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().DurationVar(&staleAfter, "stale", 24*time.Hour, "flag machines not seen for longer than this")
+	cmd.AddCommand(newMachinesForgetCmd())
+	return cmd
+}
+
+func newMachinesForgetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "forget <id|hostname>",
+		Short: "Remove a retired machine from the registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repoDir := config.RepoDir(configDir)
+			list, err := machines.Load(repoDir)
+			if err != nil {
+				return fmt.Errorf("load machines: %w", err)
+			}
+			hb, err := machines.Find(list, args[0])
+			if err != nil {
+				return err
+			}
+
+			source := machines.Source(hb.ID)
+			if err := os.Remove(filepath.Join(repoDir, filepath.FromSlash(source))); err != nil {
+				return fmt.Errorf("remove heartbeat: %w", err)
+			}
+			if _, err := gitops.CommitPaths(repoDir, fmt.Sprintf("Forget machine %s", hb.Hostname), source); err != nil {
+				return err
+			}
+			if err := gitops.Push(repoDir); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Forgot %s (%s)\n", hb.Hostname, shortID(hb.ID))
+			return nil
+		},
+	}
+}
+
+// machineStatus summarizes the problems of a machine, or "ok".
+func machineStatus(repoDir, head string, hb machines.Heartbeat, now time.Time, staleAfter time.Duration) string {
+	var problems []string
+	if machines.Stale(hb, now, staleAfter) {
+		problems = append(problems, "stale")
+	}
+	if hb.SyncError != "" {
+		problems = append(problems, "sync failing")
+	}
+	if len(hb.Failing) > 0 {
+		problems = append(problems, fmt.Sprintf("%d entries failing", len(hb.Failing)))
+	}
+	switch {
+	case hb.Commit == "" || head == "":
+	case !gitops.IsAncestor(repoDir, hb.Commit, head):
+		problems = append(problems, "unknown commit (pull to compare)")
+	default:
+		paths, err := gitops.ChangedFiles(repoDir, hb.Commit, head)
+		if err != nil {
+			break
+		}
+		for _, p := range paths {
+			if !machines.IsHeartbeat(p) {
+				problems = append(problems, "behind")
+				break
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return "ok"
+	}
+	return strings.Join(problems, ", ")
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// ago formats the time since t for humans.
+func ago(now, t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/merge"
+	"github.com/spf13/cobra"
+)
+
+// newMergeDriverCmd is the merge driver git runs for entries with a merge
+// format. It follows git's contract: the result replaces <ours>, and a
+// non-zero exit leaves a conflict.
+func newMergeDriverCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          merge.DriverCommand + " <format> <base> <ours> <theirs> [<path>]",
+		Short:        "Merge a structured file key by key (run by git)",
+		Hidden:       true,
+		Annotations:  signingOptional,
+		SilenceUsage: true,
+		Args:         cobra.RangeArgs(4, 5),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, basePath, oursPath, theirsPath := args[0], args[1], args[2], args[3]
+			path := oursPath
+			if len(args) == 5 {
+				path = args[4]
+			}
+			read := func(p string) ([]byte, error) {
+				data, err := os.ReadFile(p)
+				if err != nil {
+					return nil, fmt.Errorf("merge %s: %w", path, err)
+				}
+				return data, nil
+			}
+			base, err := read(basePath)
+			if err != nil {
+				return err
+			}
+			ours, err := read(oursPath)
+			if err != nil {
+				return err
+			}
+			theirs, err := read(theirsPath)
+			if err != nil {
+				return err
+			}
+
+			merged, err := merge.Merge(format, base, ours, theirs)
+			if err == nil {
+				return os.WriteFile(oursPath, merged, 0o644)
+			}
+
+			// Leave git's usual conflict markers to resolve by hand.
+			log := logger.Get()
+			var conflict *merge.ConflictError
+			if errors.As(err, &conflict) {
+				log.Warn().Str("path", path).Strs("keys", conflict.Keys).Msg("keys changed on both sides")
+			} else {
+				log.Warn().Err(err).Str("path", path).Msg("cannot merge by key; merging as text")
+			}
+			clean, mergeErr := gitops.MergeFile(oursPath, basePath, theirsPath, path)
+			if mergeErr != nil {
+				return mergeErr
+			}
+			if !clean {
+				return fmt.Errorf("conflict in %s", path)
+			}
+			return nil
+		},
+	}
+}
+
+// installMergeDriver keeps git's merge driver settings in repoDir in step
+// with the entries' merge formats before a pull. Without them, pulls still
+// work but merge as text.
+func installMergeDriver(repoDir string, cfg *config.Config) {
+	binary, err := os.Executable()
+	if err == nil {
+		err = merge.Install(repoDir, cfg.Files, binary)
+	}
+	if err != nil {
+		logger.Get().Warn().Err(err).Msg("configure merge driver")
+	}
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+func newMvCmd() *cobra.Command {
+	var sourceName string
+
+	cmd := &cobra.Command{
+		Use:   "mv <name> <new-source>",
+		Short: "Move a managed file to a new path inside the repo",
+		Long: `Move a managed file to a new path inside the repo.
+
+The local symlink is updated immediately. Other machines relink the
+target to the new source the next time they sync or the daemon pulls.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log := logger.Get()
+			name, newSource := args[0], args[1]
+
+			// 1. Load config, find entry.
+			repo, cfg, err := openRepo(sourceName)
+			if err != nil {
+				return err
+			}
+			if err := writable(repo); err != nil {
+				return err
+			}
+			idx, err := ownEntry(cfg, name)
+			if err != nil {
+				return err
+			}
+			if err := config.ValidateSource(newSource); err != nil {
+				return err
+			}
+
+			entry := cfg.Files[idx]
+			oldSource := entry.Source
+			if oldSource == newSource {
+				fmt.Printf("✓ %s is already stored at %s\n", name, newSource)
+				return nil
+			}
+			if other := cfg.FindSource(newSource); other != -1 {
+				return fmt.Errorf("source %s is already used by %q", newSource, cfg.Files[other].Name)
+			}
+
+			repoDir := repo.Dir
+			oldPath := entry.SourcePath(repoDir)
+			entry.Source = newSource
+			if _, err := os.Lstat(entry.SourcePath(repoDir)); err == nil {
+				return fmt.Errorf("%s already exists in the repo", newSource)
+			}
+
+			// 2. Move the file inside the repo.
+			log.Debug().Str("from", oldSource).Str("to", newSource).Msg("moving source")
+			if err := gitops.Move(repoDir, oldSource, newSource); err != nil {
+				return err
+			}
+			fileops.RemoveEmptyDirs(filepath.Dir(oldPath), repoDir)
+			fmt.Printf("✓ Moved %s -> %s\n", oldSource, newSource)
+
+			// 3. Update config.
+			cfg.Files[idx] = entry
+			if err := config.SaveRepoConfigIn(repoDir, cfg); err != nil {
+				return fmt.Errorf("save repo config: %w", err)
+			}
+
+			// 4. Relink the local target.
+			entry.ActiveOverlays = entry.OverlayKeys(loadState().Profiles)
+			res := apply.Entry(repoDir, entry, applyOptions(repoDir))
+			if res.Err != nil {
+				return fmt.Errorf("relink %s: %w", name, res.Err)
+			}
+			printResults([]apply.Result{res})
+
+			// 5. Commit + push.
+			filter, err := stageFilter(repoDir, cfg)
+			if err != nil {
+				return err
+			}
+			message := fmt.Sprintf("Move %s to %s", name, newSource)
+			if err := gitops.CommitAndPush(repoDir, message, filter); err != nil {
+				return fmt.Errorf("commit and push: %w", err)
+			}
+			record(sourceEvents(repo, events.Event{Type: events.Pushed, Name: name, Message: message})...)
+			fmt.Printf("✓ Committed and pushed\n")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&sourceName, "source", "", "source repo the file belongs to")
+	return cmd
+}
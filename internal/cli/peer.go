@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/peer"
+	"github.com/spf13/cobra"
+)
+
+func newPeerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peer",
+		Short: "Sync directly with machines on the local network",
+		Long: `Sync directly with machines on the local network.
+
+A machine with peer.listen set in its local synq.yaml, such as ":7465",
+serves its repos to trusted peers while the daemon runs, each at
+https://HOST:PORT/SOURCE (the default repo is "default"), so machines
+without a route to the git host can pull through it. Repos are served
+read-only: pushes from peers are refused, so a machine syncing a repo
+from a peer only pulls it. Its local edits are neither committed nor
+pushed, and add, edit, mv and remove refuse to change it; 'synq daemon
+status' lists such repos. Extending a peer's repo as a layer suits such
+machines best.
+
+Connections are authenticated both ways with TLS keys. On each side, add
+the other with the fingerprint 'synq peer status' shows there; on the
+machine that connects, also pass the URL it serves at with --url. A
+machine can then clone with 'synq setup --url URL/default', or use peer
+URLs as the URL of a source. Restart the daemon after changing peers.`,
+	}
+
+	cmd.AddCommand(
+		newPeerStatusCmd(),
+		newPeerAddCmd(),
+		newPeerRemoveCmd(),
+	)
+	return cmd
+}
+
+func newPeerStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show this machine's peer key and its trusted peers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state := loadState()
+			fp, err := peer.EnsureCert(configDir)
+			if err != nil {
+				return fmt.Errorf("peer certificate: %w", err)
+			}
+			fmt.Printf("This machine's peer key: %s\n", fp)
+			if state.Peer.Listen != "" {
+				fmt.Printf("The daemon serves this machine's repos at %s\n", state.Peer.Listen)
+			} else {
+				fmt.Println("Not serving repos to peers; set peer.listen in the local synq.yaml to serve them.")
+			}
+			if len(state.Peer.Peers) == 0 {
+				fmt.Println("\nNo trusted peers. Use 'synq peer add' to trust one.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "\nPEER\tKEY\tURL"); err != nil {
+				return err
+			}
+			for _, name := range sortedKeys(state.Peer.Peers) {
+				p := state.Peer.Peers[name]
+				url := p.URL
+				if url == "" {
+					url = "-"
+				}
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", name, p.Key, url); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newPeerAddCmd() *cobra.Command {
+	var url string
+
+	cmd := &cobra.Command{
+		Use:   "add <name> <key>",
+		Short: "Trust a peer to sync with this machine",
+		Long: `Trust a peer to sync with this machine.
+
+The key is the fingerprint 'synq peer status' shows on the peer. With
+--url, git connects to the peer at that URL, and repos under it can be
+used as remotes.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			key, err := peer.ParseFingerprint(args[1])
+			if err != nil {
+				return err
+			}
+			if url != "" {
+				if !strings.HasPrefix(url, "https://") {
+					return fmt.Errorf("peer URL %q must start with https://", url)
+				}
+				if !strings.HasSuffix(url, "/") {
+					url += "/"
+				}
+			}
+			state := loadState()
+			if state.Peer.Peers == nil {
+				state.Peer.Peers = map[string]config.Peer{}
+			}
+			state.Peer.Peers[name] = config.Peer{Key: key, URL: url}
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			if err := configurePeers(state); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Trusted peer %s\n", name)
+			if url != "" {
+				fmt.Printf("  Repos at %sSOURCE can be used as remotes\n", url)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&url, "url", "", "where the peer serves its repos, such as https://workstation:7465/")
+	return cmd
+}
+
+func newPeerRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Stop trusting a peer",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state := loadState()
+			if _, ok := state.Peer.Peers[args[0]]; !ok {
+				return fmt.Errorf("peer %s is not trusted", args[0])
+			}
+			delete(state.Peer.Peers, args[0])
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			fmt.Printf("✓ Stopped trusting peer %s\n", args[0])
+			return nil
+		},
+	}
+}
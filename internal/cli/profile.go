@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/spf13/cobra"
+)
+
+func newProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Choose which groups of files apply on this machine",
+		Long: `Choose which groups of files apply on this machine.
+
+Entries and scripts can list profiles in synq.yaml. They only apply on
+machines where one of their profiles is active; entries without profiles
+apply everywhere. Active profiles are stored in the local state.`,
+	}
+
+	cmd.AddCommand(
+		newProfileListCmd(),
+		newProfileEnableCmd(),
+		newProfileDisableCmd(),
+	)
+	return cmd
+}
+
+func newProfileListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List profiles and whether they are active",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+
+			profiles := cfg.Profiles()
+			for _, p := range state.Profiles {
+				if !slices.Contains(profiles, p) {
+					profiles = append(profiles, p)
+				}
+			}
+			if len(profiles) == 0 {
+				fmt.Println("No profiles defined. Use 'synq add --profile <name>' or add profiles: to entries in synq.yaml.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "PROFILE\tACTIVE\tFILES\tSCRIPTS"); err != nil {
+				return err
+			}
+			for _, p := range profiles {
+				files, scripts := 0, 0
+				for _, f := range cfg.Files {
+					if slices.Contains(f.Profiles, p) {
+						files++
+					}
+				}
+				for _, s := range cfg.Scripts {
+					if slices.Contains(s.Profiles, p) {
+						scripts++
+					}
+				}
+				active := yesNo(slices.Contains(state.Profiles, p))
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", p, active, files, scripts); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newProfileEnableCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "enable <profile>...",
+		Short: "Activate profiles and apply their files",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, cfg, before, err := loadProfiles()
+			if err != nil {
+				return err
+			}
+
+			known := cfg.Profiles()
+			for _, p := range args {
+				if !slices.Contains(known, p) {
+					fmt.Printf("⚠ No entries or scripts use profile %s yet\n", p)
+				}
+				if !slices.Contains(state.Profiles, p) {
+					state.Profiles = append(state.Profiles, p)
+				}
+			}
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			fmt.Printf("✓ Active profiles: %s\n", profileList(state.Profiles))
+
+			// Apply the entries that just became active or whose overlays
+			// changed.
+			repoDir := config.RepoDir(configDir)
+			printResults(apply.Entries(repoDir, changedFiles(before, cfg.ActiveFiles(state.Profiles), true), applyOptions(repoDir)))
+			return nil
+		},
+	}
+}
+
+func newProfileDisableCmd() *cobra.Command {
+	var purge bool
+
+	cmd := &cobra.Command{
+		Use:   "disable <profile>...",
+		Short: "Deactivate profiles and detach their files",
+		Long: `Deactivate profiles and detach their files.
+
+Links to entries that no longer apply are replaced by a plain copy of the
+file, like synq remove does, unless --purge is given. Copied targets are
+left alone. Entries that stay active are applied again without the
+profiles' overlays.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, cfg, before, err := loadProfiles()
+			if err != nil {
+				return err
+			}
+
+			for _, p := range args {
+				i := slices.Index(state.Profiles, p)
+				if i == -1 {
+					return fmt.Errorf("profile %q is not active", p)
+				}
+				state.Profiles = slices.Delete(state.Profiles, i, i+1)
+			}
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			fmt.Printf("✓ Active profiles: %s\n", profileList(state.Profiles))
+
+			repoDir := config.RepoDir(configDir)
+			for _, f := range before {
+				if config.InProfiles(f.Profiles, state.Profiles) {
+					continue
+				}
+				if err := detach(repoDir, f, purge); err != nil {
+					return err
+				}
+			}
+			if changed := changedFiles(before, cfg.ActiveFiles(state.Profiles), false); len(changed) > 0 {
+				printResults(apply.Entries(repoDir, changed, applyOptions(repoDir)))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&purge, "purge", false, "delete links to detached files instead of leaving a copy")
+	return cmd
+}
+
+// detach replaces the link to an entry that no longer applies with a copy
+// of the file, or removes it if purge is set. A block loses its markers, or
+// is removed with purge. Other targets that are not links into repoDir are
+// left alone.
+func detach(repoDir string, f config.FileEntry, purge bool) error {
+	target, ok := fileops.ResolveTarget(f.Targets)
+	if ok && f.ApplyMethod() == config.MethodBlock {
+		removed, err := f.Block().Remove(target, !purge)
+		if err != nil {
+			return fmt.Errorf("detach %s: %w", f.Name, err)
+		}
+		if removed && purge {
+			fmt.Printf("✓ Removed block %s from %s\n", f.Name, fileops.TildePath(target))
+		} else if removed {
+			fmt.Printf("✓ Detached %s; left its content in %s\n", f.Name, fileops.TildePath(target))
+		}
+		return nil
+	}
+	if !ok || !fileops.IsSymlinkTo(target, f.SourcePath(repoDir)) {
+		return nil
+	}
+	if purge {
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("remove %s: %w", fileops.TildePath(target), err)
+		}
+		fmt.Printf("✓ Removed %s\n", fileops.TildePath(target))
+		return nil
+	}
+	if err := fileops.RemoveSymlink(target, f.SourcePath(repoDir)); err != nil {
+		return fmt.Errorf("detach %s: %w", f.Name, err)
+	}
+	fmt.Printf("✓ Detached %s; left a copy at %s\n", f.Name, fileops.TildePath(target))
+	return nil
+}
+
+// loadProfiles loads the local state, the repo config and the entries that
+// are active before a profile change.
+func loadProfiles() (*config.LocalState, *config.Config, []config.FileEntry, error) {
+	state, err := config.LoadLocalState(configDir)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("load local state: %w", err)
+	}
+	cfg, err := config.LoadRepoConfig(configDir)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("load repo config: %w", err)
+	}
+	return state, cfg, cfg.ActiveFiles(state.Profiles), nil
+}
+
+// changedFiles returns the entries of after whose overlays differ from
+// before, and with added set those missing from before.
+func changedFiles(before, after []config.FileEntry, added bool) []config.FileEntry {
+	var changed []config.FileEntry
+	for _, f := range after {
+		i := slices.IndexFunc(before, func(b config.FileEntry) bool { return b.Name == f.Name })
+		if (i == -1 && added) || (i != -1 && !slices.Equal(before[i].ActiveOverlays, f.ActiveOverlays)) {
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+func profileList(profiles []string) string {
+	if len(profiles) == 0 {
+		return "(none)"
+	}
+	return strings.Join(profiles, ", ")
+}
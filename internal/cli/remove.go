@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
 	"github.com/ihavespoons/synq/internal/fileops"
 	"github.com/ihavespoons/synq/internal/gitops"
 	"github.com/ihavespoons/synq/internal/logger"
@@ -13,7 +14,9 @@ import (
 )
 
 func newRemoveCmd() *cobra.Command {
-	return &cobra.Command{
+	var sourceName string
+
+	cmd := &cobra.Command{
 		Use:   "remove <name>",
 		Short: "Remove a file from synq management",
 		Args:  cobra.ExactArgs(1),
@@ -22,29 +25,32 @@ func newRemoveCmd() *cobra.Command {
 			name := args[0]
 
 			// 1. Load config, find entry.
-			cfg, err := config.LoadRepoConfig(configDir)
+			repo, cfg, err := openRepo(sourceName)
 			if err != nil {
-				return fmt.Errorf("load repo config: %w", err)
+				return err
 			}
-
-			idx := -1
-			for i, f := range cfg.Files {
-				if f.Name == name {
-					idx = i
-					break
-				}
+			if err := writable(repo); err != nil {
+				return err
 			}
-			if idx == -1 {
-				return fmt.Errorf("file %q not found in synq config", name)
+
+			idx, err := ownEntry(cfg, name)
+			if err != nil {
+				return err
 			}
 
 			entry := cfg.Files[idx]
-			repoDir := config.RepoDir(configDir)
-			repoFilePath := filepath.Join(repoDir, entry.Source)
+			repoDir := repo.Dir
+			repoFilePath := entry.SourcePath(repoDir)
 
-			// 2. Restore original file from symlink.
+			// 2. Restore original file from symlink. A block keeps its
+			// content in the target but loses its markers.
 			targetPath, hasTarget := fileops.ResolveTarget(entry.Targets)
-			if hasTarget {
+			if hasTarget && entry.ApplyMethod() == config.MethodBlock {
+				if _, err := entry.Block().Remove(targetPath, true); err != nil {
+					return fmt.Errorf("restore file: %w", err)
+				}
+				fmt.Printf("✓ Removed the markers of %s from %s\n", name, fileops.TildePath(targetPath))
+			} else if hasTarget {
 				log.Debug().Str("target", targetPath).Msg("restoring original file")
 				if err := fileops.RemoveSymlink(targetPath, repoFilePath); err != nil {
 					return fmt.Errorf("restore file: %w", err)
@@ -53,23 +59,36 @@ func newRemoveCmd() *cobra.Command {
 			}
 
 			// 3. Delete file from repo.
-			if err := os.Remove(repoFilePath); err != nil && !os.IsNotExist(err) {
+			if err := config.ValidateSource(entry.Source); err != nil {
+				return err
+			}
+			if err := os.RemoveAll(repoFilePath); err != nil {
 				return fmt.Errorf("remove repo file: %w", err)
 			}
+			fileops.RemoveEmptyDirs(filepath.Dir(repoFilePath), repoDir)
 
 			// 4. Remove entry from config.
 			cfg.Files = append(cfg.Files[:idx], cfg.Files[idx+1:]...)
-			if err := config.SaveRepoConfig(configDir, cfg); err != nil {
+			if err := config.SaveRepoConfigIn(repoDir, cfg); err != nil {
 				return fmt.Errorf("save repo config: %w", err)
 			}
 
 			// 5. Commit + push.
-			if err := gitops.CommitAndPush(repoDir, fmt.Sprintf("Remove %s", name)); err != nil {
+			filter, err := stageFilter(repoDir, cfg)
+			if err != nil {
+				return err
+			}
+			message := fmt.Sprintf("Remove %s", name)
+			if err := gitops.CommitAndPush(repoDir, message, filter); err != nil {
 				return fmt.Errorf("commit and push: %w", err)
 			}
+			record(sourceEvents(repo, events.Event{Type: events.Pushed, Name: name, Message: message})...)
 			fmt.Printf("✓ Removed %s from synq\n", name)
 
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&sourceName, "source", "", "source repo the file belongs to")
+	return cmd
 }
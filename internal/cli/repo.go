@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/hooks"
+	"github.com/ihavespoons/synq/internal/ignore"
+	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/peer"
+	"github.com/ihavespoons/synq/internal/trust"
+)
+
+// stageFilter returns the filter that keeps ignored paths out of commits.
+func stageFilter(repoDir string, cfg *config.Config) (gitops.Filter, error) {
+	m, err := ignore.ForRepo(repoDir, cfg.Files)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", ignore.FileName, err)
+	}
+	return m.Ignored, nil
+}
+
+// hookRunner returns the hook runner for this machine. Without local state
+// hooks stay disabled.
+func hookRunner(repoDir string) *hooks.Runner {
+	return hooks.NewRunner(loadState(), repoDir)
+}
+
+// applyOptions returns the options for applying entries from repoDir: its
+// hooks, and what was last applied so that local edits are kept.
+func applyOptions(repoDir string) apply.Options {
+	return apply.Options{Hooks: hookRunner(repoDir), State: applyState()}
+}
+
+// applyState loads what was last applied to targets. Without it, targets
+// are applied without checking them for local edits.
+func applyState() *apply.State {
+	st, err := apply.LoadState(configDir)
+	if err != nil {
+		logger.Get().Warn().Err(err).Msg("load apply state")
+		return nil
+	}
+	return st
+}
+
+// configurePeers makes git authenticate to the peers this machine syncs
+// from, so that their URLs work as remotes.
+func configurePeers(state *config.LocalState) error {
+	pins := map[string]string{}
+	for _, p := range state.Peer.Peers {
+		if p.URL != "" {
+			pins[p.URL] = p.Key
+		}
+	}
+	if len(pins) == 0 {
+		gitops.SetPeers(gitops.Peers{})
+		return nil
+	}
+	if _, err := peer.EnsureCert(configDir); err != nil {
+		return fmt.Errorf("peer certificate: %w", err)
+	}
+	cert, key := peer.Paths(configDir)
+	gitops.SetPeers(gitops.Peers{Cert: cert, Key: key, Pins: pins})
+	return nil
+}
+
+// configureSigning makes git sign the commits synq makes, and check pulled
+// ones, as the state's signing and trust settings say.
+func configureSigning(state *config.LocalState) error {
+	s := state.Signing
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	g := gitops.Signing{Verify: s.Verify, Key: s.Key}
+	switch s.Format {
+	case config.SignSSH:
+		g.Format = "ssh"
+		if s.Key != "" {
+			g.Key = fileops.ExpandPath(s.Key)
+		}
+	case config.SignGPG:
+		g.Format = "openpgp"
+	}
+	if s.AllowedSigners != "" {
+		g.AllowedSigners = fileops.ExpandPath(s.AllowedSigners)
+	}
+	if state.Trust.Enabled {
+		if s.Format == config.SignGPG {
+			return fmt.Errorf("trust needs SSH signing, since machines publish SSH keys")
+		}
+		if _, err := trust.EnsureKey(configDir, state); err != nil {
+			return fmt.Errorf("machine key: %w", err)
+		}
+		signers, err := trust.WriteSigners(configDir, state.Trust.Machines, g.AllowedSigners)
+		if err != nil {
+			return err
+		}
+		g.Format, g.Key = "ssh", trust.KeyPath(configDir, state)
+		g.Verify, g.AllowedSigners = true, signers
+	}
+	gitops.SetSigning(g)
+	return nil
+}
+
+// loadState returns the local state, or an empty state before setup so
+// commands on the default repo keep working.
+func loadState() *config.LocalState {
+	state, err := config.LoadLocalState(configDir)
+	if err != nil {
+		return &config.LocalState{}
+	}
+	return state
+}
+
+// openRepo returns the repo named by --source ("" is the default repo) and
+// its config.
+func openRepo(name string) (config.Repo, *config.Config, error) {
+	repo, err := loadState().Repo(configDir, name)
+	if err != nil {
+		return config.Repo{}, nil, err
+	}
+	cfg, err := config.LoadRepoConfigIn(repo.Dir)
+	if err != nil {
+		return config.Repo{}, nil, fmt.Errorf("load %s config: %w", repo.Name, err)
+	}
+	return repo, cfg, nil
+}
+
+// writable refuses changes to a repo pulled from a peer, which serves it
+// read-only.
+func writable(repo config.Repo) error {
+	if repo.Peer != "" {
+		return fmt.Errorf("source %s is pulled from peer %s, which serves it read-only; change it on that machine", repo.Name, repo.Peer)
+	}
+	return nil
+}
+
+// ownEntry returns the index of the named entry in cfg. Entries merged from
+// an include are refused, since synq.yaml does not hold them.
+func ownEntry(cfg *config.Config, name string) (int, error) {
+	idx := cfg.FindFile(name)
+	if idx == -1 && len(cfg.Extends) > 0 {
+		return -1, fmt.Errorf("file %q not found in synq config; entries from extended layers are read-only, override them with 'synq add'", name)
+	}
+	if idx == -1 {
+		return -1, fmt.Errorf("file %q not found in synq config", name)
+	}
+	if inc := cfg.Files[idx].Include; inc != "" {
+		return -1, fmt.Errorf("%q is defined in %s; edit it there", name, inc)
+	}
+	return idx, nil
+}
+
+// activeFiles returns the entries of repo enabled by this machine's
+// profiles, leaving out and reporting those whose target an earlier repo
+// claims.
+func activeFiles(repo config.Repo, cfg *config.Config) []config.FileEntry {
+	files, shadowed, err := config.RepoFiles(configDir, loadState(), repo.Name, cfg)
+	if err != nil {
+		logger.Get().Warn().Err(err).Msg("check targets claimed by other sources")
+	}
+	for _, name := range sortedKeys(shadowed) {
+		c := shadowed[name]
+		fmt.Printf("⚠ Skipping %s from %s: its target is managed by %s from %s\n", name, repo.Name, c.Name, c.Repo)
+	}
+	return files
+}
+
+// targetOwner returns the entry of any repo other than skip that manages
+// key on this OS, as returned by FileEntry.TargetKey.
+func targetOwner(key, skip string) (config.Claim, bool) {
+	state := loadState()
+	for _, r := range state.Repos(configDir) {
+		if r.Name == skip {
+			continue
+		}
+		cfg, err := config.LoadRepoConfigIn(r.Dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range cfg.Files {
+			if k, ok := f.TargetKey(); ok && k == key {
+				return config.Claim{Repo: r.Name, Name: f.Name}, true
+			}
+		}
+	}
+	return config.Claim{}, false
+}
+
+// sourceEvents tags events with the named source they concern.
+func sourceEvents(repo config.Repo, list ...events.Event) []events.Event {
+	if repo.Name == config.DefaultSource {
+		return list
+	}
+	for i := range list {
+		list[i] = list[i].WithSource(repo.Name)
+	}
+	return list
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// record appends events to the journal. The journal is best effort, so a
+// failure to write it never fails the command.
+func record(list ...events.Event) {
+	if err := events.Record(configDir, list...); err != nil {
+		logger.Get().Warn().Err(err).Msg("record events")
+	}
+}
@@ -0,0 +1,466 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/spf13/cobra"
+)
+
+func newReviewCmd() *cobra.Command {
+	var source string
+
+	cmd := &cobra.Command{
+		Use:   "review",
+		Short: "Sync, reviewing each incoming change before it is applied",
+		Long: `Sync, reviewing each incoming change before it is applied.
+
+This is synq sync --interactive. Remote changes are fetched first. Each
+symlinked file whose source they change is shown as a diff of the incoming
+commits before they are pulled, since pulling rewrites the file the target
+links to. Once pulled, every other entry whose target would change is shown
+as a diff of the target before and after. For each, you choose what to do:
+
+  accept      apply the change (overwriting local edits, with a backup)
+  skip        leave the target as it is for now; a skipped symlink is
+              replaced by a copy of its current contents
+  keep local  make the repo take this machine's version and push it
+  edit        edit the incoming version first; your version is kept
+
+Entries of read-only layers can only be accepted or skipped, and symlinked
+directories and the symlinked entries of layers take their changes when
+they are pulled. A running daemon keeps applying changes on its own; stop
+it first to review them all.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSync(source, syncOptions{review: newReviewer(os.Stdin)})
+		},
+	}
+
+	cmd.Flags().StringVar(&source, "source", "", "only sync this source")
+	return cmd
+}
+
+// reviewer asks what to do with each incoming change.
+type reviewer struct {
+	in    *bufio.Reader
+	color bool
+	// quit is set once the rest of the changes are to be skipped.
+	quit bool
+	// skipped holds the names of symlinked entries skipped before pulling,
+	// which are not asked about again.
+	skipped map[string]bool
+}
+
+func newReviewer(in io.Reader) *reviewer {
+	return &reviewer{in: bufio.NewReader(in), color: useColor()}
+}
+
+// useColor reports whether stdout is a terminal that wants colors.
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// apply applies files from repoDir, asking about each entry whose target
+// would change first. kept reports whether the repo took a local version,
+// which then needs pushing. A nil reviewer applies everything.
+func (r *reviewer) apply(repoDir string, files []config.FileEntry, opts apply.Options, readOnly bool) (results []apply.Result, kept bool) {
+	if r == nil {
+		return apply.Entries(repoDir, files, opts), false
+	}
+	for _, f := range files {
+		if r.skipped[f.Name] {
+			continue
+		}
+		if !apply.Pending(repoDir, f) {
+			results = append(results, apply.Entry(repoDir, f, opts))
+			continue
+		}
+		res, keptLocal := r.review(repoDir, f, opts, readOnly)
+		if res != nil {
+			results = append(results, *res)
+		}
+		kept = kept || keptLocal
+	}
+	return results, kept
+}
+
+// linkedChange is a reviewed change to a symlinked entry, carried out
+// once it is pulled.
+type linkedChange struct {
+	f        config.FileEntry
+	target   string
+	repoFile string
+	answer   string
+	// now is what the target held before pulling; edited holds the user's
+	// edits of the incoming version.
+	now, edited []byte
+	mode        os.FileMode
+}
+
+// pull pulls remote changes into repoDir like gitops.Pull, first asking
+// about the incoming changes to the symlinked files among files: their
+// targets are the repo files, so rebasing applies the changes at once.
+// Skipped entries then have their links replaced by copies of what they
+// held, and the versions kept or edited are written back into the repo,
+// which kept reports then needs committing and pushing. readOnly changes
+// can only be accepted or skipped. A nil reviewer just pulls.
+func (r *reviewer) pull(repoDir string, files []config.FileEntry, readOnly bool) (changed, kept bool, err error) {
+	if r == nil {
+		changed, err = gitops.Pull(repoDir)
+		return changed, false, err
+	}
+	upstream, err := gitops.Fetch(repoDir)
+	if err != nil {
+		return false, false, err
+	}
+	before, err := gitops.Head(repoDir)
+	if err != nil {
+		return false, false, err
+	}
+	if gitops.IsAncestor(repoDir, upstream, before) {
+		return false, false, nil
+	}
+	base, err := gitops.MergeBase(repoDir, before, upstream)
+	if err != nil {
+		return false, false, err
+	}
+	paths, err := gitops.ChangedFiles(repoDir, base, upstream)
+	if err != nil {
+		return false, false, err
+	}
+	touched := apply.ChangedFunc(paths)
+
+	var decided []linkedChange
+	for _, f := range files {
+		if f.ApplyMethod() != config.MethodSymlink || !touched(f.Source) {
+			continue
+		}
+		target, ok := fileops.ResolveTarget(f.Targets)
+		repoFile := f.SourcePath(repoDir)
+		info, err := os.Stat(repoFile)
+		if !ok || err != nil || !info.Mode().IsRegular() || !fileops.IsSymlinkTo(target, repoFile) {
+			continue
+		}
+		after, ok, err := gitops.Show(repoDir, upstream, f.Source)
+		if err != nil || !ok {
+			continue
+		}
+		old, _, err := gitops.Show(repoDir, base, f.Source)
+		if err != nil {
+			continue
+		}
+		now, err := os.ReadFile(repoFile)
+		if err != nil {
+			return false, false, err
+		}
+		c := linkedChange{f: f, target: target, repoFile: repoFile, answer: "s", now: now, mode: info.Mode().Perm()}
+		if !r.quit {
+			c.answer, c.edited = r.decide(f, target, change{before: old, after: after, labelBefore: "before", labelAfter: "incoming"}, readOnly)
+		}
+		decided = append(decided, c)
+	}
+
+	if err := gitops.PullTo(repoDir, upstream); err != nil {
+		return false, false, err
+	}
+	for _, c := range decided {
+		switch {
+		case c.answer == "a" && c.edited != nil:
+			err = os.WriteFile(c.repoFile, c.edited, c.mode)
+			kept = true
+		case c.answer == "k":
+			err = os.WriteFile(c.repoFile, c.now, c.mode)
+			kept = true
+		case c.answer == "s", c.answer == "q":
+			// Keep the target's contents without taking them into the
+			// repo; the next review shows the change again.
+			if err = os.Remove(c.target); err == nil {
+				err = os.WriteFile(c.target, c.now, c.mode)
+			}
+			if r.skipped == nil {
+				r.skipped = map[string]bool{}
+			}
+			r.skipped[c.f.Name] = true
+		}
+		if err != nil {
+			return true, kept, fmt.Errorf("%s: %w", c.f.Name, err)
+		}
+	}
+	return true, kept, nil
+}
+
+// review shows the incoming change to one entry and carries out the
+// decision. It returns nil when the entry is skipped.
+func (r *reviewer) review(repoDir string, f config.FileEntry, opts apply.Options, readOnly bool) (*apply.Result, bool) {
+	if r.quit {
+		return nil, false
+	}
+	target, _ := fileops.ResolveTarget(f.Targets)
+	before, after, isDir, err := incoming(repoDir, f)
+	if err != nil {
+		res := apply.Entry(repoDir, f, opts)
+		return &res, false
+	}
+
+	answer, edited := r.decide(f, target, change{before: before, after: after, isDir: isDir}, readOnly)
+	switch {
+	case answer == "a" && edited != nil:
+		// Apply the change, then put the edits on top and keep them.
+		opts.Force = true
+		res := apply.Entry(repoDir, f, opts)
+		if res.Err != nil {
+			return &res, false
+		}
+		if err := writeTarget(f, target, edited); err != nil {
+			res = apply.Result{Name: f.Name, Target: target, Action: apply.ActionFailed, Err: err}
+			return &res, false
+		}
+		res = apply.Keep(repoDir, f, opts.State)
+		return &res, res.Err == nil
+	case answer == "a":
+		opts.Force = true
+		res := apply.Entry(repoDir, f, opts)
+		return &res, false
+	case answer == "k":
+		res := apply.Keep(repoDir, f, opts.State)
+		return &res, res.Err == nil
+	}
+	return nil, false
+}
+
+// change is an incoming change to one entry, as shown for review.
+type change struct {
+	before, after []byte
+	// labels name before and after in the diff; "now" and "after sync"
+	// when empty.
+	labelBefore, labelAfter string
+	// isDir is set for directory sources, which are not compared.
+	isDir bool
+}
+
+// decide shows c, the incoming change to f, and asks what to do with it
+// until the answer is one of "a" (accept), "s" (skip), "k" (keep local) or
+// "q" (quit, which also sets r.quit). edited holds the user's edits of the
+// incoming version when it was accepted after editing it. readOnly entries
+// can only be accepted or skipped.
+func (r *reviewer) decide(f config.FileEntry, target string, c change, readOnly bool) (answer string, edited []byte) {
+	labelBefore, labelAfter := c.labelBefore, c.labelAfter
+	if labelBefore == "" {
+		labelBefore, labelAfter = "now", "after sync"
+	}
+	for {
+		fmt.Printf("\n%s (%s)\n", r.bold(f.Name), fileops.TildePath(target))
+		switch {
+		case c.isDir:
+			fmt.Println("  directory source; no diff shown")
+		case edited != nil:
+			showDiff(c.before, edited, labelBefore, "after your edits", r.color)
+		default:
+			showDiff(c.before, c.after, labelBefore, labelAfter, r.color)
+		}
+
+		choices := "[a]ccept, [s]kip, [k]eep local, [e]dit, [q]uit"
+		if readOnly || c.isDir {
+			choices = "[a]ccept, [s]kip, [q]uit"
+		}
+		answer, err := r.ask(choices + "? ")
+		if err != nil {
+			r.quit = true
+			return "q", nil
+		}
+		switch {
+		case answer == "a":
+			return answer, edited
+		case answer == "s":
+			fmt.Printf("  skipped %s\n", f.Name)
+			return answer, nil
+		case answer == "q":
+			r.quit = true
+			return answer, nil
+		case answer == "k" && !readOnly && !c.isDir:
+			return answer, nil
+		case answer == "e" && !readOnly && !c.isDir:
+			start := c.after
+			if edited != nil {
+				start = edited
+			}
+			out, err := editContent(filepath.Base(target), start)
+			if err != nil {
+				fmt.Printf("✗ %v\n", err)
+				continue
+			}
+			edited = out
+		default:
+			fmt.Println("  please answer with one of the letters in brackets")
+		}
+	}
+}
+
+// ask prompts for a one-letter answer. Reading fails at the end of input.
+func (r *reviewer) ask(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		return "", err
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	if answer != "" {
+		answer = answer[:1]
+	}
+	return answer, nil
+}
+
+// incoming returns what f's target holds and what applying f would put
+// there. isDir is set for directory sources, which are not compared.
+func incoming(repoDir string, f config.FileEntry) (before, after []byte, isDir bool, err error) {
+	c, ok, err := apply.ReadContents(repoDir, f)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if ok {
+		return c.Target, c.Source, false, nil
+	}
+
+	// A symlink: the target becomes the source.
+	repoFile := f.SourcePath(repoDir)
+	info, err := os.Stat(repoFile)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if info.IsDir() {
+		return nil, nil, true, nil
+	}
+	if after, err = os.ReadFile(repoFile); err != nil {
+		return nil, nil, false, err
+	}
+	target, _ := fileops.ResolveTarget(f.Targets)
+	if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() {
+		if before, err = os.ReadFile(target); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	return before, after, false, nil
+}
+
+// writeTarget writes content into f's target: the whole file, or its block.
+func writeTarget(f config.FileEntry, target string, content []byte) error {
+	if f.ApplyMethod() == config.MethodBlock {
+		_, err := f.Block().Write(target, content)
+		return err
+	}
+	return os.WriteFile(target, content, 0o644)
+}
+
+// editContent opens content in the user's editor and returns the result.
+// name is used for the file, so editors can pick a syntax.
+func editContent(name string, content []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "synq-edit-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return nil, err
+	}
+	if err := runEditor(path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, waiting for it to exit.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", editor, err)
+	}
+	return nil
+}
+
+// showDiff prints a diff from a to b, colored if color is set.
+func showDiff(a, b []byte, labelA, labelB string, color bool) {
+	dir, err := os.MkdirTemp("", "synq-review-")
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	fileA, fileB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := os.WriteFile(fileA, a, 0o600); err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	if err := os.WriteFile(fileB, b, 0o600); err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	out, err := gitops.DiffFiles(fileA, fileB, labelA, labelB)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	if out == "" {
+		fmt.Println("  no content changes")
+		return
+	}
+	for _, line := range strings.SplitAfter(out, "\n") {
+		fmt.Print(colorLine(line, color))
+	}
+}
+
+func colorLine(line string, color bool) string {
+	if !color || line == "" {
+		return line
+	}
+	code := ""
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		code = "1"
+	case strings.HasPrefix(line, "+"):
+		code = "32"
+	case strings.HasPrefix(line, "-"):
+		code = "31"
+	case strings.HasPrefix(line, "@@"):
+		code = "36"
+	default:
+		return line
+	}
+	text := strings.TrimSuffix(line, "\n")
+	return "\x1b[" + code + "m" + text + "\x1b[0m" + line[len(text):]
+}
+
+func (r *reviewer) bold(s string) string {
+	if !r.color {
+		return s
+	}
+	return "\x1b[1m" + s + "\x1b[0m"
+}
@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"fmt"
+
 	"github.com/ihavespoons/synq/internal/config"
 	"github.com/ihavespoons/synq/internal/logger"
 	"github.com/spf13/cobra"
@@ -11,13 +13,29 @@ var (
 	configDir string
 )
 
+// signingOptional annotates commands that still run, with a warning, when
+// signing cannot be set up: those that change its settings, and the merge
+// driver, which git runs in the middle of a rebase. Other commands fail.
+var signingOptional = map[string]string{"synq.signing": "optional"}
+
 func newRootCmd(version string) *cobra.Command {
 	root := &cobra.Command{
 		Use:     "synq",
 		Short:   "Sync configuration files across machines via GitHub",
 		Version: version,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			logger.Init(verbose)
+			state := loadState()
+			if err := configureSigning(state); err != nil {
+				if cmd.Annotations["synq.signing"] != "optional" {
+					return fmt.Errorf("local state: %w", err)
+				}
+				logger.Get().Warn().Err(err).Msg("signing is not set up")
+			}
+			if err := configurePeers(state); err != nil {
+				return fmt.Errorf("local state: %w", err)
+			}
+			return nil
 		},
 	}
 
@@ -28,9 +46,24 @@ func newRootCmd(version string) *cobra.Command {
 		newSetupCmd(),
 		newAddCmd(),
 		newRemoveCmd(),
+		newMvCmd(),
+		newEditCmd(),
 		newListCmd(),
 		newSyncCmd(),
+		newDiffCmd(),
+		newReviewCmd(),
+		newHooksCmd(),
+		newScriptsCmd(),
+		newProfileCmd(),
+		newSourceCmd(),
+		newConfigCmd(),
+		newMachinesCmd(),
+		newTrustCmd(),
+		newPeerCmd(),
+		newEventsCmd(),
 		newDaemonCmd(),
+		newServiceCmd(),
+		newMergeDriverCmd(),
 	)
 
 	return root
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
+	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/scripts"
+	"github.com/spf13/cobra"
+)
+
+func newScriptsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scripts",
+		Short: "Inspect, trust and run provisioning scripts",
+		Long: `Inspect, trust and run provisioning scripts.
+
+Scripts are declared under scripts: in synq.yaml and run by synq sync and
+synq setup. A script only runs once its current content has been trusted
+on this machine; editing a script requires trusting it again.`,
+	}
+
+	cmd.AddCommand(
+		newScriptsStatusCmd(),
+		newScriptsTrustCmd(),
+		newScriptsRunCmd(),
+	)
+	return cmd
+}
+
+func newScriptsStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show which scripts have run on this machine",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+			if len(cfg.Scripts) == 0 {
+				fmt.Println("No scripts defined in synq.yaml.")
+				return nil
+			}
+			runState, err := scripts.LoadState(configDir)
+			if err != nil {
+				return fmt.Errorf("load script state: %w", err)
+			}
+
+			repoDir := config.RepoDir(configDir)
+			hostname, _ := os.Hostname()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "NAME\tRUN\tSTATUS\tTRUSTED\tLAST RUN"); err != nil {
+				return err
+			}
+			for _, s := range cfg.Scripts {
+				rec := runState[s.Name]
+				status, trusted := "", "-"
+				switch hash, err := scripts.Hash(repoDir, s); {
+				case s.Validate() != nil:
+					status = "invalid"
+				case !scripts.Applies(s, hostname, state.Profiles):
+					status = "not for this machine"
+				case err != nil:
+					status = "missing"
+				default:
+					trusted = yesNo(state.Scripts.Trusted[s.Name] == hash)
+					status = "done"
+					if rec != nil && rec.Error != "" {
+						status = "failed"
+					} else if scripts.Pending(s, hash, rec) {
+						status = "pending"
+					}
+				}
+				lastRun := "never"
+				if rec != nil && !rec.LastRun.IsZero() {
+					lastRun = rec.LastRun.Local().Format("2006-01-02 15:04")
+				}
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Run, status, trusted, lastRun); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newScriptsTrustCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "trust [name...]",
+		Short: "Review and trust the current content of scripts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all && len(args) == 0 {
+				return fmt.Errorf("name a script or pass --all")
+			}
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+
+			selected := cfg.Scripts
+			if !all {
+				selected = nil
+				for _, name := range args {
+					found := false
+					for _, s := range cfg.Scripts {
+						if s.Name == name {
+							selected = append(selected, s)
+							found = true
+						}
+					}
+					if !found {
+						return fmt.Errorf("script %q not found in synq config", name)
+					}
+				}
+			}
+
+			repoDir := config.RepoDir(configDir)
+			if state.Scripts.Trusted == nil {
+				state.Scripts.Trusted = map[string]string{}
+			}
+			for _, s := range selected {
+				if err := s.Validate(); err != nil {
+					return err
+				}
+				hash, err := scripts.Hash(repoDir, s)
+				if err != nil {
+					return fmt.Errorf("read script %q: %w", s.Name, err)
+				}
+				fmt.Printf("── %s (run %s) ──\n", s.Name, s.Run)
+				if s.Source != "" {
+					data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(s.Source)))
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(data))
+				} else {
+					fmt.Println(s.Command)
+				}
+				state.Scripts.Trusted[s.Name] = hash
+				fmt.Printf("✓ Trusted %s\n", s.Name)
+			}
+
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "trust every script")
+	return cmd
+}
+
+func newScriptsRunCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run",
+		Short: "Run pending scripts now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+			return runScripts(config.RepoDir(configDir), cfg)
+		},
+	}
+}
+
+// runScripts runs pending scripts and reports the outcome. It returns an
+// error if any script failed.
+func runScripts(repoDir string, cfg *config.Config) error {
+	if len(cfg.Scripts) == 0 {
+		return nil
+	}
+	log := logger.Get()
+	state, err := config.LoadLocalState(configDir)
+	if err != nil {
+		state = &config.LocalState{}
+	}
+
+	results, err := scripts.NewRunner(configDir, repoDir, state).RunPending(cfg.Scripts)
+	failed := 0
+	for _, res := range results {
+		e := events.Event{Type: events.Script, Name: res.Name}
+		switch {
+		case res.Skipped != "":
+			e.Message = "skipped: " + res.Skipped
+			fmt.Printf("⚠ Skipped script %s: %s\n", res.Name, res.Skipped)
+		case res.Err != nil:
+			failed++
+			e.Message = "failed: " + res.Err.Error()
+			fmt.Printf("✗ Script %s failed: %v\n", res.Name, res.Err)
+			if res.Output != "" {
+				fmt.Println(res.Output)
+			}
+		default:
+			e.Message = "ran in " + res.Duration.Round(time.Millisecond).String()
+			fmt.Printf("✓ Ran script %s (%s)\n", res.Name, res.Duration.Round(time.Millisecond))
+			if res.Output != "" {
+				log.Debug().Str("script", res.Name).Msg(res.Output)
+			}
+		}
+		record(e)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d script(s) failed", failed)
+	}
+	return nil
+}
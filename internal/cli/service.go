@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/daemon"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/spf13/cobra"
+)
+
+func newServiceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Run the daemon under the OS service manager",
+		Long: `Run the daemon under the OS service manager: a systemd user unit on
+Linux or a launchd agent on macOS. Once installed, 'synq daemon start' and
+'synq daemon stop' go through the service manager.`,
+	}
+
+	cmd.AddCommand(
+		newServiceInstallCmd(),
+		newServiceUninstallCmd(),
+		newServiceEnableCmd(),
+		newServiceDisableCmd(),
+		newServiceStatusCmd(),
+		newServiceLogsCmd(),
+	)
+	return cmd
+}
+
+// serviceOptions describes the service for the current config dir. The
+// instance name comes from local state, so every command reaches the unit
+// that install wrote.
+func serviceOptions() daemon.ServiceOptions {
+	dir, err := filepath.Abs(configDir)
+	if err != nil {
+		dir = configDir
+	}
+	opts := daemon.ServiceOptions{ConfigDir: dir, Verbose: verbose}
+	if state, err := config.LoadLocalState(configDir); err == nil {
+		opts.Instance = state.Daemon.Instance
+	}
+	return opts
+}
+
+// installedService returns the service manager if the synq service is
+// installed, or nil.
+func installedService() daemon.ServiceManager {
+	mgr, err := daemon.NewServiceManager(serviceOptions())
+	if err != nil {
+		return nil
+	}
+	st, err := mgr.Status()
+	if err != nil || !st.Installed {
+		return nil
+	}
+	return mgr
+}
+
+// serviceManager returns the service manager, failing if requireInstalled
+// is set and the service is not installed.
+func serviceManager(requireInstalled bool) (daemon.ServiceManager, error) {
+	mgr, err := daemon.NewServiceManager(serviceOptions())
+	if err != nil {
+		return nil, err
+	}
+	if requireInstalled {
+		st, err := mgr.Status()
+		if err != nil {
+			return nil, err
+		}
+		if !st.Installed {
+			return nil, fmt.Errorf("the synq service is not installed; run 'synq service install'")
+		}
+	}
+	return mgr, nil
+}
+
+// installService writes the service for the current config dir and, if
+// enable is set, starts it now and at login. Only the default config dir
+// may use the unnamed service; others need an instance name so that
+// several repos can each run a daemon.
+func installService(enable bool) (daemon.ServiceManager, error) {
+	opts := serviceOptions()
+	if err := daemon.ValidateInstance(opts.Instance); err != nil {
+		return nil, err
+	}
+	if opts.Instance == "" && filepath.Clean(opts.ConfigDir) != filepath.Clean(config.DefaultConfigDir()) {
+		return nil, fmt.Errorf("%s is not the default config dir; name its service with --instance", fileops.TildePath(opts.ConfigDir))
+	}
+	mgr, err := daemon.NewServiceManager(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Install(); err != nil {
+		return nil, fmt.Errorf("install service: %w", err)
+	}
+	if enable {
+		if err := mgr.Enable(); err != nil {
+			return nil, fmt.Errorf("enable service: %w", err)
+		}
+	}
+	return mgr, nil
+}
+
+// setInstance records the service instance for the config dir, removing
+// the service installed under the previous name.
+func setInstance(instance string) error {
+	if err := daemon.ValidateInstance(instance); err != nil {
+		return err
+	}
+	state, err := config.LoadLocalState(configDir)
+	if err != nil {
+		return fmt.Errorf("load local state: %w", err)
+	}
+	if state.Daemon.Instance == instance {
+		return nil
+	}
+	if old := installedService(); old != nil {
+		if err := old.Uninstall(); err != nil {
+			return fmt.Errorf("remove previous service: %w", err)
+		}
+		fmt.Printf("✓ Removed previous service %s\n", fileops.TildePath(old.Path()))
+	}
+	state.Daemon.Instance = instance
+	if err := config.SaveLocalState(configDir, state); err != nil {
+		return fmt.Errorf("write local state: %w", err)
+	}
+	return nil
+}
+
+func newServiceInstallCmd() *cobra.Command {
+	var (
+		noEnable bool
+		instance string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the service and start it at login",
+		Long: `Install the service and start it at login.
+
+The service runs 'synq daemon start --foreground' with this config dir, and
+--verbose if given. A config dir other than the default needs --instance to
+name its service (synq@<instance>.service or com.synq.daemon.<instance>),
+so separate repos can each run a daemon.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("instance") {
+				if err := setInstance(instance); err != nil {
+					return err
+				}
+			}
+			// Hand over from a daemon started by hand.
+			if running, pid := daemon.IsRunning(configDir); running && !noEnable {
+				if err := daemon.StopProcess(pid); err != nil {
+					return fmt.Errorf("stop daemon: %w", err)
+				}
+				daemon.RemovePID(configDir)
+				fmt.Printf("✓ Stopped daemon (PID %d)\n", pid)
+			}
+			mgr, err := installService(!noEnable)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✓ Installed %s service at %s\n", mgr.Name(), fileops.TildePath(mgr.Path()))
+			if !noEnable {
+				fmt.Println("✓ Enabled and started service")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noEnable, "no-enable", false, "only write the service file")
+	cmd.Flags().StringVar(&instance, "instance", "", "name of the service for this config dir")
+	return cmd
+}
+
+func newServiceUninstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall",
+		Short: "Stop the service and remove it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := serviceManager(true)
+			if err != nil {
+				return err
+			}
+			if err := mgr.Uninstall(); err != nil {
+				return fmt.Errorf("uninstall service: %w", err)
+			}
+			fmt.Printf("✓ Removed %s service\n", mgr.Name())
+			return nil
+		},
+	}
+}
+
+func newServiceEnableCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "enable",
+		Short: "Start the service now and at login",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := serviceManager(true)
+			if err != nil {
+				return err
+			}
+			if err := mgr.Enable(); err != nil {
+				return fmt.Errorf("enable service: %w", err)
+			}
+			fmt.Println("✓ Enabled and started service")
+			return nil
+		},
+	}
+}
+
+func newServiceDisableCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable",
+		Short: "Stop the service and keep it from starting at login",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := serviceManager(true)
+			if err != nil {
+				return err
+			}
+			if err := mgr.Disable(); err != nil {
+				return fmt.Errorf("disable service: %w", err)
+			}
+			fmt.Println("✓ Stopped and disabled service")
+			return nil
+		},
+	}
+}
+
+func newServiceStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the service is installed, enabled and running",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := serviceManager(false)
+			if err != nil {
+				return err
+			}
+			st, err := mgr.Status()
+			if err != nil {
+				return err
+			}
+			if !st.Installed {
+				fmt.Println("Service: not installed")
+				return nil
+			}
+			fmt.Printf("Service:  %s (%s)\n", mgr.Name(), fileops.TildePath(mgr.Path()))
+			fmt.Printf("Enabled:  %s\n", yesNo(st.Enabled))
+			if st.Running {
+				fmt.Printf("Running:  yes (PID %d)\n", st.PID)
+			} else {
+				fmt.Println("Running:  no")
+			}
+			return nil
+		},
+	}
+}
+
+func newServiceLogsCmd() *cobra.Command {
+	var (
+		lines  int
+		follow bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the service's output",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := serviceManager(true)
+			if err != nil {
+				return err
+			}
+			name, cmdArgs := mgr.LogsCommand(lines, follow)
+			c := exec.Command(name, cmdArgs...)
+			c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := c.Run(); err != nil {
+				var exit *exec.ExitError
+				if errors.As(err, &exit) {
+					return fmt.Errorf("%s exited with status %d", name, exit.ExitCode())
+				}
+				return fmt.Errorf("run %s: %w", name, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&lines, "lines", "n", 50, "number of lines to show")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing new output")
+	return cmd
+}
@@ -4,48 +4,66 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ihavespoons/synq/internal/apply"
 	"github.com/ihavespoons/synq/internal/config"
 	"github.com/ihavespoons/synq/internal/daemon"
 	"github.com/ihavespoons/synq/internal/fileops"
 	"github.com/ihavespoons/synq/internal/gitops"
 	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/machines"
 	"github.com/spf13/cobra"
 )
 
 func newSetupCmd() *cobra.Command {
-	var user string
+	var (
+		user     string
+		profiles []string
+		instance string
+		signing  config.SigningConfig
+		url      string
+	)
 
 	cmd := &cobra.Command{
-		Use:   "setup",
-		Short: "Initialize synq: create GitHub repo and clone locally",
+		Use:         "setup",
+		Annotations: signingOptional,
+		Short:       "Initialize synq: create GitHub repo and clone locally",
+		Long: `Initialize synq: create GitHub repo and clone locally.
+
+With --url, setup clones that repo instead and does not use GitHub, for
+instance to pull from a peer on the local network: trust it first with
+'synq peer add NAME KEY --url URL', then pass its URL followed by the
+source to sync, such as https://workstation:7465/default. Peers serve
+their repos read-only, so pushes from this machine are refused.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log := logger.Get()
-
-			// 1. Check gh CLI.
-			log.Debug().Msg("checking gh CLI")
-			if err := gitops.CheckGHInstalled(); err != nil {
+			if err := daemon.ValidateInstance(instance); err != nil {
 				return err
 			}
-			fmt.Println("✓ gh CLI authenticated")
 
-			// 2. Detect user.
-			ghUser, err := gitops.DetectUser(user)
-			if err != nil {
+			// Sign from the first commit on, keeping the signing settings
+			// of an earlier setup that the flags do not change.
+			prev, err := config.LoadLocalState(configDir)
+			if os.IsNotExist(err) {
+				prev = &config.LocalState{}
+			} else if err != nil {
+				return fmt.Errorf("read local state: %w; fix or remove %s", err, config.LocalStatePath(configDir))
+			}
+			signing = setupSigning(cmd, prev.Signing, signing)
+			if err := configureSigning(&config.LocalState{Signing: signing, Trust: prev.Trust}); err != nil {
 				return err
 			}
-			log.Debug().Str("user", ghUser).Msg("detected GitHub user")
-			fmt.Printf("✓ GitHub user: %s\n", ghUser)
 
-			// 3. Check/create repo.
-			repoName := config.DefaultRepoName
-			if gitops.RepoExists(ghUser, repoName) {
-				fmt.Printf("✓ Repo %s/%s already exists\n", ghUser, repoName)
-			} else {
-				log.Debug().Msg("creating private repo")
-				if err := gitops.CreatePrivateRepo(repoName); err != nil {
+			// 1-3. Check gh CLI, detect user, check/create repo.
+			var (
+				ghUser, repoName string
+				cloneURL         = url
+				cloneErr         error
+			)
+			if url == "" {
+				if ghUser, repoName, err = setupGitHub(user, signing); err != nil {
 					return err
 				}
-				fmt.Printf("✓ Created private repo %s/%s\n", ghUser, repoName)
+				cloneURL, cloneErr = gitops.GetCloneURL(ghUser, repoName)
 			}
 
 			// 4. Clone repo.
@@ -53,9 +71,8 @@ func newSetupCmd() *cobra.Command {
 			if _, err := os.Stat(repoDir); err == nil {
 				fmt.Printf("✓ Repo already cloned at %s\n", repoDir)
 			} else {
-				cloneURL, err := gitops.GetCloneURL(ghUser, repoName)
-				if err != nil {
-					return err
+				if cloneErr != nil {
+					return cloneErr
 				}
 				log.Debug().Str("url", cloneURL).Str("dir", repoDir).Msg("cloning repo")
 				if err := gitops.Clone(cloneURL, repoDir); err != nil {
@@ -71,34 +88,56 @@ func newSetupCmd() *cobra.Command {
 				if err := config.SaveRepoConfig(configDir, cfg); err != nil {
 					return fmt.Errorf("write repo config: %w", err)
 				}
-				if err := gitops.CommitAndPush(repoDir, "Initialize synq config"); err != nil {
+				if err := gitops.CommitAndPush(repoDir, "Initialize synq config", nil); err != nil {
 					return fmt.Errorf("initial commit: %w", err)
 				}
 				fmt.Println("✓ Initialized synq.yaml in repo")
 			}
 
-			// 6. Write local state.
-			cloneURL, _ := gitops.GetCloneURL(ghUser, repoName)
-			state := &config.LocalState{
-				GitHubUser: ghUser,
-				RepoName:   repoName,
-				RepoURL:    cloneURL,
-				RepoPath:   fileops.TildePath(repoDir),
-				Daemon: config.DaemonConfig{
-					PollInterval: config.DefaultPollInterval,
-				},
+			// 6. Write local state. An earlier setup's settings are kept
+			// unless the flags change them.
+			state := *prev
+			state.GitHubUser, state.RepoName, state.RepoURL = ghUser, repoName, cloneURL
+			state.RepoPath = fileops.TildePath(repoDir)
+			state.Signing = signing
+			if state.Daemon.PollInterval == "" {
+				state.Daemon.PollInterval = config.DefaultPollInterval
+			}
+			if cmd.Flags().Changed("instance") {
+				state.Daemon.Instance = instance
+			}
+			if cmd.Flags().Changed("profile") {
+				state.Profiles = profiles
 			}
-			if err := config.SaveLocalState(configDir, state); err != nil {
+			if state.MachineID == "" {
+				if state.MachineID, err = machines.NewID(); err != nil {
+					return fmt.Errorf("generate machine ID: %w", err)
+				}
+			}
+			if err := config.SaveLocalState(configDir, &state); err != nil {
 				return fmt.Errorf("write local state: %w", err)
 			}
 			fmt.Println("✓ Saved local state")
 
-			// 7. Install OS service.
-			if err := daemon.InstallService(configDir); err != nil {
+			// 7. Bootstrap: apply managed files and run pending scripts.
+			cfg, err := config.LoadRepoConfig(configDir)
+			if err != nil {
+				return fmt.Errorf("load repo config: %w", err)
+			}
+			if files := cfg.ActiveFiles(state.Profiles); len(files) > 0 {
+				printResults(apply.Entries(repoDir, files, applyOptions(repoDir)))
+			}
+			if err := runScripts(repoDir, cfg); err != nil {
+				log.Warn().Err(err).Msg("scripts failed")
+				fmt.Printf("⚠ %v; see 'synq scripts status'\n", err)
+			}
+
+			// 8. Install and start the OS service.
+			if _, err := installService(true); err != nil {
 				log.Warn().Err(err).Msg("could not install service")
 				fmt.Printf("⚠ Could not install OS service: %v\n", err)
 			} else {
-				fmt.Println("✓ Installed OS service")
+				fmt.Println("✓ Installed and started OS service")
 			}
 
 			fmt.Println("\nSetup complete! Use 'synq add <file>' to start managing files.")
@@ -107,5 +146,75 @@ func newSetupCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&user, "user", "", "GitHub username (auto-detected if omitted)")
+	cmd.Flags().StringVar(&url, "url", "", "clone this repo, such as a peer's, instead of using GitHub")
+	cmd.Flags().StringArrayVar(&profiles, "profile", nil, "profile to activate on this machine (repeatable)")
+	cmd.Flags().StringVar(&instance, "instance", "", "name of the OS service for this config dir")
+	cmd.Flags().StringVar(&signing.Format, "sign", "", "sign commits with ssh or gpg")
+	cmd.Flags().StringVar(&signing.Key, "signing-key", "", "SSH key path or GPG key ID to sign with (default: git's user.signingKey)")
+	cmd.Flags().BoolVar(&signing.Verify, "verify-signatures", false, "refuse pulled commits without a good signature from an allowed key")
+	cmd.Flags().StringVar(&signing.AllowedSigners, "allowed-signers", "", "SSH allowed signers file to verify against (default: git's gpg.ssh.allowedSignersFile)")
 	return cmd
 }
+
+// setupGitHub checks the gh CLI, detects the GitHub user and creates the
+// repo unless it exists. It returns the user and the repo name.
+func setupGitHub(user string, signing config.SigningConfig) (string, string, error) {
+	log := logger.Get()
+
+	// 1. Check gh CLI.
+	log.Debug().Msg("checking gh CLI")
+	if err := gitops.CheckGHInstalled(); err != nil {
+		return "", "", err
+	}
+	fmt.Println("✓ gh CLI authenticated")
+
+	// 2. Detect user.
+	ghUser, err := gitops.DetectUser(user)
+	if err != nil {
+		return "", "", err
+	}
+	log.Debug().Str("user", ghUser).Msg("detected GitHub user")
+	fmt.Printf("✓ GitHub user: %s\n", ghUser)
+
+	// 3. Check/create repo.
+	repoName := config.DefaultRepoName
+	if gitops.RepoExists(ghUser, repoName) {
+		fmt.Printf("✓ Repo %s/%s already exists\n", ghUser, repoName)
+	} else {
+		log.Debug().Msg("creating private repo")
+		if err := gitops.CreatePrivateRepo(repoName); err != nil {
+			return "", "", err
+		}
+		fmt.Printf("✓ Created private repo %s/%s\n", ghUser, repoName)
+	}
+	if gitops.RequiresSignatures(ghUser, repoName) {
+		switch {
+		case signing.Format == "" && !gitops.SignsByDefault():
+			fmt.Printf("⚠ %s/%s only accepts signed commits, but signing is not configured; rerun setup with --sign ssh or --sign gpg\n", ghUser, repoName)
+		case signing.Format == "":
+			fmt.Printf("✓ %s/%s requires signed commits; git signs them\n", ghUser, repoName)
+		default:
+			fmt.Printf("✓ %s/%s requires signed commits; signing with %s\n", ghUser, repoName, signing.Format)
+		}
+	}
+	return ghUser, repoName, nil
+}
+
+// setupSigning returns the signing settings from the flags of cmd that
+// were given, and prev for the others.
+func setupSigning(cmd *cobra.Command, prev, flags config.SigningConfig) config.SigningConfig {
+	s := prev
+	if cmd.Flags().Changed("sign") {
+		s.Format = flags.Format
+	}
+	if cmd.Flags().Changed("signing-key") {
+		s.Key = flags.Key
+	}
+	if cmd.Flags().Changed("verify-signatures") {
+		s.Verify = flags.Verify
+	}
+	if cmd.Flags().Changed("allowed-signers") {
+		s.AllowedSigners = flags.AllowedSigners
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/daemon"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/spf13/cobra"
+)
+
+func newSourceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "source",
+		Short: "Manage the repos synced on this machine",
+		Long: `Manage the repos synced on this machine.
+
+The repo created by 'synq setup' is the default source. Named sources, such
+as a team-shared repo, are cloned under sources/ in the config dir and have
+their own synq.yaml. sync, list and the daemon cover every source; add,
+remove and mv take --source to pick one.
+
+When entries of two sources target the same file, the source added first
+keeps it and the other entry is listed as shadowed. Scripts and machine
+heartbeats only come from the default source.`,
+	}
+
+	cmd.AddCommand(
+		newSourceAddCmd(),
+		newSourceListCmd(),
+		newSourceRemoveCmd(),
+	)
+	return cmd
+}
+
+func newSourceAddCmd() *cobra.Command {
+	var pollInterval string
+
+	cmd := &cobra.Command{
+		Use:   "add <name> <repo-url>",
+		Short: "Clone another repo and apply its files",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, url := args[0], args[1]
+			if err := config.ValidateSourceName(name); err != nil {
+				return err
+			}
+			if pollInterval != "" {
+				if d, err := time.ParseDuration(pollInterval); err != nil || d <= 0 {
+					return fmt.Errorf("invalid --poll-interval %q", pollInterval)
+				}
+			}
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state (run 'synq setup' first): %w", err)
+			}
+			if state.FindSource(name) != -1 {
+				return fmt.Errorf("source %q already exists", name)
+			}
+
+			// 1. Clone the repo.
+			repoDir := config.SourceDir(configDir, name)
+			if _, err := os.Stat(repoDir); err == nil {
+				return fmt.Errorf("%s already exists; remove it or pick another name", fileops.TildePath(repoDir))
+			}
+			if err := gitops.Clone(url, repoDir); err != nil {
+				_ = os.RemoveAll(repoDir)
+				return err
+			}
+			fmt.Printf("✓ Cloned %s to %s\n", url, fileops.TildePath(repoDir))
+
+			// 2. Initialize its config if needed.
+			if _, err := os.Stat(filepath.Join(repoDir, config.RepoConfigFile)); os.IsNotExist(err) {
+				if err := config.SaveRepoConfigIn(repoDir, &config.Config{Files: []config.FileEntry{}}); err != nil {
+					return fmt.Errorf("write repo config: %w", err)
+				}
+				if err := gitops.CommitAndPush(repoDir, "Initialize synq config", nil); err != nil {
+					return fmt.Errorf("initial commit: %w", err)
+				}
+				fmt.Println("✓ Initialized synq.yaml in repo")
+			}
+
+			// 3. Record the source.
+			state.Sources = append(state.Sources, config.Source{Name: name, RepoURL: url, PollInterval: pollInterval})
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			fmt.Printf("✓ Added source %s\n", name)
+
+			// 4. Apply its files.
+			repo, cfg, err := openRepo(name)
+			if err != nil {
+				return err
+			}
+			printResults(apply.Entries(repoDir, activeFiles(repo, cfg), applyOptions(repoDir)))
+
+			if running, _ := daemon.IsRunning(configDir); running {
+				fmt.Println("⚠ Restart the daemon to sync the new source: synq daemon stop && synq daemon start")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pollInterval, "poll-interval", "", "how often the daemon pulls this source (defaults to daemon.poll_interval)")
+	return cmd
+}
+
+func newSourceListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the repos synced on this machine",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "NAME\tREPO\tDIR\tPOLL\tFILES"); err != nil {
+				return err
+			}
+			for _, r := range state.Repos(configDir) {
+				files := "?"
+				if cfg, err := config.LoadRepoConfigIn(r.Dir); err == nil {
+					files = strconv.Itoa(len(cfg.Files))
+				}
+				poll := r.PollInterval
+				if poll == "" {
+					poll = config.DefaultPollInterval
+				}
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.URL, fileops.TildePath(r.Dir), poll, files); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newSourceRemoveCmd() *cobra.Command {
+	var purge bool
+
+	cmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Stop syncing a source and delete its clone",
+		Long: `Stop syncing a source and delete its clone.
+
+Links to the source's files are replaced by a plain copy of the file, like
+synq remove does, unless --purge is given. Copied targets are left alone.
+Unpushed commits in the clone are lost, so the source is only removed when
+everything has been pushed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			idx := state.FindSource(name)
+			if idx == -1 {
+				return fmt.Errorf("unknown source %q; see 'synq source list'", name)
+			}
+			repo, cfg, err := openRepo(name)
+			if err != nil {
+				return err
+			}
+
+			if n, err := gitops.Unpushed(repo.Dir); err == nil && n > 0 {
+				return fmt.Errorf("%s has %d unpushed commit(s); run 'synq sync --source %s' first", name, n, name)
+			}
+
+			for _, f := range cfg.Files {
+				if err := detach(repo.Dir, f, purge); err != nil {
+					return err
+				}
+			}
+
+			state.Sources = append(state.Sources[:idx], state.Sources[idx+1:]...)
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			if err := os.RemoveAll(repo.Dir); err != nil {
+				return fmt.Errorf("remove clone: %w", err)
+			}
+			fmt.Printf("✓ Removed source %s\n", name)
+
+			if running, _ := daemon.IsRunning(configDir); running {
+				fmt.Println("⚠ Restart the daemon to stop syncing it: synq daemon stop && synq daemon start")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&purge, "purge", false, "delete links to the source's files instead of leaving a copy")
+	return cmd
+}
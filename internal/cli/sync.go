@@ -2,71 +2,287 @@ package cli
 
 import (
 	"fmt"
-	"path/filepath"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/ihavespoons/synq/internal/apply"
 	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
 	"github.com/ihavespoons/synq/internal/fileops"
 	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/layers"
 	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/trust"
 	"github.com/spf13/cobra"
 )
 
 func newSyncCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		source      string
+		force       bool
+		interactive bool
+	)
+
+	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync configuration files with remote repo",
+		Long: `Sync configuration files with remote repo.
+
+Every source is synced in turn, the default repo first; use --source to sync
+only one of them.
+
+Edits to copied targets and blocks are captured into the repo before
+pulling. A target edited since synq last wrote it that cannot be captured,
+because the repo changed it too or it belongs to a read-only layer, is left
+alone; see 'synq diff' and use --force to overwrite it, keeping a backup.
+With --interactive, each incoming change is shown and applied only once you
+accept it; see 'synq review'.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log := logger.Get()
-			repoDir := config.RepoDir(configDir)
-
-			// 1. Commit + push local changes.
-			if gitops.HasChanges(repoDir) {
-				log.Debug().Msg("committing local changes")
-				if err := gitops.CommitAndPush(repoDir, "Sync local changes"); err != nil {
-					return fmt.Errorf("push local changes: %w", err)
-				}
-				fmt.Println("✓ Pushed local changes")
+			opts := syncOptions{force: force}
+			if interactive {
+				opts.review = newReviewer(os.Stdin)
 			}
+			return runSync(source, opts)
+		},
+	}
 
-			// 2. Pull remote changes.
-			log.Debug().Msg("pulling remote changes")
-			changed, err := gitops.Pull(repoDir)
-			if err != nil {
-				return fmt.Errorf("pull: %w", err)
-			}
-			if changed {
-				fmt.Println("✓ Pulled remote changes")
-			} else {
-				fmt.Println("✓ Already up to date")
-			}
+	cmd.Flags().StringVar(&source, "source", "", "only sync this source")
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite targets with local edits, keeping a backup")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "review each incoming change before applying it")
+	cmd.MarkFlagsMutuallyExclusive("force", "interactive")
+	return cmd
+}
+
+// syncOptions controls how synced entries are applied.
+type syncOptions struct {
+	// force overwrites targets with local edits.
+	force bool
+	// review asks about each incoming change; nil applies them all.
+	review *reviewer
+}
 
-			// 3. Re-apply symlinks.
-			cfg, err := config.LoadRepoConfig(configDir)
-			if err != nil {
-				return fmt.Errorf("load repo config: %w", err)
+// runSync syncs the named source, or every source when name is empty.
+func runSync(name string, opts syncOptions) error {
+	repos := loadState().Repos(configDir)
+	if name != "" {
+		repo, err := loadState().Repo(configDir, name)
+		if err != nil {
+			return err
+		}
+		repos = []config.Repo{repo}
+	}
+	var failed []string
+	for _, repo := range repos {
+		if len(repos) > 1 {
+			fmt.Printf("Syncing %s\n", repo.Name)
+		}
+		if err := syncRepo(repo, opts); err != nil {
+			if len(repos) == 1 {
+				return err
 			}
+			fmt.Printf("✗ %s: %v\n", repo.Name, err)
+			failed = append(failed, repo.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("sync failed for %s", strings.Join(failed, ", "))
+	}
+	record(events.Event{Type: events.Synced})
+	return nil
+}
 
-			for _, f := range cfg.Files {
-				target, ok := fileops.ResolveTarget(f.Targets)
-				if !ok {
-					log.Debug().Str("name", f.Name).Msg("no target for this OS, skipping")
-					continue
-				}
+// syncRepo commits local changes to one repo, rebases them onto remote
+// changes, pushes them and applies the repo's entries. Targets with local
+// edits that were not captured are kept unless opts.force is set. Scripts
+// only run from the default repo.
+func syncRepo(repo config.Repo, so syncOptions) error {
+	log := logger.Get()
+	repoDir := repo.Dir
 
-				repoFile := filepath.Join(repoDir, f.Source)
-				if fileops.IsSymlinkTo(target, repoFile) {
-					continue
-				}
+	cfg, err := config.LoadRepoConfigIn(repoDir)
+	if err != nil {
+		return fmt.Errorf("load repo config: %w", err)
+	}
+	filter, err := stageFilter(repoDir, cfg)
+	if err != nil {
+		return err
+	}
 
-				log.Debug().Str("name", f.Name).Str("target", target).Msg("creating symlink")
-				if err := fileops.CreateSymlink(repoFile, target); err != nil {
-					log.Error().Err(err).Str("name", f.Name).Msg("failed to create symlink")
-					continue
+	// 1. Capture edits to copied targets, then commit local changes. A
+	// peer serves its repos read-only, so a repo pulled from one is only
+	// pulled.
+	pullOnly := repo.Peer != ""
+	if pullOnly {
+		fmt.Printf("⚠ Pulling only: peer %s serves %s read-only\n", repo.Peer, repo.Name)
+	} else {
+		printResults(apply.Capture(repoDir, activeFiles(repo, cfg), applyState()))
+	}
+	if !pullOnly && gitops.HasChanges(repoDir, filter) {
+		log.Debug().Str("source", repo.Name).Msg("committing local changes")
+		if err := gitops.AddFiltered(repoDir, filter); err != nil {
+			return fmt.Errorf("stage local changes: %w", err)
+		}
+		if _, err := gitops.Commit(repoDir, "Sync local changes"); err != nil {
+			return fmt.Errorf("commit local changes: %w", err)
+		}
+	}
+
+	// 2. Pull remote changes, rebasing local commits onto them. Entries
+	// with a merge format are merged key by key. When reviewing, changes to
+	// symlinked files are reviewed first, as pulling applies them.
+	log.Debug().Str("source", repo.Name).Msg("pulling remote changes")
+	installMergeDriver(repoDir, cfg)
+	before, _ := gitops.Head(repoDir)
+	changed, keptLinked, err := so.review.pull(repoDir, activeFiles(repo, cfg), pullOnly)
+	if err != nil {
+		record(sourceEvents(repo, events.PullFailure(err))...)
+		if held, herr := trust.Hold(configDir, repo.Name, err); herr != nil {
+			log.Warn().Err(herr).Msg("record quarantine")
+		} else if held {
+			return fmt.Errorf("pull: %w; see 'synq trust status'", err)
+		}
+		return fmt.Errorf("pull: %w", err)
+	}
+	if err := trust.Release(configDir, repo.Name); err != nil {
+		log.Warn().Err(err).Msg("release quarantine")
+	}
+	if changed {
+		after, _ := gitops.Head(repoDir)
+		record(sourceEvents(repo, events.Event{Type: events.Pulled, Data: map[string]string{"from": before, "to": after}})...)
+		fmt.Println("✓ Pulled remote changes")
+	} else {
+		fmt.Println("✓ Already up to date")
+	}
+
+	// 3. Push local commits.
+	if n, err := gitops.Unpushed(repoDir); err == nil && n > 0 && !pullOnly {
+		if err := gitops.Push(repoDir); err != nil {
+			record(sourceEvents(repo, events.Event{Type: events.Failed, Name: "push", Message: err.Error()})...)
+			return fmt.Errorf("push local changes: %w", err)
+		}
+		record(sourceEvents(repo, events.Event{Type: events.Pushed, Message: "Sync local changes"})...)
+		fmt.Println("✓ Pushed local changes")
+	}
+
+	// 4. Re-apply symlinks and copies.
+	cfg, err = config.LoadRepoConfigIn(repoDir)
+	if err != nil {
+		return fmt.Errorf("load repo config: %w", err)
+	}
+
+	opts := applyOptions(repoDir)
+	opts.Force = so.force
+	if changed {
+		after, _ := gitops.Head(repoDir)
+		paths, err := gitops.ChangedFiles(repoDir, before, after)
+		if err != nil {
+			log.Warn().Err(err).Msg("could not list pulled changes")
+		}
+		opts.Changed = apply.ChangedFunc(paths)
+	}
+	results, kept := so.review.apply(repoDir, activeFiles(repo, cfg), opts, pullOnly)
+	printResults(results)
+	if kept || keptLinked {
+		if err := gitops.CommitAndPush(repoDir, "Keep local versions", filter); err != nil {
+			record(sourceEvents(repo, events.Event{Type: events.Failed, Name: "push", Message: err.Error()})...)
+			return fmt.Errorf("push kept versions: %w", err)
+		}
+		record(sourceEvents(repo, events.Event{Type: events.Pushed, Message: "Keep local versions"})...)
+		fmt.Println("✓ Pushed the local versions you kept")
+	}
+
+	// 5. Update and apply the layers the repo extends.
+	if err := syncLayers(cfg, so); err != nil {
+		record(sourceEvents(repo, events.Event{Type: events.Failed, Name: "layers", Message: err.Error()})...)
+		return fmt.Errorf("layers: %w", err)
+	}
+
+	// 6. Run pending scripts.
+	if repo.Name != config.DefaultSource {
+		return nil
+	}
+	return runScripts(repoDir, cfg)
+}
+
+// syncLayers brings the clones of the layers cfg extends up to date and
+// applies their entries that cfg does not override. Layers are read-only, so
+// edits to their files are discarded rather than pushed.
+func syncLayers(cfg *config.Config, so syncOptions) error {
+	if len(cfg.Extends) == 0 {
+		return nil
+	}
+	updates, err := layers.Fetch(configDir, cfg)
+	for _, u := range updates {
+		if u.Discarded != "" {
+			fmt.Printf("⚠ Discarded local edits to layer %s; saved them to %s\n", u.Repo, fileops.TildePath(u.Discarded))
+		}
+		if u.Changed {
+			fmt.Printf("✓ Updated layer %s\n", u.Repo)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	profiles := loadState().Profiles
+	list, err := layers.Resolve(configDir, cfg, profiles)
+	if err != nil {
+		return err
+	}
+	for _, l := range list {
+		opts := applyOptions(l.Dir)
+		opts.Force = so.force
+		results, _ := so.review.apply(l.Dir, l.ActiveFiles(profiles), opts, true)
+		printResults(results)
+	}
+	return nil
+}
+
+// printResults reports the outcome of applying or capturing entries and
+// records it in the event journal.
+func printResults(results []apply.Result) {
+	log := logger.Get()
+	record(events.Results(results)...)
+	for _, res := range results {
+		if res.Backup != "" {
+			fmt.Printf("⚠ Backed up %s to %s\n", fileops.TildePath(res.Target), fileops.TildePath(res.Backup))
+		}
+		switch res.Action {
+		case apply.ActionNoTarget:
+			log.Debug().Str("name", res.Name).Msg("no target for this OS, skipping")
+		case apply.ActionFailed:
+			log.Error().Err(res.Err).Str("name", res.Name).Msg("failed to apply")
+		case apply.ActionLinked:
+			fmt.Printf("✓ Linked %s -> %s\n", res.Name, fileops.TildePath(res.Target))
+		case apply.ActionCopied:
+			fmt.Printf("✓ Copied %s -> %s\n", res.Name, fileops.TildePath(res.Target))
+		case apply.ActionWritten:
+			fmt.Printf("✓ Wrote block %s into %s\n", res.Name, fileops.TildePath(res.Target))
+		case apply.ActionCaptured:
+			fmt.Printf("✓ Captured edits to %s\n", fileops.TildePath(res.Target))
+		case apply.ActionKept:
+			fmt.Printf("⚠ Kept %s: %v; see 'synq diff %s' or sync with --force\n", fileops.TildePath(res.Target), res.Err, res.Name)
+		}
+		if res.Drifted {
+			fmt.Printf("⚠ Permissions of %s had drifted to %04o; restored\n", res.Name, res.PrevMode)
+		}
+		for _, h := range res.Hooks {
+			switch {
+			case h.Skipped != "":
+				fmt.Printf("⚠ Skipped %s hook for %s: %s\n", h.Kind, h.Name, h.Skipped)
+			case h.Err != nil:
+				fmt.Printf("✗ %s hook for %s failed: %v\n", h.Kind, h.Name, h.Err)
+				if h.Output != "" {
+					fmt.Println(h.Output)
+				}
+			default:
+				fmt.Printf("✓ Ran %s hook for %s (%s)\n", h.Kind, h.Name, h.Duration.Round(time.Millisecond))
+				if h.Output != "" {
+					log.Debug().Str("name", h.Name).Str("hook", string(h.Kind)).Msg(h.Output)
 				}
-				fmt.Printf("✓ Linked %s -> %s\n", f.Name, fileops.TildePath(target))
 			}
-
-			return nil
-		},
+		}
 	}
 }
@@ -0,0 +1,378 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/machines"
+	"github.com/ihavespoons/synq/internal/trust"
+	"github.com/spf13/cobra"
+)
+
+func newTrustCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Apply only changes signed by trusted machines",
+		Long: `Apply only changes signed by trusted machines.
+
+With trust enabled, this machine signs its commits with its own SSH key,
+published in its heartbeat under machines/, and pulled commits are applied
+only if a machine trusted here signed them. Other commits are held in
+quarantine: nothing is pulled from that source until they are approved, or
+their signer is trusted. Enable trust on every machine, then trust the
+keys of the others, comparing fingerprints with 'synq trust status' there.
+Restart the daemon after enabling or disabling trust.`,
+	}
+
+	cmd.AddCommand(
+		newTrustStatusCmd(),
+		newTrustToggleCmd("enable", "Sign commits with this machine's key and verify pulled ones", true),
+		newTrustToggleCmd("disable", "Apply pulled commits without verifying them", false),
+		newTrustAddCmd(),
+		newTrustRemoveCmd(),
+		newTrustApproveCmd(),
+	)
+	return cmd
+}
+
+func newTrustStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         "status",
+		Annotations: signingOptional,
+		Short:       "Show trusted machines and changes held in quarantine",
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			if !state.Trust.Enabled {
+				fmt.Println("Trust is disabled on this machine. Use 'synq trust enable' to verify pulled changes.")
+			} else {
+				fmt.Println("Trust is enabled: pulled changes must be signed by a trusted machine.")
+				key := trust.KeyPath(configDir, state)
+				if pub, err := trust.PublicKey(key); err == nil {
+					fp, _ := trust.Fingerprint(pub)
+					fmt.Printf("This machine signs with %s (%s):\n  %s\n", fp, fileops.TildePath(key), pub)
+				}
+			}
+
+			list, err := machines.Load(config.RepoDir(configDir))
+			if err != nil {
+				return fmt.Errorf("load machines: %w", err)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "\nMACHINE\tID\tKEY\tTRUSTED"); err != nil {
+				return err
+			}
+			listed := map[string]bool{}
+			for _, hb := range list {
+				listed[hb.ID] = true
+				trusted := state.Trust.Machines[hb.ID]
+				if hb.SigningKey == "" && trusted == "" {
+					continue
+				}
+				status := yesNo(trusted != "")
+				if trusted != "" && hb.SigningKey != "" && trusted != hb.SigningKey {
+					status = "no, key changed"
+				}
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", hb.Hostname, shortID(hb.ID), keyFingerprint(hb.SigningKey), status); err != nil {
+					return err
+				}
+			}
+			for _, id := range sortedKeys(state.Trust.Machines) {
+				if listed[id] {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "(not in registry)\t%s\t%s\tyes\n", shortID(id), keyFingerprint(state.Trust.Machines[id])); err != nil {
+					return err
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			held, err := trust.LoadHeld(configDir)
+			if err != nil {
+				return err
+			}
+			if len(held) == 0 {
+				fmt.Println("\n✓ Nothing held in quarantine")
+				return nil
+			}
+			fmt.Println()
+			printHeld(held)
+			return nil
+		},
+	}
+}
+
+// printHeld reports what each source holds in quarantine.
+func printHeld(held map[string]trust.Held) {
+	for _, source := range sortedKeys(held) {
+		h := held[source]
+		fmt.Printf("⚠ %s: holding %d commit(s) since %s: %s\n", source, len(h.Commits),
+			h.Since.Local().Format("2006-01-02 15:04"), strings.Join(h.Commits, ", "))
+		fmt.Printf("  review with 'git -C %s log -p HEAD..%s', then 'synq trust approve --source %s'\n",
+			fileops.TildePath(sourceDir(source)), shortID(h.Upstream), source)
+	}
+}
+
+// sourceDir returns the clone of the named source.
+func sourceDir(name string) string {
+	repo, err := loadState().Repo(configDir, name)
+	if err != nil {
+		return config.RepoDir(configDir)
+	}
+	return repo.Dir
+}
+
+func keyFingerprint(pub string) string {
+	if pub == "" {
+		return "-"
+	}
+	fp, err := trust.Fingerprint(pub)
+	if err != nil {
+		return "invalid"
+	}
+	return fp
+}
+
+func newTrustToggleCmd(use, short string, enabled bool) *cobra.Command {
+	return &cobra.Command{
+		Use:         use,
+		Annotations: signingOptional,
+		Short:       short,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			state.Trust.Enabled = enabled
+			if !enabled {
+				if err := config.SaveLocalState(configDir, state); err != nil {
+					return fmt.Errorf("save local state: %w", err)
+				}
+				fmt.Println("✓ Trust disabled; pulled changes are applied unverified")
+				return nil
+			}
+
+			id, err := machines.EnsureID(configDir)
+			if err != nil {
+				return err
+			}
+			state.MachineID = id
+			pub, err := trust.EnsureKey(configDir, state)
+			if err != nil {
+				return fmt.Errorf("machine key: %w", err)
+			}
+			if state.Trust.Machines == nil {
+				state.Trust.Machines = map[string]string{}
+			}
+			state.Trust.Machines[id] = pub
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			if err := configureSigning(state); err != nil {
+				return err
+			}
+			fp, _ := trust.Fingerprint(pub)
+			fmt.Printf("✓ Trust enabled; this machine signs with %s\n", fp)
+
+			if err := publishKey(id, pub); err != nil {
+				fmt.Printf("⚠ Could not publish the key: %v; the daemon publishes it with its next heartbeat\n", err)
+				return nil
+			}
+			fmt.Println("✓ Published the key in the machine registry")
+			fmt.Println("Run 'synq trust add <machine>' on the other machines to trust this one.")
+			return nil
+		},
+	}
+}
+
+// publishKey records pub in this machine's heartbeat and pushes it.
+func publishKey(id, pub string) error {
+	repoDir := config.RepoDir(configDir)
+	list, err := machines.Load(repoDir)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	hb := &machines.Heartbeat{ID: id, Hostname: hostname, OS: runtime.GOOS, Arch: runtime.GOARCH, LastSeen: time.Now().UTC().Truncate(time.Second)}
+	if found, err := machines.Find(list, id); err == nil && found.ID == id {
+		hb = found
+	}
+	if hb.SigningKey == pub {
+		return nil
+	}
+	hb.SigningKey = pub
+	source, err := machines.Write(repoDir, hb)
+	if err != nil {
+		return err
+	}
+	if _, err := gitops.CommitPaths(repoDir, fmt.Sprintf("Publish signing key of %s", hostname), source); err != nil {
+		return err
+	}
+	return gitops.Push(repoDir)
+}
+
+func newTrustAddCmd() *cobra.Command {
+	var key string
+
+	cmd := &cobra.Command{
+		Use:         "add <id|hostname>",
+		Annotations: signingOptional,
+		Short:       "Trust the changes signed by a machine",
+		Long: `Trust the changes signed by a machine.
+
+The machine's key is taken from its heartbeat in the registry. A machine
+whose key has not been pulled yet, for instance because the commit
+publishing it is held in quarantine, can be trusted by passing the public
+key shown by 'synq trust status' there with --key and its machine ID.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			id, name := args[0], args[0]
+			if key == "" {
+				list, err := machines.Load(config.RepoDir(configDir))
+				if err != nil {
+					return fmt.Errorf("load machines: %w", err)
+				}
+				hb, err := machines.Find(list, args[0])
+				if err != nil {
+					return err
+				}
+				if hb.SigningKey == "" {
+					return fmt.Errorf("%s has not published a signing key; run 'synq trust enable' there, or pass its key with --key", hb.Hostname)
+				}
+				id, name, key = hb.ID, hb.Hostname, hb.SigningKey
+			}
+			if key, err = trust.ParseKey(key); err != nil {
+				return err
+			}
+			fp, err := trust.Fingerprint(key)
+			if err != nil {
+				return fmt.Errorf("invalid key: %w", err)
+			}
+			if state.Trust.Machines == nil {
+				state.Trust.Machines = map[string]string{}
+			}
+			state.Trust.Machines[id] = key
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			if err := configureSigning(state); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Trusted %s (%s)\n", name, fp)
+			if !state.Trust.Enabled {
+				fmt.Println("Trust is disabled on this machine; use 'synq trust enable' to verify pulled changes.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "the machine's SSH public key, when it is not in the registry")
+	return cmd
+}
+
+func newTrustRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         "remove <id|hostname>",
+		Annotations: signingOptional,
+		Short:       "Stop trusting the changes signed by a machine",
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := config.LoadLocalState(configDir)
+			if err != nil {
+				return fmt.Errorf("load local state: %w", err)
+			}
+			id := args[0]
+			if _, ok := state.Trust.Machines[id]; !ok {
+				list, err := machines.Load(config.RepoDir(configDir))
+				if err != nil {
+					return fmt.Errorf("load machines: %w", err)
+				}
+				hb, err := machines.Find(list, id)
+				if err != nil {
+					return err
+				}
+				id = hb.ID
+			}
+			if _, ok := state.Trust.Machines[id]; !ok {
+				return fmt.Errorf("machine %s is not trusted", args[0])
+			}
+			delete(state.Trust.Machines, id)
+			if err := config.SaveLocalState(configDir, state); err != nil {
+				return fmt.Errorf("save local state: %w", err)
+			}
+			if err := configureSigning(state); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Stopped trusting %s\n", shortID(id))
+			return nil
+		},
+	}
+}
+
+func newTrustApproveCmd() *cobra.Command {
+	var source string
+
+	cmd := &cobra.Command{
+		Use:   "approve",
+		Short: "Apply the changes held in quarantine",
+		Long: `Apply the changes held in quarantine.
+
+The held commits are let in as they were when they were refused, then the
+source is synced. Commits that arrived since are verified as usual.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			held, err := trust.LoadHeld(configDir)
+			if err != nil {
+				return err
+			}
+			if source != "" {
+				h, ok := held[source]
+				if !ok {
+					return fmt.Errorf("nothing from %s is held in quarantine", source)
+				}
+				held = map[string]trust.Held{source: h}
+			}
+			if len(held) == 0 {
+				fmt.Println("✓ Nothing held in quarantine")
+				return nil
+			}
+			for _, name := range sortedKeys(held) {
+				repo, err := loadState().Repo(configDir, name)
+				if err != nil {
+					return err
+				}
+				if err := gitops.PullTo(repo.Dir, held[name].Upstream); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				if err := trust.Release(configDir, name); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Approved %d commit(s) from %s\n", len(held[name].Commits), name)
+				if err := runSync(name, syncOptions{}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&source, "source", "", "only approve what this source holds")
+	return cmd
+}
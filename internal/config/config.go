@@ -1,8 +1,96 @@
 package config
 
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/fileops"
+)
+
 // Config is stored in the git repo as synq.yaml.
+//
+// Entries can come from three places, in order of precedence: synq.yaml
+// itself, the files listed in Include, and the repos listed in Extends. An
+// entry overrides every lower entry with the same name or, on a machine,
+// the same target. Within Include and Extends earlier items win.
 type Config struct {
-	Files []FileEntry `yaml:"files"`
+	// Include lists files in the same repo, in synq.yaml format, whose
+	// entries and scripts are merged in. Included entries are part of the
+	// repo and sync like its own.
+	Include []string `yaml:"include,omitempty"`
+	// Extends lists shared base configs from other repos. Their entries are
+	// read-only: they are applied from a clone that is never pushed.
+	Extends []Layer     `yaml:"extends,omitempty"`
+	Files   []FileEntry `yaml:"files"`
+	Scripts []Script    `yaml:"scripts,omitempty"`
+}
+
+// Layer is a shared base config in another synq repo.
+type Layer struct {
+	Repo string `yaml:"repo"`
+	// Path is the config file inside the repo; it defaults to synq.yaml.
+	Path string `yaml:"path,omitempty"`
+}
+
+// ConfigPath returns the layer's config file inside its repo.
+func (l Layer) ConfigPath() string {
+	if l.Path == "" {
+		return RepoConfigFile
+	}
+	return l.Path
+}
+
+// Script is a provisioning script run by synq sync and setup.
+type Script struct {
+	Name string `yaml:"name"`
+	// Source is a script file inside the repo; Command is an inline
+	// alternative. Exactly one of them is set.
+	Source  string `yaml:"source,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	// Run is one of "once", "onchange" or "always".
+	Run string `yaml:"run"`
+	// OS and Hosts restrict the machines the script runs on. Hosts may
+	// contain glob patterns. Empty lists match every machine.
+	OS    []string `yaml:"os,omitempty"`
+	Hosts []string `yaml:"hosts,omitempty"`
+	// Profiles limits the script to machines with one of these profiles
+	// active.
+	Profiles []string `yaml:"profiles,omitempty"`
+	// Include is the included file the script comes from, if any.
+	Include string `yaml:"-"`
+}
+
+// Run modes for Script.Run.
+const (
+	RunOnce     = "once"
+	RunOnChange = "onchange"
+	RunAlways   = "always"
+)
+
+// Validate checks that the script is well formed.
+func (s Script) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("script without a name")
+	}
+	if (s.Source == "") == (s.Command == "") {
+		return fmt.Errorf("script %q must set exactly one of source and command", s.Name)
+	}
+	if s.Source != "" {
+		if err := ValidateSource(s.Source); err != nil {
+			return fmt.Errorf("script %q: %w", s.Name, err)
+		}
+	}
+	switch s.Run {
+	case RunOnce, RunOnChange, RunAlways:
+		return nil
+	}
+	return fmt.Errorf("script %q: run must be %s, %s or %s", s.Name, RunOnce, RunOnChange, RunAlways)
 }
 
 // FileEntry represents a single managed file.
@@ -10,6 +98,247 @@ type FileEntry struct {
 	Name    string            `yaml:"name"`
 	Source  string            `yaml:"source"`
 	Targets map[string]string `yaml:"targets"`
+	Ignore  []string          `yaml:"ignore,omitempty"`
+	// Mode is the octal permission enforced on apply, e.g. "0600".
+	Mode string `yaml:"mode,omitempty"`
+	// Method is how the target is applied: "symlink" (default), "copy" or
+	// "block".
+	Method string `yaml:"method,omitempty"`
+	// Comment starts the marker lines of a block entry; it defaults to "#".
+	Comment string `yaml:"comment,omitempty"`
+	// Merge makes git merge concurrent edits to the source key by key:
+	// "json", "yaml", "toml" or "ini".
+	Merge string `yaml:"merge,omitempty"`
+	// Overlays patch a structured file per machine. Keys are
+	// "os:<goos>", "profile:<name>" or "host:<hostname>"; values are JSON
+	// Merge Patches written in YAML. An entry with overlays is copied, not
+	// linked, and they apply in that order, so host overlays win.
+	Overlays map[string]map[string]any `yaml:"overlays,omitempty"`
+	Hooks    *Hooks                    `yaml:"hooks,omitempty"`
+	// Profiles limits the entry to machines with one of these profiles
+	// active. Entries without profiles apply everywhere.
+	Profiles []string `yaml:"profiles,omitempty"`
+	// Include is the included file the entry comes from, if any. Included
+	// entries are not written back to synq.yaml.
+	Include string `yaml:"-"`
+	// ActiveOverlays are the keys of the overlays that apply on this
+	// machine, in order. ActiveFiles sets them.
+	ActiveOverlays []string `yaml:"-"`
+}
+
+// Hooks are shell commands run around applying an entry. They only run on
+// machines that enabled hooks and trusted the entry's current commands.
+type Hooks struct {
+	// PreApply runs before the target is linked or copied.
+	PreApply string `yaml:"pre_apply,omitempty"`
+	// PostApply runs after the target was linked or copied.
+	PostApply string `yaml:"post_apply,omitempty"`
+	// PostChange runs whenever the content behind the target changed,
+	// either because it was applied or because a pull changed the source.
+	PostChange string `yaml:"post_change,omitempty"`
+}
+
+// Apply methods for FileEntry.Method.
+const (
+	MethodSymlink = "symlink"
+	MethodCopy    = "copy"
+	// MethodBlock manages only the block between "# BEGIN synq:<name>" and
+	// "# END synq:<name>" in the target; the source holds the block content.
+	MethodBlock = "block"
+)
+
+// Merge formats for FileEntry.Merge.
+const (
+	MergeJSON = "json"
+	MergeYAML = "yaml"
+	MergeTOML = "toml"
+	MergeINI  = "ini"
+)
+
+// MergeFormats lists the formats FileEntry.Merge accepts.
+var MergeFormats = []string{MergeJSON, MergeYAML, MergeTOML, MergeINI}
+
+// DefaultBlockComment starts block markers unless an entry sets Comment.
+const DefaultBlockComment = "#"
+
+// ApplyMethod returns the entry's method, defaulting to symlink, or to
+// copy for entries with overlays.
+func (f FileEntry) ApplyMethod() string {
+	if f.Method == "" {
+		if len(f.Overlays) > 0 {
+			return MethodCopy
+		}
+		return MethodSymlink
+	}
+	return f.Method
+}
+
+// Overlay key prefixes for FileEntry.Overlays, in the order they apply.
+const (
+	OverlayOS      = "os:"
+	OverlayProfile = "profile:"
+	OverlayHost    = "host:"
+)
+
+// ValidateOverlays checks the keys of the entry's overlays.
+func (f FileEntry) ValidateOverlays() error {
+	for key := range f.Overlays {
+		prefix, name, ok := strings.Cut(key, ":")
+		if !ok || name == "" || (prefix+":" != OverlayOS && prefix+":" != OverlayProfile && prefix+":" != OverlayHost) {
+			return fmt.Errorf("overlay %q of %s: want os:<goos>, profile:<name> or host:<hostname>", key, f.Name)
+		}
+	}
+	if len(f.Overlays) > 0 && f.ApplyMethod() != MethodCopy {
+		return fmt.Errorf("%s: overlays need the copy method", f.Name)
+	}
+	return nil
+}
+
+// OverlayKeys returns the keys of the overlays that apply on this machine
+// with the active profiles, in the order they apply. A host overlay
+// matches the full or the short hostname.
+func (f FileEntry) OverlayKeys(profiles []string) []string {
+	if len(f.Overlays) == 0 {
+		return nil
+	}
+	var keys []string
+	add := func(key string) {
+		if _, ok := f.Overlays[key]; ok && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	add(OverlayOS + runtime.GOOS)
+	sorted := slices.Clone(profiles)
+	slices.Sort(sorted)
+	for _, p := range sorted {
+		add(OverlayProfile + p)
+	}
+	if host, err := os.Hostname(); err == nil {
+		short, _, _ := strings.Cut(host, ".")
+		add(OverlayHost + short)
+		add(OverlayHost + host)
+	}
+	return keys
+}
+
+// Block returns the markers of a block entry.
+func (f FileEntry) Block() fileops.Block {
+	comment := f.Comment
+	if comment == "" {
+		comment = DefaultBlockComment
+	}
+	return fileops.NewBlock(comment, f.Name)
+}
+
+// TargetKey identifies what the entry manages on this OS: its target, or
+// for a block entry the block inside it, so that blocks with different
+// names can share a file.
+func (f FileEntry) TargetKey() (string, bool) {
+	target, ok := fileops.ResolveTarget(f.Targets)
+	if ok && f.ApplyMethod() == MethodBlock {
+		target += "#synq:" + f.Name
+	}
+	return target, ok
+}
+
+// FileMode parses Mode. ok is false when no mode is recorded.
+func (f FileEntry) FileMode() (mode os.FileMode, ok bool, err error) {
+	if f.Mode == "" {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || n > 0o777 {
+		return 0, false, fmt.Errorf("invalid mode %q for %s", f.Mode, f.Name)
+	}
+	return os.FileMode(n), true, nil
+}
+
+// FormatMode formats a permission for FileEntry.Mode.
+func FormatMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// SourcePath returns the absolute path of the entry's file inside repoDir.
+func (f FileEntry) SourcePath(repoDir string) string {
+	return filepath.Join(repoDir, filepath.FromSlash(f.Source))
+}
+
+// ValidateSource checks that source is a clean relative path inside the repo.
+func ValidateSource(source string) error {
+	if source == "" {
+		return fmt.Errorf("source path is empty")
+	}
+	if strings.Contains(source, "\\") || path.IsAbs(source) || filepath.IsAbs(source) {
+		return fmt.Errorf("source %q must be a relative path using forward slashes", source)
+	}
+	clean := path.Clean(source)
+	if clean != source || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("source %q must be a clean path inside the repo", source)
+	}
+	if clean == RepoConfigFile || clean == ".git" || strings.HasPrefix(clean, ".git/") {
+		return fmt.Errorf("source %q is reserved", source)
+	}
+	return nil
+}
+
+// InProfiles reports whether something tagged with profiles applies on a
+// machine with the active profiles. An empty profiles list always applies.
+func InProfiles(profiles, active []string) bool {
+	if len(profiles) == 0 {
+		return true
+	}
+	for _, p := range profiles {
+		if slices.Contains(active, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveFiles returns the entries that apply with the active profiles,
+// with the overlays that apply on this machine.
+func (c *Config) ActiveFiles(active []string) []FileEntry {
+	var files []FileEntry
+	for _, f := range c.Files {
+		if InProfiles(f.Profiles, active) {
+			f.ActiveOverlays = f.OverlayKeys(active)
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Profiles returns every profile referenced by an entry or script, sorted.
+func (c *Config) Profiles() []string {
+	var all []string
+	for _, f := range c.Files {
+		all = append(all, f.Profiles...)
+	}
+	for _, s := range c.Scripts {
+		all = append(all, s.Profiles...)
+	}
+	slices.Sort(all)
+	return slices.Compact(all)
+}
+
+// FindFile returns the index of the entry with the given name, or -1.
+func (c *Config) FindFile(name string) int {
+	for i, f := range c.Files {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindSource returns the index of the entry stored at source, or -1.
+func (c *Config) FindSource(source string) int {
+	for i, f := range c.Files {
+		if f.Source == source {
+			return i
+		}
+	}
+	return -1
 }
 
 // LocalState is stored at ~/.config/synq/synq.yaml.
@@ -19,20 +348,187 @@ type LocalState struct {
 	RepoURL    string       `yaml:"repo_url"`
 	RepoPath   string       `yaml:"repo_path"`
 	Daemon     DaemonConfig `yaml:"daemon"`
+	Hooks      HooksConfig  `yaml:"hooks,omitempty"`
+	Scripts    ScriptConfig `yaml:"scripts,omitempty"`
+	// Profiles are the profiles active on this machine.
+	Profiles []string `yaml:"profiles,omitempty"`
+	// MachineID identifies this install in the repo's machine registry.
+	MachineID string `yaml:"machine_id,omitempty"`
+	// Sources are repos synced next to the default repo.
+	Sources []Source `yaml:"sources,omitempty"`
+	// Signing signs the commits synq makes and checks pulled ones.
+	Signing SigningConfig `yaml:"signing,omitempty"`
+	// Trust applies only the commits signed by trusted machines.
+	Trust TrustConfig `yaml:"trust,omitempty"`
+	// Peer syncs directly with machines on the local network.
+	Peer PeerConfig `yaml:"peer,omitempty"`
+}
+
+// PeerConfig lets machines fetch from each other without a git host.
+// Both sides of a connection authenticate with a TLS key, and accept only
+// the keys trusted here. Peers serve their repos read-only, so repos cloned
+// from a peer are only pulled.
+type PeerConfig struct {
+	// Listen is the host:port where the daemon serves this machine's
+	// repos to trusted peers; empty serves nothing.
+	Listen string `yaml:"listen,omitempty"`
+	// Peers are the machines trusted to connect, or to connect to, by
+	// name.
+	Peers map[string]Peer `yaml:"peers,omitempty"`
+}
+
+// Peer is a machine trusted to sync with this one.
+type Peer struct {
+	// Key is the fingerprint of the peer's key, "sha256//<base64>".
+	Key string `yaml:"key"`
+	// URL is where the peer serves its repos, if it does. Git remotes
+	// under it authenticate with this machine's key and accept only Key.
+	URL string `yaml:"url,omitempty"`
+}
+
+// Serving returns the name of the peer that serves url, or "" when none
+// does.
+func (c PeerConfig) Serving(url string) string {
+	for name, p := range c.Peers {
+		base := strings.TrimSuffix(p.URL, "/")
+		if base != "" && (url == base || strings.HasPrefix(url, base+"/")) {
+			return name
+		}
+	}
+	return ""
+}
+
+// TrustConfig holds pulled commits in quarantine unless a trusted machine
+// signed them. Machines publish their SSH signing keys in their heartbeats.
+type TrustConfig struct {
+	// Enabled signs commits with this machine's key and verifies pulled
+	// commits against the trusted keys, and those of Signing.AllowedSigners.
+	Enabled bool `yaml:"enabled"`
+	// Machines maps the IDs of trusted machines to their public keys.
+	Machines map[string]string `yaml:"machines,omitempty"`
+}
+
+// Signing formats for SigningConfig.Format.
+const (
+	SignSSH = "ssh"
+	SignGPG = "gpg"
+)
+
+// SigningConfig controls how commits are signed and verified on this
+// machine. Without a format, commits are signed only if git's own config
+// says so.
+type SigningConfig struct {
+	// Format is ssh or gpg.
+	Format string `yaml:"format,omitempty"`
+	// Key is the signing key: the path of an SSH key, or a GPG key ID.
+	// Empty uses git's user.signingKey.
+	Key string `yaml:"key,omitempty"`
+	// Verify refuses pulled commits without a good signature from an
+	// allowed key: a trusted GPG key, or one listed in AllowedSigners.
+	Verify bool `yaml:"verify,omitempty"`
+	// AllowedSigners is the SSH allowed signers file to verify against.
+	// Empty uses git's gpg.ssh.allowedSignersFile.
+	AllowedSigners string `yaml:"allowed_signers,omitempty"`
+}
+
+// Validate checks the signing format.
+func (s SigningConfig) Validate() error {
+	switch s.Format {
+	case "", SignSSH, SignGPG:
+	default:
+		return fmt.Errorf("signing format must be %s or %s, not %q", SignSSH, SignGPG, s.Format)
+	}
+	if s.Format == "" && s.Key != "" {
+		return fmt.Errorf("signing key %s needs a format, %s or %s", s.Key, SignSSH, SignGPG)
+	}
+	return nil
+}
+
+// ScriptConfig controls which scripts from the repo may run on this machine.
+type ScriptConfig struct {
+	Timeout string `yaml:"timeout,omitempty"`
+	// Trusted maps script names to the content hash that was reviewed and
+	// trusted on this machine.
+	Trusted map[string]string `yaml:"trusted,omitempty"`
+}
+
+// HooksConfig controls whether hooks from the repo may run on this machine.
+type HooksConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Timeout string `yaml:"timeout,omitempty"`
+	// Trusted maps entry names to the fingerprint of the hook commands
+	// that were reviewed and trusted on this machine.
+	Trusted map[string]string `yaml:"trusted,omitempty"`
 }
 
 // DaemonConfig holds daemon-specific settings.
 type DaemonConfig struct {
 	PollInterval string `yaml:"poll_interval"`
+	// HeartbeatInterval is how often the daemon records this machine in
+	// the repo. "0" disables heartbeats.
+	HeartbeatInterval string `yaml:"heartbeat_interval,omitempty"`
+	// MetricsListen enables the Prometheus endpoint at /metrics. It is a
+	// loopback host:port or unix:<socket path>; empty disables it.
+	MetricsListen string `yaml:"metrics_listen,omitempty"`
+	// Instance names the OS service that runs the daemon for this config
+	// dir; empty is the default service.
+	Instance string `yaml:"instance,omitempty"`
+	// Schedule limits when the daemon pulls and pushes.
+	Schedule ScheduleConfig `yaml:"schedule,omitempty"`
+	// Notify lets the daemon pull as soon as a remote changes.
+	Notify NotifyConfig `yaml:"notify,omitempty"`
+}
+
+// NotifyConfig tells the daemon when a remote may have changed, so it pulls
+// right away instead of on its next poll. Polling stays as the fallback.
+type NotifyConfig struct {
+	// CheckRemote asks the remote for its branch tip with git ls-remote
+	// and skips the pull when there is nothing new.
+	CheckRemote bool `yaml:"check_remote,omitempty"`
+	// WebhookListen is a host:port on which POST requests, such as a
+	// forge's push webhook, trigger a pull. Without WebhookSecret it must
+	// be a loopback address.
+	WebhookListen string `yaml:"webhook_listen,omitempty"`
+	// WebhookSecret authenticates webhook requests: GitHub's
+	// X-Hub-Signature-256, GitLab's X-Gitlab-Token or a token parameter.
+	WebhookSecret string `yaml:"webhook_secret,omitempty"`
+	// EventsURL is a server-sent events stream, such as an ntfy topic;
+	// every event triggers a pull.
+	EventsURL string `yaml:"events_url,omitempty"`
+	// PeerPort is a UDP port on which machines on the local network
+	// announce their pushes to each other by broadcast. 0 disables it.
+	PeerPort int `yaml:"peer_port,omitempty"`
+}
+
+// ScheduleConfig pauses the daemon's pulls and pushes. While paused, local
+// edits are still committed; they are pushed in one batch afterwards.
+type ScheduleConfig struct {
+	// QuietHours are daily windows in local time, such as "22:00-07:00".
+	QuietHours []string `yaml:"quiet_hours,omitempty"`
+	// PauseOnBattery pauses while the machine runs on battery.
+	PauseOnBattery bool `yaml:"pause_on_battery,omitempty"`
+	// PauseInterfaces pauses while a network interface whose name matches
+	// one of these patterns is up, such as a tethered phone.
+	PauseInterfaces []string `yaml:"pause_interfaces,omitempty"`
+	// MinPushInterval is the least time between two pushes, such as "15m".
+	MinPushInterval string `yaml:"min_push_interval,omitempty"`
 }
 
 // SyncStatus represents the status of a managed file.
 type SyncStatus string
 
 const (
-	StatusSynced   SyncStatus = "synced"
-	StatusModified SyncStatus = "modified"
-	StatusMissing  SyncStatus = "missing"
-	StatusUnlinked SyncStatus = "unlinked"
-	StatusNoTarget SyncStatus = "no target"
+	StatusSynced    SyncStatus = "synced"
+	StatusModified  SyncStatus = "modified"
+	StatusMissing   SyncStatus = "missing"
+	StatusUnlinked  SyncStatus = "unlinked"
+	StatusNoTarget  SyncStatus = "no target"
+	StatusModeDrift SyncStatus = "mode drift"
+	StatusInactive  SyncStatus = "inactive"
+	StatusShadowed  SyncStatus = "shadowed"
+	// The target and the repo changed since the target was last applied:
+	// only the target, only the repo, or both.
+	StatusLocalEdit  SyncStatus = "local edit"
+	StatusRemoteEdit SyncStatus = "remote edit"
+	StatusBothEdited SyncStatus = "both edited"
 )
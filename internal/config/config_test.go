@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"testing"
 )
 
@@ -42,6 +44,27 @@ func TestSaveAndLoadLocalState(t *testing.T) {
 	}
 }
 
+func TestSaveLocalStateIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	tmp := t.TempDir()
+	// Written by an older version, readable by everyone.
+	if err := os.WriteFile(LocalStatePath(tmp), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveLocalState(tmp, &LocalState{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(LocalStatePath(tmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("local state mode = %04o, want 0600", mode)
+	}
+}
+
 func TestSaveAndLoadRepoConfig(t *testing.T) {
 	tmp := t.TempDir()
 	// Create the "repo" subdirectory since RepoConfigPath expects it.
@@ -100,3 +123,113 @@ func TestDefaultConfigDir(t *testing.T) {
 		t.Error("expected non-empty config dir")
 	}
 }
+
+func TestValidateSource(t *testing.T) {
+	valid := []string{"starship.toml", "home/.config/git/config", "root/etc/hosts"}
+	for _, s := range valid {
+		if err := ValidateSource(s); err != nil {
+			t.Errorf("ValidateSource(%q) = %v, want nil", s, err)
+		}
+	}
+	invalid := []string{"", ".", "../escape", "home/../../x", "/abs/path", "home//x", ".git/config", "synq.yaml", `home\x`}
+	for _, s := range invalid {
+		if err := ValidateSource(s); err == nil {
+			t.Errorf("ValidateSource(%q) = nil, want error", s)
+		}
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	f := FileEntry{Name: "config", Source: "home/.config/git/config"}
+	got := f.SourcePath("/repo")
+	want := filepath.Join("/repo", "home", ".config", "git", "config")
+	if got != want {
+		t.Errorf("SourcePath() = %q, want %q", got, want)
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	mode, ok, err := FileEntry{Name: "ssh", Mode: "0600"}.FileMode()
+	if err != nil || !ok || mode != 0o600 {
+		t.Errorf("FileMode() = %o, %v, %v; want 600, true, nil", mode, ok, err)
+	}
+	if _, ok, err := (FileEntry{Name: "x"}).FileMode(); ok || err != nil {
+		t.Errorf("FileMode() without mode = %v, %v; want false, nil", ok, err)
+	}
+	if _, _, err := (FileEntry{Name: "x", Mode: "rw-r--r--"}).FileMode(); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+	if got := FormatMode(0o600); got != "0600" {
+		t.Errorf("FormatMode(0600) = %q", got)
+	}
+}
+
+func TestScriptValidate(t *testing.T) {
+	valid := Script{Name: "fonts", Source: "scripts/fonts.sh", Run: RunOnce}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	invalid := []Script{
+		{Source: "a.sh", Run: RunOnce},
+		{Name: "both", Source: "a.sh", Command: "true", Run: RunOnce},
+		{Name: "neither", Run: RunOnce},
+		{Name: "badrun", Command: "true", Run: "weekly"},
+		{Name: "escape", Source: "../a.sh", Run: RunOnce},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", s)
+		}
+	}
+}
+
+func TestSigningConfigValidate(t *testing.T) {
+	valid := []SigningConfig{
+		{},
+		{Verify: true},
+		{Format: SignSSH, Key: "~/.ssh/id_ed25519.pub", AllowedSigners: "~/.ssh/allowed_signers"},
+		{Format: SignGPG},
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v", s, err)
+		}
+	}
+	invalid := []SigningConfig{
+		{Format: "x509"},
+		{Key: "ABCD1234"},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", s)
+		}
+	}
+}
+
+func TestActiveFiles(t *testing.T) {
+	cfg := &Config{
+		Files: []FileEntry{
+			{Name: "zshrc"},
+			{Name: "ssh", Profiles: []string{"personal"}},
+			{Name: "kitty", Profiles: []string{"gui", "personal"}},
+		},
+		Scripts: []Script{{Name: "fonts", Profiles: []string{"gui"}}},
+	}
+
+	names := func(files []FileEntry) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.Name)
+		}
+		return out
+	}
+	if got := names(cfg.ActiveFiles(nil)); !slices.Equal(got, []string{"zshrc"}) {
+		t.Errorf("ActiveFiles(nil) = %v", got)
+	}
+	if got := names(cfg.ActiveFiles([]string{"gui"})); !slices.Equal(got, []string{"zshrc", "kitty"}) {
+		t.Errorf("ActiveFiles(gui) = %v", got)
+	}
+	if got := cfg.Profiles(); !slices.Equal(got, []string{"gui", "personal"}) {
+		t.Errorf("Profiles() = %v", got)
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile reads the config file at rel inside repoDir and merges
+// the entries and scripts of its includes. A missing file is an empty
+// config.
+func LoadConfigFile(repoDir, rel string) (*Config, error) {
+	cfg, err := readConfigFile(repoDir, rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := mergeIncludes(repoDir, cfg, []string{rel}); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func readConfigFile(repoDir, rel string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(rel)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", rel, err)
+	}
+	return &cfg, nil
+}
+
+// mergeIncludes appends the entries and scripts of cfg's includes, and of
+// theirs, that cfg does not already define by name. stack holds the files
+// being read, to catch include cycles.
+func mergeIncludes(repoDir string, cfg *Config, stack []string) error {
+	for _, inc := range cfg.Include {
+		if err := ValidateSource(inc); err != nil {
+			return fmt.Errorf("include: %w", err)
+		}
+		if slices.Contains(stack, inc) {
+			return fmt.Errorf("include cycle: %s includes %s", stack[len(stack)-1], inc)
+		}
+		if _, err := os.Stat(filepath.Join(repoDir, filepath.FromSlash(inc))); err != nil {
+			return fmt.Errorf("include %s: %w", inc, err)
+		}
+		sub, err := readConfigFile(repoDir, inc)
+		if err != nil {
+			return err
+		}
+		if len(sub.Extends) > 0 {
+			return fmt.Errorf("include %s: extends is only allowed in the top-level config", inc)
+		}
+		if err := mergeIncludes(repoDir, sub, append(stack, inc)); err != nil {
+			return err
+		}
+		for _, f := range sub.Files {
+			if cfg.FindFile(f.Name) != -1 {
+				continue
+			}
+			if f.Include == "" {
+				f.Include = inc
+			}
+			cfg.Files = append(cfg.Files, f)
+		}
+		for _, s := range sub.Scripts {
+			if slices.ContainsFunc(cfg.Scripts, func(o Script) bool { return o.Name == s.Name }) {
+				continue
+			}
+			if s.Include == "" {
+				s.Include = inc
+			}
+			cfg.Scripts = append(cfg.Scripts, s)
+		}
+	}
+	return nil
+}
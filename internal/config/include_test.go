@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		RepoConfigFile: `include: [base/shell.yaml, base/git.yaml]
+files:
+  - name: zshrc
+    source: personal/zshrc
+`,
+		"base/shell.yaml": `include: [base/common.yaml]
+files:
+  - name: zshrc
+    source: base/zshrc
+  - name: bashrc
+    source: base/bashrc
+scripts:
+  - name: brew
+    path: scripts/brew.sh
+`,
+		"base/git.yaml": `files:
+  - name: bashrc
+    source: base/other-bashrc
+  - name: gitconfig
+    source: base/gitconfig
+`,
+		"base/common.yaml": `files:
+  - name: inputrc
+    source: base/inputrc
+`,
+	})
+
+	cfg, err := LoadRepoConfigIn(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ name, source, include string }{
+		{"zshrc", "personal/zshrc", ""},
+		{"bashrc", "base/bashrc", "base/shell.yaml"},
+		{"inputrc", "base/inputrc", "base/common.yaml"},
+		{"gitconfig", "base/gitconfig", "base/git.yaml"},
+	}
+	if len(cfg.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(cfg.Files), len(want), cfg.Files)
+	}
+	for i, w := range want {
+		f := cfg.Files[i]
+		if f.Name != w.name || f.Source != w.source || f.Include != w.include {
+			t.Errorf("Files[%d] = %s %s %q, want %s %s %q", i, f.Name, f.Source, f.Include, w.name, w.source, w.include)
+		}
+	}
+	if len(cfg.Scripts) != 1 || cfg.Scripts[0].Include != "base/shell.yaml" {
+		t.Errorf("Scripts = %+v", cfg.Scripts)
+	}
+
+	// Saving keeps included entries out of synq.yaml.
+	if err := SaveRepoConfigIn(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	own, err := readConfigFile(dir, RepoConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(own.Files) != 1 || len(own.Scripts) != 0 || len(own.Include) != 2 {
+		t.Errorf("saved config = %+v", own)
+	}
+}
+
+func TestLoadIncludesErrors(t *testing.T) {
+	tests := map[string]struct {
+		files map[string]string
+		want  string
+	}{
+		"cycle": {
+			files: map[string]string{
+				RepoConfigFile: "include: [a.yaml]\n",
+				"a.yaml":       "include: [b.yaml]\n",
+				"b.yaml":       "include: [a.yaml]\n",
+			},
+			want: "include cycle",
+		},
+		"missing": {
+			files: map[string]string{RepoConfigFile: "include: [nope.yaml]\n"},
+			want:  "include nope.yaml",
+		},
+		"outside repo": {
+			files: map[string]string{RepoConfigFile: "include: [../x.yaml]\n"},
+			want:  "include:",
+		},
+		"extends in include": {
+			files: map[string]string{
+				RepoConfigFile: "include: [a.yaml]\n",
+				"a.yaml":       "extends: [{repo: git@example.com:team/base.git}]\n",
+			},
+			want: "only allowed in the top-level config",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			_, err := LoadRepoConfigIn(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadRepoConfigIn() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
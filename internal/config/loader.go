@@ -9,9 +9,12 @@ import (
 )
 
 const (
-	DefaultRepoName     = "synq-config"
-	DefaultPollInterval = "5m"
-	RepoConfigFile      = "synq.yaml"
+	DefaultRepoName      = "synq-config"
+	DefaultPollInterval  = "5m"
+	DefaultHookTimeout   = "30s"
+	DefaultScriptTimeout = "10m"
+	DefaultHeartbeat     = "1h"
+	RepoConfigFile       = "synq.yaml"
 )
 
 // DefaultConfigDir returns ~/.config/synq.
@@ -48,7 +51,8 @@ func LoadLocalState(configDir string) (*LocalState, error) {
 	return &state, nil
 }
 
-// SaveLocalState writes the local state file.
+// SaveLocalState writes the local state file. Only the owner can read it,
+// since it may hold secrets such as the webhook secret.
 func SaveLocalState(configDir string, state *LocalState) error {
 	if err := os.MkdirAll(configDir, 0o755); err != nil {
 		return err
@@ -57,34 +61,22 @@ func SaveLocalState(configDir string, state *LocalState) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(LocalStatePath(configDir), data, 0o644)
+	path := LocalStatePath(configDir)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file written by an older version.
+	return os.Chmod(path, 0o600)
 }
 
 // LoadRepoConfig reads synq.yaml from the cloned repo.
 func LoadRepoConfig(configDir string) (*Config, error) {
-	path := RepoConfigPath(configDir)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &Config{}, nil
-		}
-		return nil, err
-	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
-	}
-	return &cfg, nil
+	return LoadRepoConfigIn(RepoDir(configDir))
 }
 
 // SaveRepoConfig writes synq.yaml to the cloned repo.
 func SaveRepoConfig(configDir string, cfg *Config) error {
-	path := RepoConfigPath(configDir)
-	data, err := yaml.Marshal(cfg)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(path, data, 0o644)
+	return SaveRepoConfigIn(RepoDir(configDir), cfg)
 }
 
 // ExpandRepoPath expands the repo_path field from local state.
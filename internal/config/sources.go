@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSource names the repo created by synq setup.
+const DefaultSource = "default"
+
+// SourcesDir holds the clones of named sources inside the config dir.
+const SourcesDir = "sources"
+
+// Source is an additional repo synced on this machine, such as a
+// team-shared repo next to personal dotfiles.
+type Source struct {
+	Name    string `yaml:"name"`
+	RepoURL string `yaml:"repo_url"`
+	// PollInterval overrides daemon.poll_interval for this source.
+	PollInterval string `yaml:"poll_interval,omitempty"`
+}
+
+// Repo is a cloned repo synced on this machine: the default repo from
+// setup or a named source.
+type Repo struct {
+	Name         string
+	Dir          string
+	URL          string
+	PollInterval string
+	// Peer names the peer the repo is cloned from, if any. Peers serve
+	// repos read-only, so such a repo is pulled but never committed to
+	// or pushed.
+	Peer string
+}
+
+var sourceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateSourceName checks that name can name a source and its clone.
+func ValidateSourceName(name string) error {
+	if name == DefaultSource {
+		return fmt.Errorf("source name %q is reserved", name)
+	}
+	if !sourceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid source name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// SourceDir returns the clone of the named source.
+func SourceDir(configDir, name string) string {
+	if name == "" || name == DefaultSource {
+		return RepoDir(configDir)
+	}
+	return filepath.Join(configDir, SourcesDir, name)
+}
+
+// Repos returns the default repo followed by the named sources, in the
+// order they were added. That order decides which repo keeps a target
+// claimed by more than one.
+func (s *LocalState) Repos(configDir string) []Repo {
+	repos := []Repo{{
+		Name:         DefaultSource,
+		Dir:          RepoDir(configDir),
+		URL:          s.RepoURL,
+		PollInterval: s.Daemon.PollInterval,
+		Peer:         s.Peer.Serving(s.RepoURL),
+	}}
+	for _, src := range s.Sources {
+		poll := src.PollInterval
+		if poll == "" {
+			poll = s.Daemon.PollInterval
+		}
+		repos = append(repos, Repo{
+			Name:         src.Name,
+			Dir:          SourceDir(configDir, src.Name),
+			URL:          src.RepoURL,
+			PollInterval: poll,
+			Peer:         s.Peer.Serving(src.RepoURL),
+		})
+	}
+	return repos
+}
+
+// Repo returns the repo with the given name; "" is the default repo.
+func (s *LocalState) Repo(configDir, name string) (Repo, error) {
+	if name == "" {
+		name = DefaultSource
+	}
+	for _, r := range s.Repos(configDir) {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return Repo{}, fmt.Errorf("unknown source %q; see 'synq source list'", name)
+}
+
+// FindSource returns the index of the named source, or -1.
+func (s *LocalState) FindSource(name string) int {
+	for i, src := range s.Sources {
+		if src.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadRepoConfigIn reads synq.yaml from repoDir, merging its includes.
+func LoadRepoConfigIn(repoDir string) (*Config, error) {
+	return LoadConfigFile(repoDir, RepoConfigFile)
+}
+
+// SaveRepoConfigIn writes synq.yaml to repoDir. Entries and scripts merged
+// from includes are left out.
+func SaveRepoConfigIn(repoDir string, cfg *Config) error {
+	own := *cfg
+	own.Files = slices.DeleteFunc(slices.Clone(cfg.Files), func(f FileEntry) bool { return f.Include != "" })
+	own.Scripts = slices.DeleteFunc(slices.Clone(cfg.Scripts), func(s Script) bool { return s.Include != "" })
+	if own.Files == nil {
+		own.Files = []FileEntry{}
+	}
+	data, err := yaml.Marshal(&own)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(repoDir, RepoConfigFile), data, 0o644)
+}
+
+// Claim is an active entry that owns a target on this OS.
+type Claim struct {
+	Repo string
+	Name string
+}
+
+// Shadowed returns the entries in files, from the named repo, whose target
+// on this OS is already claimed by an active entry of a repo listed before
+// it, keyed by entry name. Those entries are not applied here.
+func Shadowed(configDir string, state *LocalState, repo string, files []FileEntry) (map[string]Claim, error) {
+	claims := map[string]Claim{}
+	for _, r := range state.Repos(configDir) {
+		if r.Name == repo {
+			break
+		}
+		cfg, err := LoadRepoConfigIn(r.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("load %s config: %w", r.Name, err)
+		}
+		for _, f := range cfg.ActiveFiles(state.Profiles) {
+			if target, ok := f.TargetKey(); ok {
+				if _, taken := claims[target]; !taken {
+					claims[target] = Claim{Repo: r.Name, Name: f.Name}
+				}
+			}
+		}
+	}
+
+	shadowed := map[string]Claim{}
+	for _, f := range files {
+		if target, ok := f.TargetKey(); ok {
+			if c, taken := claims[target]; taken {
+				shadowed[f.Name] = c
+			}
+		}
+	}
+	return shadowed, nil
+}
+
+// RepoFiles returns the entries of the named repo that apply on this
+// machine: those in an active profile whose target no earlier repo claims.
+// The entries left out because of a claim are returned too. If the claims
+// cannot be read, every active entry is returned with the error.
+func RepoFiles(configDir string, state *LocalState, repo string, cfg *Config) ([]FileEntry, map[string]Claim, error) {
+	active := cfg.ActiveFiles(state.Profiles)
+	shadowed, err := Shadowed(configDir, state, repo, active)
+	if err != nil || len(shadowed) == 0 {
+		return active, nil, err
+	}
+	files := make([]FileEntry, 0, len(active))
+	for _, f := range active {
+		if _, ok := shadowed[f.Name]; !ok {
+			files = append(files, f)
+		}
+	}
+	return files, shadowed, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRepos(t *testing.T) {
+	state := &LocalState{
+		RepoURL: "git@example.com:me/synq-config.git",
+		Daemon:  DaemonConfig{PollInterval: "5m"},
+		Sources: []Source{
+			{Name: "team", RepoURL: "git@example.com:team/dotfiles.git", PollInterval: "1h"},
+			{Name: "work", RepoURL: "git@example.com:work/dotfiles.git"},
+		},
+	}
+	repos := state.Repos("/cfg")
+	if len(repos) != 3 {
+		t.Fatalf("Repos() = %d repos, want 3", len(repos))
+	}
+	want := []Repo{
+		{Name: DefaultSource, Dir: filepath.Join("/cfg", "repo"), URL: state.RepoURL, PollInterval: "5m"},
+		{Name: "team", Dir: filepath.Join("/cfg", SourcesDir, "team"), URL: "git@example.com:team/dotfiles.git", PollInterval: "1h"},
+		{Name: "work", Dir: filepath.Join("/cfg", SourcesDir, "work"), URL: "git@example.com:work/dotfiles.git", PollInterval: "5m"},
+	}
+	for i := range want {
+		if repos[i] != want[i] {
+			t.Errorf("Repos()[%d] = %+v, want %+v", i, repos[i], want[i])
+		}
+	}
+
+	if r, err := state.Repo("/cfg", ""); err != nil || r.Name != DefaultSource {
+		t.Errorf(`Repo("") = %+v, %v`, r, err)
+	}
+	if _, err := state.Repo("/cfg", "missing"); err == nil {
+		t.Error(`Repo("missing") = nil error`)
+	}
+}
+
+func TestReposFromPeer(t *testing.T) {
+	state := &LocalState{
+		RepoURL: "git@example.com:me/synq-config.git",
+		Peer: PeerConfig{Peers: map[string]Peer{
+			"laptop":  {Key: "sha256//a", URL: "https://laptop.local:7420/"},
+			"desktop": {Key: "sha256//b"},
+		}},
+		Sources: []Source{
+			{Name: "laptop", RepoURL: "https://laptop.local:7420/repo"},
+			{Name: "other", RepoURL: "https://laptop.local:74200/repo"},
+		},
+	}
+	var peers []string
+	for _, r := range state.Repos("/cfg") {
+		peers = append(peers, r.Peer)
+	}
+	if want := []string{"", "laptop", ""}; strings.Join(peers, ",") != strings.Join(want, ",") {
+		t.Errorf("Repos() peers = %q, want %q", peers, want)
+	}
+}
+
+func TestValidateSourceName(t *testing.T) {
+	for _, name := range []string{"team", "work-2", "a_b"} {
+		if err := ValidateSourceName(name); err != nil {
+			t.Errorf("ValidateSourceName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", DefaultSource, "Team", "-x", "a/b", ".."} {
+		if err := ValidateSourceName(name); err == nil {
+			t.Errorf("ValidateSourceName(%q) = nil, want error", name)
+		}
+	}
+}
+
+func TestRepoFiles(t *testing.T) {
+	configDir := t.TempDir()
+	state := &LocalState{Sources: []Source{{Name: "team"}}}
+	target := func(p string) map[string]string { return map[string]string{runtime.GOOS: p} }
+
+	personal := &Config{Files: []FileEntry{
+		{Name: "gitconfig", Source: "home/.gitconfig", Targets: target("/home/me/.gitconfig")},
+		{Name: "ssh", Source: "home/.ssh/config", Targets: target("/home/me/.ssh/config"), Profiles: []string{"personal"}},
+	}}
+	team := &Config{Files: []FileEntry{
+		{Name: "gitconfig", Source: "git/config", Targets: target("/home/me/.gitconfig")},
+		{Name: "ssh", Source: "ssh/config", Targets: target("/home/me/.ssh/config")},
+		{Name: "editorconfig", Source: "editorconfig", Targets: target("/home/me/.editorconfig")},
+	}}
+	for _, dir := range []string{RepoDir(configDir), SourceDir(configDir, "team")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveRepoConfig(configDir, personal); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveRepoConfigIn(SourceDir(configDir, "team"), team); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default repo comes first, so it keeps every target.
+	files, shadowed, err := RepoFiles(configDir, state, DefaultSource, personal)
+	if err != nil || len(files) != 1 || len(shadowed) != 0 {
+		t.Errorf("RepoFiles(default) = %v, %v, %v", files, shadowed, err)
+	}
+
+	// The inactive ssh entry does not claim its target.
+	files, shadowed, err = RepoFiles(configDir, state, "team", team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "ssh" || files[1].Name != "editorconfig" {
+		t.Errorf("RepoFiles(team) files = %v", files)
+	}
+	if c, ok := shadowed["gitconfig"]; !ok || c != (Claim{Repo: DefaultSource, Name: "gitconfig"}) || len(shadowed) != 1 {
+		t.Errorf("RepoFiles(team) shadowed = %v", shadowed)
+	}
+}
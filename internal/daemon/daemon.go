@@ -1,24 +1,52 @@
 package daemon
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/ihavespoons/synq/internal/apply"
 	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/events"
 	"github.com/ihavespoons/synq/internal/fileops"
 	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/hooks"
+	"github.com/ihavespoons/synq/internal/ignore"
+	"github.com/ihavespoons/synq/internal/layers"
 	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/merge"
+	"github.com/ihavespoons/synq/internal/metrics"
+	"github.com/ihavespoons/synq/internal/trust"
+	"github.com/rs/zerolog"
 )
 
 // Run starts the daemon main loop. It blocks until a signal is received.
-func Run(configDir string) error {
+// version is reported in this machine's heartbeat.
+func Run(configDir, version string) error {
 	log := logger.Get()
 	log.Info().Msg("synq daemon starting")
 
+	// Hold the lock for the whole process lifetime so that two daemons
+	// never auto-commit the same repo.
+	lock, err := acquireLockWait(configDir)
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			if pid, _ := ReadPID(configDir); pid != 0 {
+				return fmt.Errorf("%w (PID %d)", err, pid)
+			}
+		}
+		return err
+	}
+	defer func() { _ = lock.Release() }()
+
 	// Write PID file.
 	if err := WritePID(configDir); err != nil {
 		return fmt.Errorf("write PID: %w", err)
@@ -29,114 +57,619 @@ func Run(configDir string) error {
 	if err != nil {
 		return fmt.Errorf("load local state: %w", err)
 	}
+	sched, err := NewSchedule(state.Daemon.Schedule)
+	if err != nil {
+		return fmt.Errorf("daemon schedule: %w", err)
+	}
+
+	// One loop per repo, the default repo first. m is assigned before any
+	// watcher starts.
+	var (
+		m     *daemonMetrics
+		loops []*repoLoop
+	)
+	for _, repo := range state.Repos(configDir) {
+		l, err := newRepoLoop(configDir, repo, sched, func() *daemonMetrics { return m })
+		if err != nil {
+			return err
+		}
+		defer l.close()
+		loops = append(loops, l)
+	}
+
+	m = newMetrics(loops)
+	gitops.SetObserver(m.observeGit)
+	if addr := state.Daemon.MetricsListen; addr != "" {
+		l, err := metrics.Listen(addr)
+		if err != nil {
+			return fmt.Errorf("metrics listener: %w", err)
+		}
+		srv := metrics.Serve(l, m.reg)
+		defer func() { _ = srv.Close() }()
+		log.Info().Str("addr", addr).Msg("serving metrics")
+	}
+
+	// Signal handling.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	repoDir := config.RepoDir(configDir)
-	pollInterval, err := time.ParseDuration(state.Daemon.PollInterval)
+	stopNotify, err := startNotify(ctx, configDir, state.Daemon.Notify, loops)
 	if err != nil {
-		pollInterval = 5 * time.Minute
+		return fmt.Errorf("daemon notify: %w", err)
 	}
+	defer stopNotify()
 
-	// Set up file watcher.
-	onChange := func() {
-		log.Info().Msg("file change detected, syncing")
-		if err := gitops.CommitAndPush(repoDir, "Auto-sync: file changed"); err != nil {
-			log.Error().Err(err).Msg("auto-sync failed")
+	if state.Peer.Listen != "" {
+		srv, err := servePeers(configDir, state.Peer, loops)
+		if err != nil {
+			return fmt.Errorf("serve peers: %w", err)
 		}
+		defer func() { _ = srv.Close() }()
+		log.Info().Str("addr", state.Peer.Listen).Msg("serving repos to peers")
 	}
 
-	watcher, err := NewWatcher(onChange, log)
+	for _, l := range loops {
+		l.refreshWatcher()
+		l.watcher.Start()
+	}
+
+	// Named sources poll on their own; the default repo polls here and
+	// carries this machine's heartbeat, unless it is pulled from a peer.
+	var wg sync.WaitGroup
+	for _, l := range loops[1:] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.run(ctx, nil)
+		}()
+	}
+	var beat *heartbeat
+	if loops[0].repo.Peer == "" {
+		beat = newHeartbeat(configDir, version, state)
+	}
+	loops[0].run(ctx, beat)
+	wg.Wait()
+
+	log.Info().Msg("shutting down")
+	return nil
+}
+
+// repoLoop syncs one repo: it auto-commits watched changes and pulls on the
+// repo's poll interval.
+type repoLoop struct {
+	configDir string
+	repo      config.Repo
+	log       zerolog.Logger
+	watcher   *Watcher
+	metrics   func() *daemonMetrics
+	sched     *Schedule
+
+	// wake makes run poll before the next tick.
+	wake chan struct{}
+	// startNotify sets the fields below before the watcher starts. peers
+	// announces pushes to the local network under peerKey; it is nil when
+	// announcements are off.
+	checkRemote bool
+	peers       *peers
+	peerKey     string
+
+	// pushMu guards the fields below, shared by the watcher's callbacks
+	// and the poll loop.
+	pushMu   sync.Mutex
+	lastPush time.Time
+	// flush pushes the commits the schedule held back; nil when none are.
+	flush *time.Timer
+	// pause is why the schedule last paused the loop, to log changes.
+	pause string
+}
+
+func newRepoLoop(configDir string, repo config.Repo, sched *Schedule, m func() *daemonMetrics) (*repoLoop, error) {
+	l := &repoLoop{
+		configDir: configDir,
+		repo:      repo,
+		log:       logger.Get().With().Str("source", repo.Name).Logger(),
+		metrics:   m,
+		sched:     sched,
+		wake:      make(chan struct{}, 1),
+	}
+	watcher, err := NewWatcher(l.onChange, &l.log)
 	if err != nil {
-		return fmt.Errorf("create watcher: %w", err)
+		return nil, fmt.Errorf("create watcher: %w", err)
 	}
-	defer func() { _ = watcher.Close() }()
+	l.watcher = watcher
+	return l, nil
+}
 
-	// Initial watch setup.
-	refreshWatcher(configDir, watcher)
-	watcher.Start()
+func (l *repoLoop) close() {
+	_ = l.watcher.Close()
+	l.pushMu.Lock()
+	if l.flush != nil {
+		l.flush.Stop()
+	}
+	l.pushMu.Unlock()
+}
 
-	// Poll ticker.
+// onChange commits and pushes local edits after a debounced file change.
+func (l *repoLoop) onChange() {
+	repoDir := l.repo.Dir
+	m := l.metrics()
+	if l.repo.Peer != "" {
+		l.log.Debug().Str("peer", l.repo.Peer).Msg("file change detected; not committed, since the repo is pulled from a peer")
+		return
+	}
+	l.log.Info().Msg("file change detected, syncing")
+	m.triggers.Inc()
+	cfg, err := config.LoadRepoConfigIn(repoDir)
+	if err != nil {
+		l.log.Error().Err(err).Msg("load repo config for auto-sync")
+		return
+	}
+	l.logResults(apply.Capture(repoDir, l.activeFiles(cfg), l.applyState()))
+	matcher, err := ignore.ForRepo(repoDir, cfg.Files)
+	if err != nil {
+		l.log.Error().Err(err).Msg("load ignore patterns")
+		return
+	}
+	if !gitops.HasChanges(repoDir, matcher.Ignored) {
+		return
+	}
+	const message = "Auto-sync: file changed"
+	committed, err := commit(repoDir, message, matcher.Ignored)
+	m.phase(phaseCommit, err)
+	if err != nil || !committed {
+		if err != nil {
+			l.log.Error().Err(err).Msg("auto-sync commit failed")
+			l.record(events.Event{Type: events.Failed, Name: "commit", Message: err.Error()})
+		}
+		return
+	}
+	l.push(message)
+}
+
+// push pushes local commits. While the schedule holds pushes back, they
+// stay committed locally and are pushed in one batch once it allows. Repos
+// pulled from a peer are never pushed.
+func (l *repoLoop) push(message string) {
+	if l.repo.Peer != "" {
+		return
+	}
+	l.pushMu.Lock()
+	defer l.pushMu.Unlock()
+	now := time.Now()
+	if reason, retry := l.paused(now); reason != "" {
+		l.holdPush(retry)
+		return
+	}
+	if wait := l.sched.PushWait(now, l.lastPush); wait > 0 {
+		l.log.Debug().Dur("wait", wait).Msg("holding back push for the minimum push interval")
+		l.holdPush(wait)
+		return
+	}
+	err := gitops.Push(l.repo.Dir)
+	l.metrics().phase(phasePush, err)
+	if err != nil {
+		l.log.Error().Err(err).Msg("auto-sync push failed")
+		l.record(events.Event{Type: events.Failed, Name: "push", Message: err.Error()})
+		return
+	}
+	l.lastPush = now
+	l.record(events.Event{Type: events.Pushed, Message: message})
+	if l.peers != nil {
+		if err := l.peers.announce(l.peerKey); err != nil {
+			l.log.Debug().Err(err).Msg("announce push to peers")
+		}
+	}
+}
+
+// holdPush arranges for the pending commits to be pushed after d, unless
+// that is arranged already. pushMu must be held.
+func (l *repoLoop) holdPush(d time.Duration) {
+	if l.flush != nil {
+		return
+	}
+	l.flush = time.AfterFunc(d, func() {
+		l.pushMu.Lock()
+		l.flush = nil
+		l.pushMu.Unlock()
+		l.pushPending("Auto-sync: pushed held-back changes")
+	})
+}
+
+// paused reports why the schedule pauses the loop at now, and when to
+// check again, logging when a pause starts or ends. pushMu must be held.
+func (l *repoLoop) paused(now time.Time) (string, time.Duration) {
+	reason, retry := l.sched.Paused(now)
+	if reason != l.pause {
+		if reason != "" {
+			l.log.Info().Str("reason", reason).Msg("pausing pulls and pushes; changes are committed locally")
+		} else {
+			l.log.Info().Msg("pause over; resuming pulls and pushes")
+		}
+		l.pause = reason
+	}
+	return reason, retry
+}
+
+// wakeUp makes the loop poll now, unless it is due to already.
+func (l *repoLoop) wakeUp() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run pulls and applies the repo on every poll tick until ctx is done. beat
+// is nil for repos that do not carry the heartbeat.
+func (l *repoLoop) run(ctx context.Context, beat *heartbeat) {
+	pollInterval, err := time.ParseDuration(l.repo.PollInterval)
+	if err != nil || pollInterval <= 0 {
+		pollInterval = 5 * time.Minute
+	}
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
-	// Signal handling.
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	log.Info().Str("poll_interval", pollInterval.String()).Msg("daemon running")
+	l.log.Info().Str("poll_interval", pollInterval.String()).Msg("daemon running")
+	if l.repo.Peer != "" {
+		l.log.Info().Str("peer", l.repo.Peer).Msg("pulling only: the peer serves this repo read-only, so local edits are not committed")
+	}
 
 	for {
 		select {
 		case <-ticker.C:
-			log.Debug().Msg("poll tick: pulling changes")
-			changed, err := gitops.Pull(repoDir)
+			l.poll(beat)
+		case <-l.wake:
+			l.log.Debug().Msg("notified of remote changes")
+			l.poll(beat)
+			ticker.Reset(pollInterval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *repoLoop) poll(beat *heartbeat) {
+	repoDir := l.repo.Dir
+	m := l.metrics()
+	l.pushMu.Lock()
+	reason, _ := l.paused(time.Now())
+	l.pushMu.Unlock()
+	if reason != "" {
+		l.log.Debug().Str("reason", reason).Msg("poll tick: paused")
+		return
+	}
+	l.log.Debug().Msg("poll tick: pulling changes")
+	l.installMergeDriver()
+	before, _ := gitops.Head(repoDir)
+	changed, err := l.pull()
+	m.phase(phasePull, err)
+	if err != nil {
+		if held, herr := trust.Hold(l.configDir, l.repo.Name, err); herr != nil {
+			l.log.Warn().Err(herr).Msg("record quarantine")
+		} else if held {
+			l.log.Warn().Err(err).Msg("holding untrusted commits in quarantine")
+		} else {
+			l.log.Error().Err(err).Msg("pull failed")
+		}
+		if beat != nil {
+			beat.failed(err)
+		}
+		l.record(events.PullFailure(err))
+	} else {
+		if err := trust.Release(l.configDir, l.repo.Name); err != nil {
+			l.log.Warn().Err(err).Msg("release quarantine")
+		}
+		l.pushPending("Auto-sync: pushed rebased changes")
+		if beat != nil {
+			beat.synced(repoDir)
+		}
+		ok := true
+		if changed {
+			l.log.Info().Msg("remote changes found, applying files")
+			after, _ := gitops.Head(repoDir)
+			l.record(events.Event{Type: events.Pulled, Data: map[string]string{"from": before, "to": after}})
+			paths, err := gitops.ChangedFiles(repoDir, before, after)
 			if err != nil {
-				log.Error().Err(err).Msg("pull failed")
-				continue
+				l.log.Warn().Err(err).Msg("could not list pulled changes")
 			}
-			if changed {
-				log.Info().Msg("remote changes found, applying symlinks")
-				applySymlinks(configDir)
-				refreshWatcher(configDir, watcher)
+			results := l.applyEntries(apply.ChangedFunc(paths))
+			ok = m.applied(results)
+			if beat != nil {
+				beat.applied(results)
 			}
+			l.refreshWatcher()
+			l.record(events.Event{Type: events.Synced})
+		} else {
+			l.enforceModes()
+		}
+		if results := l.syncLayers(changed); results != nil {
+			ok = m.applied(results) && ok
+		}
+		if ok {
+			m.lastSuccess.Set(float64(time.Now().Unix()))
+		}
+	}
+	if beat != nil {
+		committed, err := beat.beat(time.Now())
+		if err != nil {
+			l.log.Warn().Err(err).Msg("heartbeat failed")
+		}
+		if committed {
+			l.push("Heartbeat")
+		}
+	}
+}
 
-		case sig := <-sigCh:
-			log.Info().Str("signal", sig.String()).Msg("shutting down")
-			return nil
+// pull pulls the repo and reports whether it changed. With check_remote
+// on, it asks the remote first and skips the fetch when nothing is new.
+func (l *repoLoop) pull() (bool, error) {
+	if l.checkRemote {
+		upToDate, err := gitops.UpToDate(l.repo.Dir)
+		if err == nil && upToDate {
+			return false, nil
+		}
+		if err != nil {
+			l.log.Debug().Err(err).Msg("check remote; pulling anyway")
 		}
 	}
+	return gitops.Pull(l.repo.Dir)
 }
 
-func refreshWatcher(configDir string, watcher *Watcher) {
-	log := logger.Get()
-	cfg, err := config.LoadRepoConfig(configDir)
+// pushPending pushes commits left behind by an auto-sync push that was
+// rejected because the remote had moved on, which the pull rebased, or
+// that the schedule held back.
+func (l *repoLoop) pushPending(message string) {
+	if n, err := gitops.Unpushed(l.repo.Dir); err != nil || n == 0 {
+		return
+	}
+	l.push(message)
+}
+
+// installMergeDriver keeps git's merge driver settings in step with the
+// entries' merge formats, so the pull merges them key by key.
+func (l *repoLoop) installMergeDriver() {
+	cfg, err := config.LoadRepoConfigIn(l.repo.Dir)
+	if err != nil {
+		return
+	}
+	binary, err := os.Executable()
+	if err == nil {
+		err = merge.Install(l.repo.Dir, cfg.Files, binary)
+	}
+	if err != nil {
+		l.log.Warn().Err(err).Msg("configure merge driver")
+	}
+}
+
+// commit stages everything not rejected by skip and commits it.
+func commit(repoDir, message string, skip gitops.Filter) (bool, error) {
+	if err := gitops.AddFiltered(repoDir, skip); err != nil {
+		return false, err
+	}
+	return gitops.Commit(repoDir, message)
+}
+
+func (l *repoLoop) refreshWatcher() {
+	repoDir := l.repo.Dir
+	cfg, err := config.LoadRepoConfigIn(repoDir)
 	if err != nil {
-		log.Error().Err(err).Msg("load repo config for watcher")
+		l.log.Error().Err(err).Msg("load repo config for watcher")
 		return
 	}
 
+	matcher, err := ignore.ForRepo(repoDir, cfg.Files)
+	if err != nil {
+		l.log.Error().Err(err).Msg("load ignore patterns for watcher")
+	}
+	files, shadowed := l.repoFiles(cfg)
+	for name, c := range shadowed {
+		l.log.Warn().Str("name", name).Str("owner", c.Repo+"/"+c.Name).Msg("target is managed by another source; skipping")
+	}
+	l.watcher.SetFilter(eventFilter(repoDir, files, matcher))
+
 	var paths []string
-	repoDir := config.RepoDir(configDir)
-	for _, f := range cfg.Files {
+	for _, f := range files {
 		target, ok := fileops.ResolveTarget(f.Targets)
 		if ok {
 			paths = append(paths, target)
 		}
-		paths = append(paths, filepath.Join(repoDir, f.Source))
+		source := f.SourcePath(repoDir)
+		paths = append(paths, source)
+		if info, err := os.Stat(source); err == nil && info.IsDir() {
+			l.watcher.WatchTree(source)
+		}
 	}
-	watcher.WatchPaths(paths)
+	l.watcher.WatchPaths(paths)
 }
 
-func applySymlinks(configDir string) {
-	log := logger.Get()
-	cfg, err := config.LoadRepoConfig(configDir)
+// eventFilter maps event paths under the repo or a target back to
+// repo-relative paths and reports those matched by the ignore patterns.
+func eventFilter(repoDir string, files []config.FileEntry, matcher *ignore.Matcher) func(string, bool) bool {
+	type root struct{ dir, source string }
+	roots := []root{{dir: repoDir}}
+	for _, f := range files {
+		if target, ok := fileops.ResolveTarget(f.Targets); ok {
+			roots = append(roots, root{dir: target, source: f.Source})
+		}
+	}
+
+	return func(p string, isDir bool) bool {
+		for _, r := range roots {
+			rel, err := filepath.Rel(r.dir, p)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			rel = path.Join(r.source, filepath.ToSlash(rel))
+			if r.source == "" && (rel == ".git" || strings.HasPrefix(rel, ".git/")) {
+				return true
+			}
+			return rel != "." && matcher.Match(rel, isDir)
+		}
+		return false
+	}
+}
+
+func (l *repoLoop) applyEntries(changed func(string) bool) []apply.Result {
+	cfg, err := config.LoadRepoConfigIn(l.repo.Dir)
 	if err != nil {
-		log.Error().Err(err).Msg("load repo config for symlinks")
-		return
+		l.log.Error().Err(err).Msg("load repo config for apply")
+		return nil
 	}
+	results := apply.Entries(l.repo.Dir, l.activeFiles(cfg), l.applyOptions(changed))
+	l.logResults(results)
+	return results
+}
 
-	repoDir := config.RepoDir(configDir)
-	for _, f := range cfg.Files {
-		target, ok := fileops.ResolveTarget(f.Targets)
-		if !ok {
-			continue
+// syncLayers updates the layers the repo extends and, when they or the
+// repo changed, applies their entries. It returns nil when nothing was
+// applied.
+func (l *repoLoop) syncLayers(changed bool) []apply.Result {
+	cfg, err := config.LoadRepoConfigIn(l.repo.Dir)
+	if err != nil || len(cfg.Extends) == 0 {
+		return nil
+	}
+	updates, err := layers.Fetch(l.configDir, cfg)
+	for _, u := range updates {
+		if u.Discarded != "" {
+			l.log.Warn().Str("layer", u.Repo).Str("patch", u.Discarded).Msg("discarded local edits to read-only layer")
 		}
-		repoFile := filepath.Join(repoDir, f.Source)
-		if fileops.IsSymlinkTo(target, repoFile) {
-			continue
+		changed = changed || u.Changed
+	}
+	if err != nil {
+		l.log.Error().Err(err).Msg("update layers")
+		l.record(events.Event{Type: events.Failed, Name: "layers", Message: err.Error()})
+		return nil
+	}
+	if !changed {
+		return nil
+	}
+
+	state, err := config.LoadLocalState(l.configDir)
+	if err != nil {
+		l.log.Warn().Err(err).Msg("load local state for layers")
+		state = &config.LocalState{}
+	}
+	list, err := layers.Resolve(l.configDir, cfg, state.Profiles)
+	if err != nil {
+		l.log.Error().Err(err).Msg("resolve layers")
+		return nil
+	}
+	var results []apply.Result
+	for _, layer := range list {
+		l.log.Info().Str("layer", layer.Name()).Msg("applying layer")
+		opts := apply.Options{Hooks: hooks.NewRunner(state, layer.Dir), State: l.applyState()}
+		results = append(results, apply.Entries(layer.Dir, layer.ActiveFiles(state.Profiles), opts)...)
+	}
+	l.logResults(results)
+	return results
+}
+
+// applyOptions reloads local state so hook trust changes take effect
+// without restarting the daemon.
+func (l *repoLoop) applyOptions(changed func(string) bool) apply.Options {
+	state, err := config.LoadLocalState(l.configDir)
+	if err != nil {
+		l.log.Warn().Err(err).Msg("load local state for hooks")
+		state = &config.LocalState{}
+	}
+	return apply.Options{
+		Changed: changed,
+		Hooks:   hooks.NewRunner(state, l.repo.Dir),
+		State:   l.applyState(),
+	}
+}
+
+// applyState loads what was last applied to targets. Without it, targets
+// are applied without checking them for local edits.
+func (l *repoLoop) applyState() *apply.State {
+	st, err := apply.LoadState(l.configDir)
+	if err != nil {
+		l.log.Warn().Err(err).Msg("load apply state")
+		return nil
+	}
+	return st
+}
+
+// enforceModes re-applies entries with a recorded mode so permission drift
+// is reported and corrected between remote changes.
+func (l *repoLoop) enforceModes() {
+	cfg, err := config.LoadRepoConfigIn(l.repo.Dir)
+	if err != nil {
+		l.log.Error().Err(err).Msg("load repo config for modes")
+		return
+	}
+	var files []config.FileEntry
+	for _, f := range l.activeFiles(cfg) {
+		if f.Mode != "" {
+			files = append(files, f)
 		}
+	}
+	l.logResults(apply.Entries(l.repo.Dir, files, l.applyOptions(nil)))
+}
 
-		// Handle conflict: backup local file.
-		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink == 0 {
-			backup := target + fmt.Sprintf(".conflict-%s", time.Now().Format("20060102-150405"))
-			if err := os.Rename(target, backup); err != nil {
-				log.Error().Err(err).Str("file", target).Msg("backup failed")
-				continue
+// activeFiles returns the entries enabled by this machine's profiles,
+// leaving out those whose target an earlier repo claims. Local state is
+// reloaded so profile changes take effect without a restart.
+func (l *repoLoop) activeFiles(cfg *config.Config) []config.FileEntry {
+	files, _ := l.repoFiles(cfg)
+	return files
+}
+
+// repoFiles is activeFiles that also returns the entries left out.
+func (l *repoLoop) repoFiles(cfg *config.Config) ([]config.FileEntry, map[string]config.Claim) {
+	state, err := config.LoadLocalState(l.configDir)
+	if err != nil {
+		l.log.Warn().Err(err).Msg("load local state for profiles")
+		state = &config.LocalState{}
+	}
+	files, shadowed, err := config.RepoFiles(l.configDir, state, l.repo.Name, cfg)
+	if err != nil {
+		l.log.Warn().Err(err).Msg("check targets claimed by other sources")
+	}
+	return files, shadowed
+}
+
+// logResults logs the outcome of applying or capturing entries and records
+// it in the event journal.
+func (l *repoLoop) logResults(results []apply.Result) {
+	log := &l.log
+	l.record(events.Results(results)...)
+	for _, res := range results {
+		if res.Backup != "" {
+			log.Info().Str("backup", res.Backup).Msg("backed up conflicting file")
+		}
+		if res.Drifted {
+			log.Warn().Str("name", res.Name).Str("mode", fmt.Sprintf("%04o", res.PrevMode)).Msg("permissions drifted; restored")
+		}
+		for _, h := range res.Hooks {
+			switch {
+			case h.Skipped != "":
+				log.Warn().Str("name", h.Name).Str("hook", string(h.Kind)).Msg("hook skipped: " + h.Skipped)
+			case h.Err != nil:
+				log.Error().Err(h.Err).Str("name", h.Name).Str("hook", string(h.Kind)).Str("output", h.Output).Msg("hook failed")
+			default:
+				log.Info().Str("name", h.Name).Str("hook", string(h.Kind)).Dur("duration", h.Duration).Str("output", h.Output).Msg("hook ran")
 			}
-			log.Info().Str("backup", backup).Msg("backed up conflicting file")
 		}
+		switch res.Action {
+		case apply.ActionFailed:
+			log.Error().Err(res.Err).Str("name", res.Name).Msg("apply failed")
+		case apply.ActionCaptured:
+			log.Info().Str("name", res.Name).Msg("captured target edits")
+		case apply.ActionKept:
+			log.Warn().Err(res.Err).Str("name", res.Name).Msg("kept target with local edits; run synq sync --force to overwrite")
+		}
+	}
+}
 
-		if err := fileops.CreateSymlink(repoFile, target); err != nil {
-			log.Error().Err(err).Str("name", f.Name).Msg("symlink failed")
+// record appends events to the journal, logging failures. Events of a
+// named source carry its name.
+func (l *repoLoop) record(list ...events.Event) {
+	if l.repo.Name != config.DefaultSource {
+		for i := range list {
+			list[i] = list[i].WithSource(l.repo.Name)
 		}
 	}
+	if err := events.Record(l.configDir, list...); err != nil {
+		l.log.Warn().Err(err).Msg("record events")
+	}
 }
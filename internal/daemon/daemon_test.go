@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/ignore"
+)
+
+func TestEventFilter(t *testing.T) {
+	tmp := t.TempDir()
+	repoDir := filepath.Join(tmp, "repo")
+	target := filepath.Join(tmp, "home", ".config", "nvim")
+	files := []config.FileEntry{{
+		Name:    "nvim",
+		Source:  "home/.config/nvim",
+		Targets: map[string]string{runtime.GOOS: target},
+		Ignore:  []string{"lazy-lock.json"},
+	}}
+	matcher := ignore.New()
+	matcher.Add("home/.config/nvim", "lazy-lock.json")
+	filter := eventFilter(repoDir, files, matcher)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(repoDir, "home", ".config", "nvim", "lazy-lock.json"), true},
+		{filepath.Join(target, "lazy-lock.json"), true},
+		{filepath.Join(target, "init.lua.swp"), true},
+		{filepath.Join(target, "init.lua"), false},
+		{filepath.Join(repoDir, ".git", "index"), true},
+		{filepath.Join(tmp, "elsewhere", "lazy-lock.json"), false},
+	}
+	for _, tt := range tests {
+		if got := filter(tt.path, false); got != tt.want {
+			t.Errorf("filter(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
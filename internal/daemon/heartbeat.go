@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/machines"
+	"github.com/ihavespoons/synq/internal/trust"
+)
+
+// heartbeat tracks what this machine reports in its heartbeat file. It is
+// only used from the main loop.
+type heartbeat struct {
+	configDir string
+	version   string
+	interval  time.Duration
+
+	lastSync time.Time
+	syncErr  string
+	commit   string
+	failing  []string
+	written  time.Time
+}
+
+func newHeartbeat(configDir, version string, state *config.LocalState) *heartbeat {
+	interval, err := time.ParseDuration(state.Daemon.HeartbeatInterval)
+	if err != nil {
+		interval, _ = time.ParseDuration(config.DefaultHeartbeat)
+	}
+	return &heartbeat{configDir: configDir, version: version, interval: interval}
+}
+
+// synced records a successful pull.
+func (h *heartbeat) synced(repoDir string) {
+	h.lastSync = time.Now()
+	h.syncErr = ""
+	if head, err := gitops.Head(repoDir); err == nil {
+		h.commit = head
+	}
+}
+
+// applied records which entries failed to apply.
+func (h *heartbeat) applied(results []apply.Result) {
+	h.failing = nil
+	for _, res := range results {
+		if res.Action == apply.ActionFailed {
+			h.failing = append(h.failing, res.Name)
+		}
+	}
+}
+
+// failed records a failed sync attempt.
+func (h *heartbeat) failed(err error) {
+	h.syncErr = err.Error()
+}
+
+// beat writes and commits the heartbeat file if it is due, reporting
+// whether it made a commit, which the loop then pushes as the schedule
+// allows. Only the heartbeat file is committed, so unrelated local edits
+// stay untouched.
+func (h *heartbeat) beat(now time.Time) (bool, error) {
+	if h.interval <= 0 || now.Sub(h.written) < h.interval {
+		return false, nil
+	}
+	repoDir := config.RepoDir(h.configDir)
+
+	id, err := machines.EnsureID(h.configDir)
+	if err != nil {
+		return false, err
+	}
+	state, err := config.LoadLocalState(h.configDir)
+	if err != nil {
+		return false, fmt.Errorf("load local state: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	signingKey := ""
+	if state.Trust.Enabled {
+		if signingKey, err = trust.PublicKey(trust.KeyPath(h.configDir, state)); err != nil {
+			return false, fmt.Errorf("read signing key: %w", err)
+		}
+	}
+	source, err := machines.Write(repoDir, &machines.Heartbeat{
+		ID:         id,
+		Hostname:   hostname,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Version:    h.version,
+		Profiles:   state.Profiles,
+		LastSeen:   now.UTC().Truncate(time.Second),
+		LastSync:   h.lastSync.UTC().Truncate(time.Second),
+		SyncError:  h.syncErr,
+		Commit:     h.commit,
+		Failing:    h.failing,
+		SigningKey: signingKey,
+	})
+	if err != nil {
+		return false, fmt.Errorf("write heartbeat: %w", err)
+	}
+	h.written = now
+	return gitops.CommitPaths(repoDir, fmt.Sprintf("Heartbeat from %s", hostname), source)
+}
@@ -0,0 +1,208 @@
+package daemon
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>{{xml .Label}}</string>
+    <key>ProgramArguments</key>
+    <array>
+{{- range .Args}}
+        <string>{{xml .}}</string>
+{{- end}}
+    </array>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <true/>
+    <key>StandardOutPath</key>
+    <string>{{xml .LogDir}}/synq.log</string>
+    <key>StandardErrorPath</key>
+    <string>{{xml .LogDir}}/synq.err</string>
+</dict>
+</plist>
+`
+
+// launchdLabel is the label of the default launchd agent. Named instances
+// append ".<instance>".
+const launchdLabel = "com.synq.daemon"
+
+// launchd manages the daemon as a launchd user agent.
+type launchd struct {
+	run      Runner
+	opts     ServiceOptions
+	agentDir string
+	uid      int
+}
+
+func (l *launchd) Name() string { return "launchd" }
+
+func (l *launchd) label() string {
+	if l.opts.Instance == "" {
+		return launchdLabel
+	}
+	return launchdLabel + "." + l.opts.Instance
+}
+
+func (l *launchd) Path() string { return filepath.Join(l.agentDir, l.label()+".plist") }
+
+func (l *launchd) logDir() string { return filepath.Join(l.opts.ConfigDir, "logs") }
+
+func (l *launchd) domain() string { return "gui/" + strconv.Itoa(l.uid) }
+
+func (l *launchd) target() string { return l.domain() + "/" + l.label() }
+
+func (l *launchd) launchctl(args ...string) error {
+	if out, err := l.run.Run("launchctl", args...); err != nil {
+		return fmt.Errorf("launchctl %s: %s", strings.Join(args, " "), out)
+	}
+	return nil
+}
+
+// loaded reports whether the agent is bootstrapped, and its print output.
+func (l *launchd) loaded() (string, bool) {
+	out, err := l.run.Run("launchctl", "print", l.target())
+	return out, err == nil
+}
+
+func (l *launchd) Install() error {
+	command, err := l.opts.command()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.logDir(), 0o755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.agentDir, 0o755); err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("plist").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(plistTemplate)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(l.Path())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	return tmpl.Execute(f, struct {
+		Label  string
+		Args   []string
+		LogDir string
+	}{
+		Label:  l.label(),
+		Args:   command,
+		LogDir: l.logDir(),
+	})
+}
+
+func (l *launchd) Uninstall() error {
+	if _, ok := l.loaded(); ok {
+		_ = l.launchctl("bootout", l.target())
+	}
+	if err := os.Remove(l.Path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *launchd) Enable() error {
+	if err := l.launchctl("enable", l.target()); err != nil {
+		return err
+	}
+	return l.Start()
+}
+
+func (l *launchd) Disable() error {
+	if err := l.Stop(); err != nil {
+		return err
+	}
+	return l.launchctl("disable", l.target())
+}
+
+// Start loads the agent, which starts it because of RunAtLoad, or restarts
+// it if it is already loaded.
+func (l *launchd) Start() error {
+	if _, ok := l.loaded(); ok {
+		return l.launchctl("kickstart", l.target())
+	}
+	return l.launchctl("bootstrap", l.domain(), l.Path())
+}
+
+// Stop unloads the agent; with KeepAlive set, launchd would restart a
+// process that was only killed.
+func (l *launchd) Stop() error {
+	if _, ok := l.loaded(); !ok {
+		return nil
+	}
+	return l.launchctl("bootout", l.target())
+}
+
+func (l *launchd) Status() (ServiceStatus, error) {
+	var st ServiceStatus
+	if _, err := os.Stat(l.Path()); err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return st, err
+	}
+	st.Installed = true
+
+	st.Enabled = true
+	if out, err := l.run.Run("launchctl", "print-disabled", l.domain()); err == nil {
+		for _, line := range strings.Split(out, "\n") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), "=>")
+			if !ok || strings.Trim(strings.TrimSpace(key), `"`) != l.label() {
+				continue
+			}
+			// Older releases print true/false, newer disabled/enabled.
+			value = strings.TrimSpace(value)
+			st.Enabled = value != "disabled" && value != "true"
+		}
+	}
+
+	out, ok := l.loaded()
+	if !ok {
+		return st, nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), " = ")
+		if !found {
+			continue
+		}
+		switch key {
+		case "state":
+			st.Running = value == "running"
+		case "pid":
+			st.PID, _ = strconv.Atoi(value)
+		}
+	}
+	return st, nil
+}
+
+func (l *launchd) LogsCommand(lines int, follow bool) (string, []string) {
+	args := []string{"-n", strconv.Itoa(lines)}
+	if follow {
+		args = append(args, "-F")
+	}
+	return "tail", append(args, filepath.Join(l.logDir(), "synq.log"), filepath.Join(l.logDir(), "synq.err"))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
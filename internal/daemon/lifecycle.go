@@ -49,8 +49,9 @@ func IsRunning(configDir string) (bool, int) {
 	if err != nil || pid == 0 {
 		return false, 0
 	}
-	if !processExists(pid) {
-		// Stale PID file.
+	// A PID whose process is gone, or was reused by a process that does
+	// not hold the daemon lock, is stale.
+	if !processExists(pid) || !Locked(configDir) {
 		RemovePID(configDir)
 		return false, 0
 	}
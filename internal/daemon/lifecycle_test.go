@@ -1,8 +1,10 @@
 package daemon
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestWriteAndReadPID(t *testing.T) {
@@ -41,7 +43,20 @@ func TestIsRunning(t *testing.T) {
 		t.Error("expected not running")
 	}
 
-	// Write current PID -> running.
+	// PID file without the lock -> stale, not running.
+	if err := WritePID(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if running, _ := IsRunning(tmp); running {
+		t.Error("expected PID file without lock to be stale")
+	}
+
+	// Write current PID while holding the lock -> running.
+	lock, err := AcquireLock(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lock.Release() }()
 	if err := WritePID(tmp); err != nil {
 		t.Fatal(err)
 	}
@@ -70,3 +85,53 @@ func TestRemovePID(t *testing.T) {
 		t.Errorf("PID = %d after removal, want 0", pid)
 	}
 }
+
+func TestAcquireLock(t *testing.T) {
+	tmp := t.TempDir()
+	lock, err := AcquireLock(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLock(tmp); !errors.Is(err, ErrLocked) {
+		t.Errorf("second AcquireLock() = %v, want ErrLocked", err)
+	}
+	if !Locked(tmp) {
+		t.Error("expected Locked to report the held lock")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if Locked(tmp) {
+		t.Error("expected lock to be free after Release")
+	}
+	lock, err = AcquireLock(tmp)
+	if err != nil {
+		t.Fatalf("AcquireLock() after release = %v", err)
+	}
+	_ = lock.Release()
+}
+
+func TestAcquireLockWaitOutlastsLocked(t *testing.T) {
+	tmp := t.TempDir()
+	lock, err := AcquireLock(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like Locked testing the lock just as a daemon starts.
+	time.AfterFunc(100*time.Millisecond, func() { _ = lock.Release() })
+	waited, err := acquireLockWait(tmp)
+	if err != nil {
+		t.Fatalf("acquireLockWait() = %v, want the lock once released", err)
+	}
+	_ = waited.Release()
+
+	held, err := AcquireLock(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = held.Release() }()
+	if _, err := acquireLockWait(tmp); !errors.Is(err, ErrLocked) {
+		t.Errorf("acquireLockWait() on a held lock = %v, want ErrLocked", err)
+	}
+}
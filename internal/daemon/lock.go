@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned by AcquireLock when another daemon holds the lock.
+var ErrLocked = errors.New("another synq daemon is already running")
+
+// LockFile returns the path to the daemon lock file. The lock is held for
+// the lifetime of the daemon process and released by the OS when it exits.
+func LockFile(configDir string) string {
+	return filepath.Join(configDir, "daemon.lock")
+}
+
+// lockWait is how long a starting daemon keeps trying to take the lock.
+// Locked holds it for a moment to test it, which must not make a daemon
+// starting at the same time give up.
+const lockWait = time.Second
+
+// acquireLockWait is AcquireLock, retrying for up to lockWait while the
+// lock is held.
+func acquireLockWait(configDir string) (*Lock, error) {
+	deadline := time.Now().Add(lockWait)
+	for {
+		l, err := AcquireLock(configDir)
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return l, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Locked reports whether a daemon currently holds the lock. It takes the
+// lock briefly to find out; a daemon starting meanwhile waits for it.
+func Locked(configDir string) bool {
+	l, err := AcquireLock(configDir)
+	if err != nil {
+		return errors.Is(err, ErrLocked)
+	}
+	_ = l.Release()
+	return false
+}
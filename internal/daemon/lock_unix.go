@@ -0,0 +1,40 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Lock is an exclusive lock on the daemon lock file.
+type Lock struct {
+	f *os.File
+}
+
+// AcquireLock takes an exclusive, non-blocking flock on the lock file.
+func AcquireLock(configDir string) (*Lock, error) {
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(LockFile(configDir), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("lock %s: %w", LockFile(configDir), err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release unlocks and closes the lock file.
+func (l *Lock) Release() error {
+	_ = syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, which the syscall
+// package does not define.
+const errorSharingViolation syscall.Errno = 32
+
+// Lock is an exclusive handle on the daemon lock file.
+type Lock struct {
+	h syscall.Handle
+}
+
+// AcquireLock opens the lock file without sharing, so no other process can
+// open it until the handle is closed.
+func AcquireLock(configDir string) (*Lock, error) {
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return nil, err
+	}
+	name, err := syscall.UTF16PtrFromString(LockFile(configDir))
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if errors.Is(err, errorSharingViolation) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("lock %s: %w", LockFile(configDir), err)
+	}
+	return &Lock{h: h}, nil
+}
+
+// Release closes the lock file handle.
+func (l *Lock) Release() error {
+	return syscall.CloseHandle(l.h)
+}
@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"math"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/metrics"
+)
+
+// Sync phases reported in the attempt and failure counters.
+const (
+	phaseCommit = "commit"
+	phasePush   = "push"
+	phasePull   = "pull"
+	phaseApply  = "apply"
+)
+
+// daemonMetrics are the metrics served when metrics_listen is set.
+type daemonMetrics struct {
+	reg         *metrics.Registry
+	attempts    *metrics.CounterVec
+	failures    *metrics.CounterVec
+	lastSuccess *metrics.Gauge
+	triggers    *metrics.Counter
+	gitLatency  *metrics.HistogramVec
+}
+
+func newMetrics(loops []*repoLoop) *daemonMetrics {
+	reg := metrics.NewRegistry()
+	m := &daemonMetrics{
+		reg:         reg,
+		attempts:    reg.NewCounterVec("synq_sync_attempts_total", "Sync attempts by phase.", "phase"),
+		failures:    reg.NewCounterVec("synq_sync_failures_total", "Failed sync attempts by phase.", "phase"),
+		lastSuccess: reg.NewGauge("synq_last_successful_sync_timestamp_seconds", "Unix time of the last successful pull and apply."),
+		triggers:    reg.NewCounter("synq_debounce_triggers_total", "File change bursts that triggered an auto-sync."),
+		gitLatency:  reg.NewHistogramVec("synq_git_command_duration_seconds", "Duration of git commands.", "command", metrics.DefaultBuckets),
+	}
+	phases := []string{phaseCommit, phasePush, phasePull, phaseApply}
+	m.attempts.Init(phases...)
+	m.failures.Init(phases...)
+
+	reg.NewGaugeFunc("synq_watched_directories", "Directories watched for changes.", func() float64 {
+		n := 0
+		for _, l := range loops {
+			n += l.watcher.Count()
+		}
+		return float64(n)
+	})
+	reg.NewGaugeFunc("synq_unpushed_commits", "Local commits not yet pushed to the remotes.", func() float64 {
+		total := 0
+		for _, l := range loops {
+			n, err := gitops.Unpushed(l.repo.Dir)
+			if err != nil {
+				return math.NaN()
+			}
+			total += n
+		}
+		return float64(total)
+	})
+	return m
+}
+
+// phase records an attempt of a sync phase and whether it failed.
+func (m *daemonMetrics) phase(name string, err error) {
+	m.attempts.Inc(name)
+	if err != nil {
+		m.failures.Inc(name)
+	}
+}
+
+// applied records an apply attempt, which fails if any entry failed, and
+// reports whether it succeeded.
+func (m *daemonMetrics) applied(results []apply.Result) bool {
+	m.attempts.Inc(phaseApply)
+	for _, res := range results {
+		if res.Action == apply.ActionFailed {
+			m.failures.Inc(phaseApply)
+			return false
+		}
+	}
+	return true
+}
+
+// observeGit records git command latency.
+func (m *daemonMetrics) observeGit(command string, d time.Duration) {
+	m.gitLatency.Observe(command, d.Seconds())
+}
@@ -0,0 +1,345 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/gitops"
+	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/machines"
+	"github.com/rs/zerolog"
+)
+
+// maxEventsBackoff caps the wait before reconnecting to an event stream.
+const maxEventsBackoff = 5 * time.Minute
+
+// startNotify starts the notification sources configured in c, which wake
+// the loops until ctx is done. It must be called before the loops' watchers
+// start. The returned func stops them.
+func startNotify(ctx context.Context, configDir string, c config.NotifyConfig, loops []*repoLoop) (func(), error) {
+	log := logger.Get()
+	var stops []func()
+	stop := func() {
+		for _, s := range stops {
+			s()
+		}
+	}
+	for _, l := range loops {
+		l.checkRemote = c.CheckRemote
+	}
+
+	if c.WebhookListen != "" {
+		if c.WebhookSecret != "" {
+			if err := checkPrivate(config.LocalStatePath(configDir)); err != nil {
+				return nil, err
+			}
+		}
+		ln, err := listenWebhook(c.WebhookListen, c.WebhookSecret)
+		if err != nil {
+			return nil, err
+		}
+		handler := webhookHandler(c.WebhookSecret, func(source string) bool { return wakeLoops(loops, source) })
+		srv := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("webhook listener failed")
+			}
+		}()
+		stops = append(stops, func() { _ = srv.Close() })
+		log.Info().Str("addr", ln.Addr().String()).Msg("listening for webhooks")
+	}
+
+	if c.EventsURL != "" {
+		go subscribe(ctx, c.EventsURL, func() { wakeLoops(loops, "") }, log)
+		log.Info().Str("url", c.EventsURL).Msg("subscribed to event stream")
+	}
+
+	if c.PeerPort != 0 {
+		id, err := machines.EnsureID(configDir)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		t, err := listenUDP(c.PeerPort)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("peer announcements: %w", err)
+		}
+		p := &peers{t: t, machine: id}
+		for _, l := range loops {
+			url, err := gitops.RemoteURL(l.repo.Dir)
+			if err != nil {
+				l.log.Warn().Err(err).Msg("pushes will not be announced to peers")
+				continue
+			}
+			l.peers, l.peerKey = p, repoKey(url)
+		}
+		go p.listen(func(key string) {
+			for _, l := range loops {
+				if l.peerKey == key {
+					l.wakeUp()
+				}
+			}
+		})
+		stops = append(stops, func() { _ = t.Close() })
+		log.Info().Int("port", c.PeerPort).Msg("listening for peer announcements")
+	}
+	return stop, nil
+}
+
+// wakeLoops wakes the loop of source, or every loop when source is empty.
+// It reports whether any loop was woken.
+func wakeLoops(loops []*repoLoop, source string) bool {
+	woke := false
+	for _, l := range loops {
+		if source == "" || l.repo.Name == source {
+			l.wakeUp()
+			woke = true
+		}
+	}
+	return woke
+}
+
+// checkPrivate refuses a file holding the webhook secret that other users
+// can read, since they could forge webhooks with it. Windows has no such
+// mode bits to check.
+func checkPrivate(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s holds webhook_secret but other users can read it; run 'chmod 600 %s'", path, path)
+	}
+	return nil
+}
+
+// listenWebhook opens the webhook listener. Without a secret, anyone who
+// can reach it could make the daemon pull, so it must be on loopback.
+func listenWebhook(addr, secret string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook address %q: %w", addr, err)
+	}
+	if secret == "" && host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("webhook address %q must be a loopback address unless webhook_secret is set", addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// webhookHandler calls wake for every authenticated POST request, with the
+// source named by its source parameter, or "" for every source.
+func webhookHandler(secret string, wake func(source string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "read body", http.StatusBadRequest)
+			return
+		}
+		if secret != "" && !authentic(r, body, secret) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !wake(r.URL.Query().Get("source")) {
+			http.Error(w, "unknown source", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// authentic reports whether a webhook request proves it knows secret,
+// either by GitHub's signature of the body or by passing it as a token.
+func authentic(r *http.Request, body []byte, secret string) bool {
+	if sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hmac.Equal([]byte(sig), []byte(hex.EncodeToString(mac.Sum(nil))))
+	}
+	token := r.Header.Get("X-Gitlab-Token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// subscribe calls fn for every event of the server-sent events stream at
+// url, and on every connection since events may have been missed before
+// it, until ctx is done. It reconnects with backoff.
+func subscribe(ctx context.Context, url string, fn func(), log *zerolog.Logger) {
+	backoff := time.Second
+	for {
+		connected, err := stream(ctx, url, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Warn().Err(err).Dur("retry", backoff).Msg("event stream ended")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxEventsBackoff)
+	}
+}
+
+// stream reads the event stream at url once. It reports whether it
+// connected.
+func stream(ctx context.Context, url string, fn func()) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("event stream: %s", resp.Status)
+	}
+	fn()
+	return true, readEvents(resp.Body, fn)
+}
+
+// readEvents calls fn for every event in a server-sent events stream until
+// it ends. Comments and the keep-alive events some servers send, such as
+// ntfy's, are skipped.
+func readEvents(r io.Reader, fn func()) error {
+	sc := bufio.NewScanner(r)
+	pending, name := false, ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if pending && name != "keepalive" && name != "ping" && name != "open" {
+				fn()
+			}
+			pending, name = false, ""
+		case strings.HasPrefix(line, ":"):
+		default:
+			pending = true
+			if v, ok := strings.CutPrefix(line, "event:"); ok {
+				name = strings.TrimSpace(v)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// announcePrefix starts every peer announcement.
+const announcePrefix = "synq-push"
+
+// peerTransport carries announcements to every machine on the local
+// network, this one included.
+type peerTransport interface {
+	Send(msg []byte) error
+	// Receive blocks until a message arrives. It fails once closed.
+	Receive() ([]byte, error)
+	Close() error
+}
+
+// peers announces this machine's pushes to the other machines on the local
+// network and listens for theirs.
+type peers struct {
+	t       peerTransport
+	machine string
+}
+
+// announce tells the other machines that the repo with key was pushed to.
+func (p *peers) announce(key string) error {
+	return p.t.Send([]byte(fmt.Sprintf("%s %s %s", announcePrefix, p.machine, key)))
+}
+
+// listen calls fn with the repo key of every push another machine
+// announces, until the transport is closed.
+func (p *peers) listen(fn func(key string)) {
+	for {
+		msg, err := p.t.Receive()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(msg))
+		if len(fields) != 3 || fields[0] != announcePrefix || fields[1] == p.machine {
+			continue
+		}
+		fn(fields[2])
+	}
+}
+
+// repoKey identifies a remote repo in peer announcements without revealing
+// its URL. The SSH and HTTPS URLs of a repo have the same key.
+func repoKey(url string) string {
+	u := strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	if _, rest, ok := strings.Cut(u, "://"); ok {
+		u = rest
+	} else if host, p, ok := strings.Cut(u, ":"); ok && !strings.Contains(host, "/") {
+		u = host + "/" + p // scp-like user@host:path
+	}
+	if at := strings.Index(u, "@"); at >= 0 && at < strings.Index(u+"/", "/") {
+		u = u[at+1:]
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(u)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// udpTransport broadcasts announcements on a UDP port and receives those
+// sent to it.
+type udpTransport struct {
+	conn *net.UDPConn
+	to   *net.UDPAddr
+}
+
+func listenUDP(port int) (*udpTransport, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	return &udpTransport{conn: conn, to: &net.UDPAddr{IP: net.IPv4bcast, Port: port}}, nil
+}
+
+func (u *udpTransport) Send(msg []byte) error {
+	_, err := u.conn.WriteToUDP(msg, u.to)
+	return err
+}
+
+func (u *udpTransport) Receive() ([]byte, error) {
+	buf := make([]byte, 512)
+	n, _, err := u.conn.ReadFromUDP(buf)
+	return buf[:n], err
+}
+
+func (u *udpTransport) Close() error {
+	return u.conn.Close()
+}
@@ -0,0 +1,204 @@
+package daemon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loopbackNet delivers every message sent by one of its transports to all
+// of them, like a broadcast on the local network.
+type loopbackNet struct {
+	mu      sync.Mutex
+	members []*loopback
+}
+
+type loopback struct {
+	net  *loopbackNet
+	ch   chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func (n *loopbackNet) join() *loopback {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l := &loopback{net: n, ch: make(chan []byte, 16), done: make(chan struct{})}
+	n.members = append(n.members, l)
+	return l
+}
+
+func (l *loopback) Send(msg []byte) error {
+	l.net.mu.Lock()
+	defer l.net.mu.Unlock()
+	for _, m := range l.net.members {
+		m.ch <- append([]byte(nil), msg...)
+	}
+	return nil
+}
+
+func (l *loopback) Receive() ([]byte, error) {
+	select {
+	case msg := <-l.ch:
+		return msg, nil
+	case <-l.done:
+		return nil, errors.New("closed")
+	}
+}
+
+func (l *loopback) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func TestPeersAnnounce(t *testing.T) {
+	var n loopbackNet
+	a := &peers{t: n.join(), machine: "aaaa"}
+	b := &peers{t: n.join(), machine: "bbbb"}
+	defer func() { _ = a.t.Close(); _ = b.t.Close() }()
+
+	gotA, gotB := make(chan string, 4), make(chan string, 4)
+	go a.listen(func(key string) { gotA <- key })
+	go b.listen(func(key string) { gotB <- key })
+
+	if err := a.t.Send([]byte("unrelated broadcast")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.announce("k1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case key := <-gotB:
+		if key != "k1" {
+			t.Errorf("b heard %q, want k1", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("b did not hear a's announcement")
+	}
+	select {
+	case key := <-gotA:
+		t.Errorf("a heard its own announcement %q", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRepoKey(t *testing.T) {
+	same := []string{
+		"git@github.com:me/dotfiles.git",
+		"https://github.com/me/dotfiles.git",
+		"https://github.com/me/dotfiles",
+		"ssh://git@github.com/me/dotfiles",
+		"https://GitHub.com/me/dotfiles/",
+	}
+	want := repoKey(same[0])
+	for _, url := range same[1:] {
+		if got := repoKey(url); got != want {
+			t.Errorf("repoKey(%q) = %s, want %s", url, got, want)
+		}
+	}
+	if repoKey("git@github.com:me/other.git") == want {
+		t.Error("different repos have the same key")
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	const secret = "s3cret"
+	var woken []string
+	h := webhookHandler(secret, func(source string) bool {
+		woken = append(woken, source)
+		return source == "" || source == "work"
+	})
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		want   int
+	}{
+		{"github signature", http.MethodPost, "/", map[string]string{"X-Hub-Signature-256": sign(`{"ref":"main"}`)}, http.StatusAccepted},
+		{"bad signature", http.MethodPost, "/", map[string]string{"X-Hub-Signature-256": sign("other")}, http.StatusUnauthorized},
+		{"gitlab token", http.MethodPost, "/", map[string]string{"X-Gitlab-Token": secret}, http.StatusAccepted},
+		{"token parameter", http.MethodPost, "/?token=" + secret + "&source=work", nil, http.StatusAccepted},
+		{"wrong token", http.MethodPost, "/?token=nope", nil, http.StatusUnauthorized},
+		{"no credentials", http.MethodPost, "/", nil, http.StatusUnauthorized},
+		{"unknown source", http.MethodPost, "/?token=" + secret + "&source=nope", nil, http.StatusNotFound},
+		{"get", http.MethodGet, "/?token=" + secret, nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"ref":"main"}`))
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	if want := []string{"", "", "work", "nope"}; strings.Join(woken, ",") != strings.Join(want, ",") {
+		t.Errorf("woken %q, want %q", woken, want)
+	}
+}
+
+func TestCheckPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	path := filepath.Join(t.TempDir(), "synq.yaml")
+	if err := os.WriteFile(path, []byte("daemon: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivate(path); err == nil {
+		t.Error("a secret readable by other users should be refused")
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivate(path); err != nil {
+		t.Errorf("checkPrivate on a 0600 file = %v", err)
+	}
+}
+
+func TestListenWebhookRequiresSecretOffLoopback(t *testing.T) {
+	if _, err := listenWebhook("0.0.0.0:0", ""); err == nil {
+		t.Error("listening on all interfaces without a secret should fail")
+	}
+	l, err := listenWebhook("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+}
+
+func TestReadEvents(t *testing.T) {
+	input := ": connected\n\n" +
+		"event: open\ndata: {}\n\n" +
+		"data: pushed\n\n" +
+		"event: keepalive\ndata: {}\n\n" +
+		"event: message\ndata: {\"message\":\"pushed\"}\n\n" +
+		"data: cut off"
+	n := 0
+	err := readEvents(strings.NewReader(input), func() { n++ })
+	if n != 2 {
+		t.Errorf("got %d events, want 2", n)
+	}
+	if err == nil {
+		t.Error("a stream that ends should be an error")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build darwin
+
+package daemon
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// onBattery reports whether pmset says the machine draws from its battery.
+func onBattery() (bool, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(out), "'Battery Power'"), nil
+}
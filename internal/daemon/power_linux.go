@@ -0,0 +1,37 @@
+//go:build linux
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// onBattery reports whether the machine has a battery and no external
+// power supply online.
+func onBattery() (bool, error) {
+	dirs, err := filepath.Glob("/sys/class/power_supply/*")
+	if err != nil {
+		return false, err
+	}
+	battery := false
+	for _, dir := range dirs {
+		kind := readSysfs(filepath.Join(dir, "type"))
+		switch {
+		case kind == "Battery" && readSysfs(filepath.Join(dir, "scope")) != "Device":
+			battery = true
+		case kind != "Battery" && readSysfs(filepath.Join(dir, "online")) == "1":
+			return false, nil
+		}
+	}
+	return battery, nil
+}
+
+func readSysfs(p string) string {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package daemon
+
+// onBattery cannot tell on this OS, so it never pauses.
+func onBattery() (bool, error) {
+	return false, nil
+}
@@ -25,3 +25,9 @@ func StopProcess(pid int) error {
 	}
 	return proc.Signal(syscall.SIGTERM)
 }
+
+// DetachAttr returns process attributes that start the background daemon in
+// its own session, so it survives the terminal that started it.
+func DetachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -4,8 +4,13 @@ package daemon
 
 import (
 	"os"
+	"syscall"
 )
 
+// detachedProcess is the DETACHED_PROCESS creation flag, which the syscall
+// package does not define.
+const detachedProcess = 0x00000008
+
 // processExists checks if a process with the given PID exists.
 func processExists(pid int) bool {
 	proc, err := os.FindProcess(pid)
@@ -25,3 +30,12 @@ func StopProcess(pid int) error {
 	}
 	return proc.Kill()
 }
+
+// DetachAttr returns process attributes that start the background daemon
+// without a console and outside the parent's process group.
+func DetachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+// recheckInterval is how often a pause on battery or on a network
+// interface is checked for its end.
+const recheckInterval = time.Minute
+
+// window is a daily span of local time, in minutes after midnight. It
+// wraps around midnight when end is before start.
+type window struct {
+	start, end int
+}
+
+func (w window) contains(m int) bool {
+	if w.start <= w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// Schedule decides when the daemon may pull and push.
+type Schedule struct {
+	quiet      []window
+	battery    bool
+	interfaces []string
+	minPush    time.Duration
+
+	// onBattery and upInterfaces probe the machine; tests replace them.
+	onBattery    func() (bool, error)
+	upInterfaces func() ([]string, error)
+}
+
+// NewSchedule parses the schedule settings.
+func NewSchedule(c config.ScheduleConfig) (*Schedule, error) {
+	s := &Schedule{
+		battery:      c.PauseOnBattery,
+		interfaces:   c.PauseInterfaces,
+		onBattery:    onBattery,
+		upInterfaces: upInterfaces,
+	}
+	for _, q := range c.QuietHours {
+		w, err := parseWindow(q)
+		if err != nil {
+			return nil, err
+		}
+		s.quiet = append(s.quiet, w)
+	}
+	for _, p := range c.PauseInterfaces {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("pause interface pattern %q: %w", p, err)
+		}
+	}
+	if c.MinPushInterval != "" {
+		d, err := time.ParseDuration(c.MinPushInterval)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("min push interval %q is not a duration", c.MinPushInterval)
+		}
+		s.minPush = d
+	}
+	return s, nil
+}
+
+// parseWindow parses "HH:MM-HH:MM".
+func parseWindow(s string) (window, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return window{}, fmt.Errorf("quiet hours %q: want HH:MM-HH:MM", s)
+	}
+	var w window
+	for i, part := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return window{}, fmt.Errorf("quiet hours %q: want HH:MM-HH:MM", s)
+		}
+		m := t.Hour()*60 + t.Minute()
+		if i == 0 {
+			w.start = m
+		} else {
+			w.end = m
+		}
+	}
+	if w.start == w.end {
+		return window{}, fmt.Errorf("quiet hours %q: empty window", s)
+	}
+	return w, nil
+}
+
+// Paused reports why the daemon may not pull or push at now, and how long
+// until it is worth checking again. The reason is empty when it may.
+func (s *Schedule) Paused(now time.Time) (string, time.Duration) {
+	m := now.Hour()*60 + now.Minute()
+	for _, w := range s.quiet {
+		if w.contains(m) {
+			end := time.Date(now.Year(), now.Month(), now.Day(), w.end/60, w.end%60, 0, 0, now.Location())
+			if !end.After(now) {
+				end = end.AddDate(0, 0, 1)
+			}
+			return "quiet hours until " + end.Format("15:04"), end.Sub(now)
+		}
+	}
+	if s.battery {
+		if on, err := s.onBattery(); err == nil && on {
+			return "on battery", recheckInterval
+		}
+	}
+	if len(s.interfaces) > 0 {
+		names, err := s.upInterfaces()
+		if err == nil {
+			for _, name := range names {
+				for _, p := range s.interfaces {
+					if ok, _ := path.Match(p, name); ok {
+						return "network interface " + name + " is up", recheckInterval
+					}
+				}
+			}
+		}
+	}
+	return "", 0
+}
+
+// PushWait returns how long a push must wait after the last one at
+// lastPush.
+func (s *Schedule) PushWait(now, lastPush time.Time) time.Duration {
+	if s.minPush <= 0 || lastPush.IsZero() {
+		return 0
+	}
+	return max(lastPush.Add(s.minPush).Sub(now), 0)
+}
+
+// upInterfaces lists the network interfaces that are up, other than
+// loopback.
+func upInterfaces() ([]string, error) {
+	list, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, iface := range list {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+			names = append(names, iface.Name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+func TestSchedulePaused(t *testing.T) {
+	s, err := NewSchedule(config.ScheduleConfig{
+		QuietHours:      []string{"22:00-07:00", "12:00-12:30"},
+		PauseOnBattery:  true,
+		PauseInterfaces: []string{"usb*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	battery := false
+	ifaces := []string{"eth0"}
+	s.onBattery = func() (bool, error) { return battery, nil }
+	s.upInterfaces = func() ([]string, error) { return ifaces, nil }
+
+	day := func(h, m int) time.Time { return time.Date(2026, 3, 2, h, m, 0, 0, time.Local) }
+	tests := []struct {
+		now    time.Time
+		reason string
+		retry  time.Duration
+	}{
+		{day(23, 0), "quiet hours until 07:00", 8 * time.Hour},
+		{day(6, 30), "quiet hours until 07:00", 30 * time.Minute},
+		{day(7, 0), "", 0},
+		{day(12, 10), "quiet hours until 12:30", 20 * time.Minute},
+		{day(15, 0), "", 0},
+	}
+	for _, tt := range tests {
+		reason, retry := s.Paused(tt.now)
+		if reason != tt.reason || retry != tt.retry {
+			t.Errorf("Paused(%s) = %q, %s; want %q, %s", tt.now.Format("15:04"), reason, retry, tt.reason, tt.retry)
+		}
+	}
+
+	battery = true
+	if reason, retry := s.Paused(day(15, 0)); reason != "on battery" || retry != recheckInterval {
+		t.Errorf("on battery: Paused = %q, %s", reason, retry)
+	}
+	battery = false
+	ifaces = []string{"eth0", "usb0"}
+	if reason, _ := s.Paused(day(15, 0)); reason != "network interface usb0 is up" {
+		t.Errorf("tethered: Paused = %q", reason)
+	}
+}
+
+func TestSchedulePushWait(t *testing.T) {
+	s, err := NewSchedule(config.ScheduleConfig{MinPushInterval: "15m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if got := s.PushWait(now, time.Time{}); got != 0 {
+		t.Errorf("first push waits %s", got)
+	}
+	if got := s.PushWait(now, now.Add(-10*time.Minute)); got != 5*time.Minute {
+		t.Errorf("PushWait = %s, want 5m", got)
+	}
+	if got := s.PushWait(now, now.Add(-time.Hour)); got != 0 {
+		t.Errorf("PushWait after the interval = %s", got)
+	}
+}
+
+func TestNewScheduleInvalid(t *testing.T) {
+	for _, c := range []config.ScheduleConfig{
+		{QuietHours: []string{"22:00"}},
+		{QuietHours: []string{"25:00-07:00"}},
+		{QuietHours: []string{"07:00-07:00"}},
+		{PauseInterfaces: []string{"usb["}},
+		{MinPushInterval: "soon"},
+	} {
+		if _, err := NewSchedule(c); err == nil {
+			t.Errorf("NewSchedule(%+v) = nil error", c)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"fmt"
+	stdlog "log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/logger"
+	"github.com/ihavespoons/synq/internal/peer"
+	"github.com/rs/zerolog"
+)
+
+// servePeers serves the loops' repos to the trusted peers to fetch, each
+// under its source name.
+func servePeers(configDir string, c config.PeerConfig, loops []*repoLoop) (*http.Server, error) {
+	if _, err := peer.EnsureCert(configDir); err != nil {
+		return nil, fmt.Errorf("peer certificate: %w", err)
+	}
+	s := &peer.Server{
+		Repos:    map[string]string{},
+		Peers:    map[string]string{},
+		ErrorLog: stdlog.New(warnWriter{logger.Get()}, "", 0),
+	}
+	for _, l := range loops {
+		s.Repos[l.repo.Name] = l.repo.Dir
+	}
+	for name, p := range c.Peers {
+		s.Peers[p.Key] = name
+	}
+	ln, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := s.Serve(ln, configDir)
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return srv, nil
+}
+
+// warnWriter logs every line written to it as a warning.
+type warnWriter struct {
+	log *zerolog.Logger
+}
+
+func (w warnWriter) Write(p []byte) (int, error) {
+	w.log.Warn().Msg("peer connection: " + strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ErrServiceUnsupported is returned on platforms without a supported
+// service manager.
+var ErrServiceUnsupported = errors.New("service management is not supported on this platform")
+
+// Runner runs service manager commands and returns their combined output.
+// Tests replace it with a fake.
+type Runner interface {
+	Run(name string, args ...string) (string, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// ServiceStatus describes the daemon's service.
+type ServiceStatus struct {
+	// Installed is true when the unit or agent file exists.
+	Installed bool
+	// Enabled is true when the service starts at login.
+	Enabled bool
+	// Running is true when the service manager runs the daemon.
+	Running bool
+	PID     int
+}
+
+// ServiceOptions describe the daemon a service runs.
+type ServiceOptions struct {
+	ConfigDir string
+	// Instance names the service so several config dirs can each run a
+	// daemon; empty is the default service.
+	Instance string
+	Verbose  bool
+	// Binary is the synq binary to run; empty finds it on PATH.
+	Binary string
+}
+
+var instancePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidateInstance checks that name can be used in unit and agent names.
+func ValidateInstance(name string) error {
+	if name != "" && !instancePattern.MatchString(name) {
+		return fmt.Errorf("invalid service instance %q: use letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// command returns the daemon invocation the service runs.
+func (o ServiceOptions) command() ([]string, error) {
+	bin := o.Binary
+	if bin == "" {
+		var err error
+		if bin, err = findBinary(); err != nil {
+			return nil, err
+		}
+	}
+	args := []string{bin, "daemon", "start", "--foreground", "--config-dir", o.ConfigDir}
+	if o.Verbose {
+		args = append(args, "--verbose")
+	}
+	return args, nil
+}
+
+// ServiceManager installs and controls the OS service that runs the daemon.
+type ServiceManager interface {
+	// Name is the service manager, e.g. "systemd".
+	Name() string
+	// Path is the unit or agent file.
+	Path() string
+	Install() error
+	// Uninstall stops the service and removes its file.
+	Uninstall() error
+	// Enable makes the service start at login and starts it now.
+	Enable() error
+	// Disable stops the service and keeps it from starting at login.
+	Disable() error
+	Start() error
+	Stop() error
+	Status() (ServiceStatus, error)
+	// LogsCommand returns the command that shows the service's logs.
+	LogsCommand(lines int, follow bool) (string, []string)
+}
+
+// findBinary returns the synq binary the service should run.
+func findBinary() (string, error) {
+	if p, err := exec.LookPath("synq"); err == nil {
+		return p, nil
+	}
+	p, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("find synq binary: %w", err)
+	}
+	return p, nil
+}
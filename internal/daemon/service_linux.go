@@ -3,57 +3,27 @@
 package daemon
 
 import (
-	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
-const systemdUnit = `[Unit]
-Description=synq configuration sync daemon
-
-[Service]
-ExecStart=%s daemon start --foreground
-Restart=on-failure
-RestartSec=10
-
-[Install]
-WantedBy=default.target
-`
-
-func unitPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".config", "systemd", "user", "synq.service")
-}
-
-// InstallService installs the systemd user unit for Linux.
-func InstallService(configDir string) error {
-	binPath, err := exec.LookPath("synq")
+// NewServiceManager returns the systemd user unit manager.
+func NewServiceManager(opts ServiceOptions) (ServiceManager, error) {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		binPath, err = os.Executable()
-		if err != nil {
-			return fmt.Errorf("find synq binary: %w", err)
-		}
+		return nil, err
 	}
-
-	path := unitPath()
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
-
-	content := fmt.Sprintf(systemdUnit, binPath)
-	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
-		return err
-	}
-
-	// Reload systemd.
-	_ = exec.Command("systemctl", "--user", "daemon-reload").Run()
-	return nil
+	return &systemd{
+		run:     execRunner{},
+		opts:    opts,
+		unitDir: filepath.Join(home, ".config", "systemd", "user"),
+	}, nil
 }
 
-// UninstallService removes the systemd user unit.
-func UninstallService() error {
-	_ = exec.Command("systemctl", "--user", "stop", "synq").Run()
-	_ = exec.Command("systemctl", "--user", "disable", "synq").Run()
-	return os.Remove(unitPath())
+// UnderServiceManager reports whether this process runs in synq's systemd
+// unit. INVOCATION_ID alone is not enough: shells started by other user
+// services, such as terminal servers, inherit it.
+func UnderServiceManager() bool {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	return err == nil && inSynqUnit(string(data))
 }
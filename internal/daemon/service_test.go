@@ -0,0 +1,252 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records commands and answers them from a table keyed by the
+// joined command line. Unknown commands succeed with no output.
+type fakeRunner struct {
+	calls   []string
+	outputs map[string]string
+	fail    map[string]bool
+}
+
+func (f *fakeRunner) Run(name string, args ...string) (string, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, line)
+	if f.fail[line] {
+		return f.outputs[line], errors.New("exit status 1")
+	}
+	return f.outputs[line], nil
+}
+
+func TestSystemd(t *testing.T) {
+	run := &fakeRunner{outputs: map[string]string{
+		"systemctl --user is-enabled synq.service":                          "enabled",
+		"systemctl --user show synq.service --property=ActiveState,MainPID": "ActiveState=active\nMainPID=4242",
+	}}
+	opts := ServiceOptions{ConfigDir: "/home/me/.config/synq", Binary: "/usr/local/bin/synq"}
+	s := &systemd{run: run, opts: opts, unitDir: t.TempDir()}
+
+	st, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Installed {
+		t.Error("Installed before Install")
+	}
+
+	if err := s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	unit, err := os.ReadFile(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(unit), "ExecStart=/usr/local/bin/synq daemon start --foreground --config-dir /home/me/.config/synq\n") {
+		t.Errorf("unit = %q", unit)
+	}
+
+	if err := s.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	st, err = s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ServiceStatus{Installed: true, Enabled: true, Running: true, PID: 4242}
+	if st != want {
+		t.Errorf("Status = %+v, want %+v", st, want)
+	}
+
+	if err := s.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Path()); !os.IsNotExist(err) {
+		t.Error("unit still exists after Uninstall")
+	}
+
+	for _, call := range []string{
+		"systemctl --user daemon-reload",
+		"systemctl --user enable --now synq.service",
+		"systemctl --user disable --now synq.service",
+	} {
+		if !slices.Contains(run.calls, call) {
+			t.Errorf("missing call %q in %q", call, run.calls)
+		}
+	}
+}
+
+func TestSystemdInstance(t *testing.T) {
+	run := &fakeRunner{}
+	opts := ServiceOptions{ConfigDir: "/home/me/work 100%", Instance: "work", Verbose: true, Binary: "/usr/local/bin/synq"}
+	s := &systemd{run: run, opts: opts, unitDir: t.TempDir()}
+	if err := s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filepath.Base(s.Path()), "synq@work.service"; got != want {
+		t.Errorf("unit = %q, want %q", got, want)
+	}
+	unit, err := os.ReadFile(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Description=synq configuration sync daemon (work)\n",
+		`ExecStart=/usr/local/bin/synq daemon start --foreground --config-dir "/home/me/work 100%%" --verbose` + "\n",
+	} {
+		if !strings.Contains(string(unit), want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+
+	if err := s.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(run.calls, "systemctl --user enable --now synq@work.service") {
+		t.Errorf("calls = %q", run.calls)
+	}
+}
+
+func TestValidateInstance(t *testing.T) {
+	for _, name := range []string{"", "work", "home_2", "a-b"} {
+		if err := ValidateInstance(name); err != nil {
+			t.Errorf("ValidateInstance(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"-x", "a b", "a/b", "a.b", "a@b"} {
+		if err := ValidateInstance(name); err == nil {
+			t.Errorf("ValidateInstance(%q) = nil, want error", name)
+		}
+	}
+}
+
+func TestSystemdError(t *testing.T) {
+	run := &fakeRunner{
+		outputs: map[string]string{"systemctl --user start synq.service": "Unit synq.service not found."},
+		fail:    map[string]bool{"systemctl --user start synq.service": true},
+	}
+	s := &systemd{run: run, unitDir: t.TempDir()}
+	err := s.Start()
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Start error = %v, want the systemctl output", err)
+	}
+}
+
+func TestLaunchd(t *testing.T) {
+	const target = "gui/501/" + launchdLabel
+	run := &fakeRunner{
+		outputs: map[string]string{
+			"launchctl print-disabled gui/501": "disabled services = {\n\t\"" + launchdLabel + "\" => disabled\n}",
+		},
+		fail: map[string]bool{"launchctl print " + target: true},
+	}
+	opts := ServiceOptions{ConfigDir: t.TempDir(), Binary: "/usr/local/bin/synq"}
+	l := &launchd{run: run, opts: opts, agentDir: t.TempDir(), uid: 501}
+
+	if err := l.Install(); err != nil {
+		t.Fatal(err)
+	}
+	plist, err := os.ReadFile(l.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(plist), "<string>/usr/local/bin/synq</string>") {
+		t.Errorf("plist = %q", plist)
+	}
+	if !strings.Contains(string(plist), "<string>--config-dir</string>\n        <string>"+opts.ConfigDir+"</string>") {
+		t.Errorf("plist does not pass the config dir: %q", plist)
+	}
+	if _, err := os.Stat(filepath.Join(opts.ConfigDir, "logs")); err != nil {
+		t.Errorf("log dir not created: %v", err)
+	}
+
+	st, err := l.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ServiceStatus{Installed: true}); st != want {
+		t.Errorf("Status = %+v, want %+v", st, want)
+	}
+
+	// Enabling bootstraps the agent when it is not loaded.
+	if err := l.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range []string{
+		"launchctl enable " + target,
+		"launchctl bootstrap gui/501 " + l.Path(),
+	} {
+		if !slices.Contains(run.calls, call) {
+			t.Errorf("missing call %q in %q", call, run.calls)
+		}
+	}
+
+	// Once loaded, status comes from launchctl print.
+	run.fail = nil
+	run.outputs["launchctl print "+target] = "gui/501/com.synq.daemon = {\n\tstate = running\n\tpid = 777\n}"
+	run.outputs["launchctl print-disabled gui/501"] = "disabled services = {\n\t\"" + launchdLabel + "\" => enabled\n}"
+	st, err = l.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ServiceStatus{Installed: true, Enabled: true, Running: true, PID: 777}); st != want {
+		t.Errorf("Status = %+v, want %+v", st, want)
+	}
+
+	run.calls = nil
+	if err := l.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(run.calls, "launchctl bootout "+target) {
+		t.Errorf("Stop calls = %q, want bootout", run.calls)
+	}
+}
+
+func TestLaunchdInstance(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a&b")
+	opts := ServiceOptions{ConfigDir: dir, Instance: "work", Binary: "/usr/local/bin/synq"}
+	l := &launchd{run: &fakeRunner{}, opts: opts, agentDir: t.TempDir(), uid: 501}
+	if err := l.Install(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filepath.Base(l.Path()), launchdLabel+".work.plist"; got != want {
+		t.Errorf("plist = %q, want %q", got, want)
+	}
+	plist, err := os.ReadFile(l.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<string>" + launchdLabel + ".work</string>", "<string>" + strings.ReplaceAll(dir, "&", "&amp;") + "</string>"} {
+		if !strings.Contains(string(plist), want) {
+			t.Errorf("plist missing %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestInSynqUnit(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   bool
+	}{
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/synq.service\n", true},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/synq@work.service\n", true},
+		{"12:pids:/user.slice\n1:name=systemd:/user.slice/user-1000.slice/user@1000.service/synq.service\n", true},
+		// A shell in another service's unit inherits INVOCATION_ID.
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/tmux-spawn-1.scope\n", false},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/code-server.service\n", false},
+		{"0::/user.slice/user-1000.slice/session-3.scope\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := inSynqUnit(tt.cgroup); got != tt.want {
+			t.Errorf("inSynqUnit(%q) = %v, want %v", tt.cgroup, got, tt.want)
+		}
+	}
+}
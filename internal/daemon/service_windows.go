@@ -2,14 +2,13 @@
 
 package daemon
 
-import "fmt"
-
-// InstallService is a stub on Windows.
-func InstallService(configDir string) error {
-	return fmt.Errorf("automatic service installation is not supported on Windows; use Task Scheduler manually")
+// NewServiceManager returns ErrServiceUnsupported; use Task Scheduler to
+// run "synq daemon start --foreground" at logon.
+func NewServiceManager(opts ServiceOptions) (ServiceManager, error) {
+	return nil, ErrServiceUnsupported
 }
 
-// UninstallService is a stub on Windows.
-func UninstallService() error {
-	return fmt.Errorf("automatic service removal is not supported on Windows")
+// UnderServiceManager always reports false on Windows.
+func UnderServiceManager() bool {
+	return false
 }
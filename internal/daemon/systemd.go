@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const systemdUnit = `[Unit]
+Description=%s
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=default.target
+`
+
+// systemd manages the daemon as a systemd user unit. Named instances get
+// their own synq@<instance>.service file; systemd reads an instance's own
+// file before falling back to a synq@.service template, so each instance
+// carries its full command line.
+type systemd struct {
+	run     Runner
+	opts    ServiceOptions
+	unitDir string
+}
+
+func (s *systemd) Name() string { return "systemd" }
+
+func (s *systemd) unit() string {
+	if s.opts.Instance == "" {
+		return "synq.service"
+	}
+	return "synq@" + s.opts.Instance + ".service"
+}
+
+func (s *systemd) Path() string { return filepath.Join(s.unitDir, s.unit()) }
+
+func (s *systemd) systemctl(args ...string) error {
+	args = append([]string{"--user"}, args...)
+	if out, err := s.run.Run("systemctl", args...); err != nil {
+		return fmt.Errorf("systemctl %s: %s", strings.Join(args, " "), out)
+	}
+	return nil
+}
+
+func (s *systemd) Install() error {
+	command, err := s.opts.command()
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = systemdQuote(arg)
+	}
+	desc := "synq configuration sync daemon"
+	if s.opts.Instance != "" {
+		desc += " (" + s.opts.Instance + ")"
+	}
+
+	if err := os.MkdirAll(s.unitDir, 0o755); err != nil {
+		return err
+	}
+	unit := fmt.Sprintf(systemdUnit, desc, strings.Join(quoted, " "))
+	if err := os.WriteFile(s.Path(), []byte(unit), 0o644); err != nil {
+		return err
+	}
+	return s.systemctl("daemon-reload")
+}
+
+func (s *systemd) Uninstall() error {
+	_ = s.systemctl("disable", "--now", s.unit())
+	if err := os.Remove(s.Path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.systemctl("daemon-reload")
+}
+
+func (s *systemd) Enable() error  { return s.systemctl("enable", "--now", s.unit()) }
+func (s *systemd) Disable() error { return s.systemctl("disable", "--now", s.unit()) }
+func (s *systemd) Start() error   { return s.systemctl("start", s.unit()) }
+func (s *systemd) Stop() error    { return s.systemctl("stop", s.unit()) }
+
+func (s *systemd) Status() (ServiceStatus, error) {
+	var st ServiceStatus
+	if _, err := os.Stat(s.Path()); err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return st, err
+	}
+	st.Installed = true
+
+	// is-enabled exits non-zero for disabled units, so only the output counts.
+	out, _ := s.run.Run("systemctl", "--user", "is-enabled", s.unit())
+	st.Enabled = out == "enabled"
+
+	out, err := s.run.Run("systemctl", "--user", "show", s.unit(), "--property=ActiveState,MainPID")
+	if err != nil {
+		return st, fmt.Errorf("systemctl show: %s", out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "ActiveState":
+			st.Running = value == "active" || value == "activating" || value == "reloading"
+		case "MainPID":
+			st.PID, _ = strconv.Atoi(value)
+		}
+	}
+	return st, nil
+}
+
+func (s *systemd) LogsCommand(lines int, follow bool) (string, []string) {
+	args := []string{"--user", "--unit", s.unit(), "--lines", strconv.Itoa(lines), "--no-pager"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	return "journalctl", args
+}
+
+// inSynqUnit reports whether the contents of /proc/<pid>/cgroup put the
+// process in synq.service or an instance of it.
+func inSynqUnit(cgroup string) bool {
+	for _, line := range strings.Split(strings.TrimSpace(cgroup), "\n") {
+		// hierarchy-ID:controllers:path, with the unit as the last element
+		// of the path, or before a sub-cgroup of it.
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, elem := range strings.Split(parts[2], "/") {
+			if elem == "synq.service" || strings.HasPrefix(elem, "synq@") && strings.HasSuffix(elem, ".service") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// systemdQuote quotes arg for an ExecStart line, escaping the specifiers and
+// variables systemd would otherwise expand.
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -1,7 +1,10 @@
 package daemon
 
 import (
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,12 +16,14 @@ const debounceInterval = 2 * time.Second
 
 // Watcher wraps fsnotify with debouncing.
 type Watcher struct {
-	fsw       *fsnotify.Watcher
-	onChange  func()
-	log       *zerolog.Logger
-	mu        sync.Mutex
-	timer     *time.Timer
-	watching  map[string]bool
+	fsw      *fsnotify.Watcher
+	onChange func()
+	log      *zerolog.Logger
+	mu       sync.Mutex
+	timer    *time.Timer
+	watching map[string]bool
+	trees    map[string]bool
+	filter   func(path string, isDir bool) bool
 }
 
 // NewWatcher creates a new file watcher.
@@ -32,9 +37,25 @@ func NewWatcher(onChange func(), log *zerolog.Logger) (*Watcher, error) {
 		onChange: onChange,
 		log:      log,
 		watching: make(map[string]bool),
+		trees:    make(map[string]bool),
 	}, nil
 }
 
+// SetFilter sets a function that reports paths whose events should be
+// ignored. Ignored directories are also not watched by WatchTree.
+func (w *Watcher) SetFilter(filter func(path string, isDir bool) bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.filter = filter
+}
+
+func (w *Watcher) ignored(path string, isDir bool) bool {
+	w.mu.Lock()
+	filter := w.filter
+	w.mu.Unlock()
+	return filter != nil && filter(path, isDir)
+}
+
 // WatchPaths adds parent directories of the given paths to the watcher.
 func (w *Watcher) WatchPaths(paths []string) {
 	dirs := make(map[string]bool)
@@ -43,16 +64,65 @@ func (w *Watcher) WatchPaths(paths []string) {
 		dirs[dir] = true
 	}
 	for dir := range dirs {
-		if w.watching[dir] {
-			continue
+		w.watchDir(dir)
+	}
+}
+
+// Count returns the number of watched directories.
+func (w *Watcher) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.watching)
+}
+
+// WatchTree adds root and every non-ignored directory below it. Directories
+// created inside the tree later are picked up automatically.
+func (w *Watcher) WatchTree(root string) {
+	w.mu.Lock()
+	w.trees[root] = true
+	w.mu.Unlock()
+	w.walk(root)
+}
+
+func (w *Watcher) walk(root string) {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
 		}
-		if err := w.fsw.Add(dir); err != nil {
-			w.log.Warn().Err(err).Str("dir", dir).Msg("failed to watch directory")
-			continue
+		if path != root && w.ignored(path, true) {
+			return filepath.SkipDir
+		}
+		w.watchDir(path)
+		return nil
+	})
+	if err != nil {
+		w.log.Warn().Err(err).Str("dir", root).Msg("failed to walk directory")
+	}
+}
+
+func (w *Watcher) watchDir(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watching[dir] {
+		return
+	}
+	if err := w.fsw.Add(dir); err != nil {
+		w.log.Warn().Err(err).Str("dir", dir).Msg("failed to watch directory")
+		return
+	}
+	w.watching[dir] = true
+	w.log.Debug().Str("dir", dir).Msg("watching directory")
+}
+
+func (w *Watcher) inTree(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for root := range w.trees {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
 		}
-		w.watching[dir] = true
-		w.log.Debug().Str("dir", dir).Msg("watching directory")
 	}
+	return false
 }
 
 // Start begins listening for events in a goroutine.
@@ -67,6 +137,14 @@ func (w *Watcher) Start() {
 				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
 					continue
 				}
+				info, err := os.Lstat(event.Name)
+				isDir := err == nil && info.IsDir()
+				if w.ignored(event.Name, isDir) {
+					continue
+				}
+				if isDir && event.Op&fsnotify.Create != 0 && w.inTree(event.Name) {
+					w.walk(event.Name)
+				}
 				w.log.Debug().Str("file", event.Name).Str("op", event.Op.String()).Msg("file changed")
 				w.debounce()
 
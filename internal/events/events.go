@@ -0,0 +1,231 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/gitops"
+)
+
+// FileName is the event journal inside the config dir. It is append-only:
+// one JSON object per line.
+const FileName = "events.jsonl"
+
+// Type classifies an event.
+type Type string
+
+const (
+	Synced   Type = "synced"
+	Pushed   Type = "pushed"
+	Pulled   Type = "pulled"
+	Conflict Type = "conflict"
+	Backup   Type = "backup"
+	Applied  Type = "applied"
+	Captured Type = "captured"
+	Hook     Type = "hook"
+	Script   Type = "script"
+	Failed   Type = "failed"
+	// Quarantine is a pull held back because its commits were not signed
+	// by a trusted machine.
+	Quarantine Type = "quarantine"
+)
+
+// Event is one entry in the journal.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type Type      `json:"type"`
+	// Name is the entry, hook owner or script the event is about.
+	Name    string            `json:"name,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// WithSource returns e tagged with the named source it concerns.
+func (e Event) WithSource(name string) Event {
+	data := make(map[string]string, len(e.Data)+1)
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	data["source"] = name
+	e.Data = data
+	return e
+}
+
+// Path returns the journal path in configDir.
+func Path(configDir string) string {
+	return filepath.Join(configDir, FileName)
+}
+
+// Record appends events to the journal. Events without a time are stamped
+// with the current time. Each event is a single write, so concurrent
+// writers never interleave within a line.
+func Record(configDir string, list ...Event) error {
+	if len(list) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(Path(configDir), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	now := time.Now().UTC()
+	for _, e := range list {
+		if e.Time.IsZero() {
+			e.Time = now
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Results turns apply results into events.
+func Results(results []apply.Result) []Event {
+	var list []Event
+	for _, res := range results {
+		if res.Backup != "" {
+			list = append(list, Event{Type: Backup, Name: res.Name, Message: "backed up conflicting file",
+				Data: map[string]string{"target": res.Target, "backup": res.Backup}})
+		}
+		switch res.Action {
+		case apply.ActionLinked, apply.ActionCopied, apply.ActionWritten:
+			list = append(list, Event{Type: Applied, Name: res.Name, Message: string(res.Action),
+				Data: map[string]string{"target": res.Target}})
+		case apply.ActionCaptured:
+			list = append(list, Event{Type: Captured, Name: res.Name, Message: "captured target edits",
+				Data: map[string]string{"target": res.Target}})
+		case apply.ActionKept:
+			list = append(list, Event{Type: Conflict, Name: res.Name, Message: fmt.Sprint(res.Err),
+				Data: map[string]string{"target": res.Target}})
+		case apply.ActionFailed:
+			list = append(list, Event{Type: Failed, Name: res.Name, Message: fmt.Sprint(res.Err)})
+		}
+		for _, h := range res.Hooks {
+			e := Event{Type: Hook, Name: h.Name, Data: map[string]string{"hook": string(h.Kind)}}
+			switch {
+			case h.Skipped != "":
+				e.Message = "skipped: " + h.Skipped
+			case h.Err != nil:
+				e.Message = "failed: " + h.Err.Error()
+			default:
+				e.Message = "ran in " + h.Duration.Round(time.Millisecond).String()
+			}
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// PullFailure returns the event for a failed pull.
+func PullFailure(err error) Event {
+	if gitops.IsConflict(err) {
+		return Event{Type: Conflict, Message: err.Error()}
+	}
+	var unverified *gitops.UnverifiedError
+	if errors.As(err, &unverified) {
+		return Event{Type: Quarantine, Message: err.Error(), Data: map[string]string{"upstream": unverified.Upstream}}
+	}
+	return Event{Type: Failed, Name: "pull", Message: err.Error()}
+}
+
+// Read returns the events recorded at or after since, and the journal
+// offset to pass to Follow.
+func Read(configDir string, since time.Time) ([]Event, int64, error) {
+	f, err := os.Open(Path(configDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var list []Event
+	n, err := scan(f, func(e Event) {
+		if !e.Time.Before(since) {
+			list = append(list, e)
+		}
+	})
+	return list, n, err
+}
+
+// Follow calls fn for every event recorded past offset, polling the
+// journal until ctx is done.
+func Follow(ctx context.Context, configDir string, offset int64, interval time.Duration, fn func(Event)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		f, err := os.Open(Path(configDir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				offset = 0
+				continue
+			}
+			return err
+		}
+		if info, err := f.Stat(); err == nil && info.Size() < offset {
+			// The journal was truncated or replaced; start over.
+			offset = 0
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return err
+		}
+		n, err := scan(f, fn)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		offset += n
+	}
+}
+
+// scan calls fn for each complete line in r and returns the number of bytes
+// consumed. A trailing partial line is left for the next read; malformed
+// lines are skipped.
+func scan(r io.Reader, fn func(Event)) (int64, error) {
+	br := bufio.NewReader(r)
+	var consumed int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return consumed, nil
+		}
+		if err != nil {
+			return consumed, err
+		}
+		consumed += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if json.Unmarshal(line, &e) == nil {
+			fn(e)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/apply"
+	"github.com/ihavespoons/synq/internal/hooks"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	configDir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	if err := Record(configDir,
+		Event{Time: old, Type: Pulled},
+		Event{Type: Pushed, Name: "zshrc", Message: "Add zshrc"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	all, _, err := Read(configDir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("Read() = %d events, want 2", len(all))
+	}
+	if all[1].Time.IsZero() {
+		t.Error("expected Record to stamp the time")
+	}
+
+	recent, _, err := Read(configDir, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0].Type != Pushed || recent[0].Name != "zshrc" {
+		t.Errorf("Read(since) = %+v, want the push only", recent)
+	}
+}
+
+func TestRead_SkipsPartialAndMalformedLines(t *testing.T) {
+	configDir := t.TempDir()
+	data := `{"time":"2026-01-01T00:00:00Z","type":"synced"}` + "\nnot json\n" + `{"time":"2026-01-01T00:00:01Z","type":"pu`
+	if err := os.WriteFile(Path(configDir), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list, offset, err := Read(configDir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Type != Synced {
+		t.Errorf("Read() = %+v, want one synced event", list)
+	}
+	if want := int64(len(data) - len(`{"time":"2026-01-01T00:00:01Z","type":"pu`)); offset != want {
+		t.Errorf("offset = %d, want %d (before the partial line)", offset, want)
+	}
+}
+
+func TestResults(t *testing.T) {
+	list := Results([]apply.Result{
+		{Name: "ssh", Action: apply.ActionLinked, Target: "/h/.ssh/config", Backup: "/h/.ssh/config.conflict-1"},
+		{Name: "pgpass", Action: apply.ActionFailed, Err: errors.New("boom")},
+		{Name: "tmux", Action: apply.ActionUnchanged, Hooks: []hooks.Result{{Name: "tmux", Kind: hooks.PostChange}}},
+	})
+	var types []Type
+	for _, e := range list {
+		types = append(types, e.Type)
+	}
+	want := []Type{Backup, Applied, Failed, Hook}
+	if len(types) != len(want) {
+		t.Fatalf("types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("types = %v, want %v", types, want)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	configDir := t.TempDir()
+	if err := Record(configDir, Event{Type: Pulled}); err != nil {
+		t.Fatal(err)
+	}
+	_, offset, err := Read(configDir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got := make(chan Event, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, configDir, offset, 10*time.Millisecond, func(e Event) { got <- e })
+	}()
+
+	if err := Record(configDir, Event{Type: Pushed}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-got:
+		if e.Type != Pushed {
+			t.Errorf("first followed event = %s, want pushed", e.Type)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for event")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
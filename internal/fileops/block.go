@@ -0,0 +1,152 @@
+package fileops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Block is a managed section of a text file, delimited by a begin and an
+// end marker line. The rest of the file is left alone.
+type Block struct {
+	Begin string
+	End   string
+}
+
+// NewBlock returns the block for the named entry, with markers such as
+// "# BEGIN synq:<name>" written after comment.
+func NewBlock(comment, name string) Block {
+	return Block{
+		Begin: comment + " BEGIN synq:" + name,
+		End:   comment + " END synq:" + name,
+	}
+}
+
+// NormalizeBlock ends non-empty block content with a newline, the way it is
+// stored between the markers.
+func NormalizeBlock(content []byte) []byte {
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content[:len(content):len(content)], '\n')
+	}
+	return content
+}
+
+// locate returns the byte offsets of the begin marker line, the block
+// content and the end of the end marker line in data. found is false when
+// the file has no block.
+func (b Block) locate(data []byte) (start, contentStart, contentEnd, end int, found bool, err error) {
+	start, end = -1, -1
+	for off := 0; off < len(data); {
+		next := bytes.IndexByte(data[off:], '\n')
+		lineEnd := len(data)
+		if next != -1 {
+			lineEnd = off + next + 1
+		}
+		line := string(bytes.TrimRight(data[off:lineEnd], " \t\r\n"))
+		switch {
+		case line == b.Begin:
+			if start != -1 {
+				return 0, 0, 0, 0, false, fmt.Errorf("%q appears twice", b.Begin)
+			}
+			start, contentStart = off, lineEnd
+		case line == b.End:
+			if start == -1 || end != -1 {
+				return 0, 0, 0, 0, false, fmt.Errorf("%q without a matching %q", b.End, b.Begin)
+			}
+			contentEnd, end = off, lineEnd
+		}
+		off = lineEnd
+	}
+	if start != -1 && end == -1 {
+		return 0, 0, 0, 0, false, fmt.Errorf("%q without a matching %q", b.Begin, b.End)
+	}
+	return start, contentStart, contentEnd, end, start != -1, nil
+}
+
+// Read returns the content between the markers in the file at path. found
+// is false when the file or the block does not exist.
+func (b Block) Read(path string) (content []byte, found bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	_, cs, ce, _, found, err := b.locate(data)
+	if err != nil || !found {
+		return nil, false, wrapBlockErr(path, err)
+	}
+	return data[cs:ce], true, nil
+}
+
+// Write replaces the content between the markers in the file at path,
+// appending the block when the file has none and creating the file when it
+// does not exist. It reports whether the file changed.
+func (b Block) Write(path string, content []byte) (bool, error) {
+	content = NormalizeBlock(content)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	start, cs, ce, end, found, err := b.locate(data)
+	if err != nil {
+		return false, wrapBlockErr(path, err)
+	}
+
+	var out bytes.Buffer
+	if found {
+		if bytes.Equal(data[cs:ce], content) {
+			return false, nil
+		}
+		out.Write(data[:start])
+	} else {
+		out.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+	out.WriteString(b.Begin + "\n")
+	out.Write(content)
+	out.WriteString(b.End + "\n")
+	if found {
+		out.Write(data[end:])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	// Write in place so the file keeps its owner and permissions.
+	return true, os.WriteFile(path, out.Bytes(), 0o644)
+}
+
+// Remove deletes the block from the file at path. With keepContent only the
+// marker lines are removed. It reports whether the file changed.
+func (b Block) Remove(path string, keepContent bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	start, cs, ce, end, found, err := b.locate(data)
+	if err != nil || !found {
+		return false, wrapBlockErr(path, err)
+	}
+	var out bytes.Buffer
+	out.Write(data[:start])
+	if keepContent {
+		out.Write(data[cs:ce])
+	}
+	out.Write(data[end:])
+	return true, os.WriteFile(path, out.Bytes(), 0o644)
+}
+
+func wrapBlockErr(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", TildePath(path), err)
+}
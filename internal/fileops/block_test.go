@@ -0,0 +1,89 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	b := NewBlock("#", "path")
+	if b.Begin != "# BEGIN synq:path" || b.End != "# END synq:path" {
+		t.Fatalf("NewBlock() = %+v", b)
+	}
+	if err := os.WriteFile(path, []byte("# installer\nexport A=1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, err := b.Read(path); err != nil || found {
+		t.Fatalf("Read() found = %v, err = %v; want no block", found, err)
+	}
+	if changed, err := b.Write(path, []byte("export PATH=~/bin:$PATH")); err != nil || !changed {
+		t.Fatalf("Write() = %v, %v", changed, err)
+	}
+	want := "# installer\nexport A=1\n# BEGIN synq:path\nexport PATH=~/bin:$PATH\n# END synq:path\n"
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("after append:\n%s\nwant:\n%s", data, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+
+	// Lines after the block survive updates in place.
+	if err := os.WriteFile(path, []byte(want+"# added later\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := b.Write(path, []byte("export PATH=~/bin:$PATH\n")); err != nil || changed {
+		t.Errorf("Write() of same content = %v, %v; want unchanged", changed, err)
+	}
+	if _, err := b.Write(path, []byte("a\nb\n")); err != nil {
+		t.Fatal(err)
+	}
+	want = "# installer\nexport A=1\n# BEGIN synq:path\na\nb\n# END synq:path\n# added later\n"
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("after update:\n%s\nwant:\n%s", data, want)
+	}
+	if content, found, err := b.Read(path); err != nil || !found || string(content) != "a\nb\n" {
+		t.Errorf("Read() = %q, %v, %v", content, found, err)
+	}
+
+	if _, err := b.Remove(path, true); err != nil {
+		t.Fatal(err)
+	}
+	want = "# installer\nexport A=1\na\nb\n# added later\n"
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("after remove:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestBlockMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	b := NewBlock("#", "dev")
+	for _, data := range []string{
+		"# BEGIN synq:dev\n127.0.0.1 dev\n",
+		"127.0.0.1 dev\n# END synq:dev\n",
+		"# BEGIN synq:dev\n# END synq:dev\n# BEGIN synq:dev\n# END synq:dev\n",
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := b.Read(path); err == nil {
+			t.Errorf("Read(%q) = nil error", data)
+		}
+		if _, err := b.Write(path, []byte("x")); err == nil {
+			t.Errorf("Write(%q) = nil error", data)
+		}
+	}
+}
+
+func TestBlockCreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "conf")
+	b := NewBlock("//", "x")
+	if _, err := b.Write(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "// BEGIN synq:x\n// END synq:x\n" {
+		t.Errorf("created file = %q", data)
+	}
+}
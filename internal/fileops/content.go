@@ -0,0 +1,51 @@
+package fileops
+
+import (
+	"bytes"
+	"os"
+)
+
+// SameContent reports whether the regular files a and b have identical
+// contents. A missing file never matches.
+func SameContent(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
+
+// EnsureMode sets the permission bits of path to mode. It returns the
+// previous permission and whether it had drifted from mode.
+func EnsureMode(path string, mode os.FileMode) (os.FileMode, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false, err
+	}
+	prev := info.Mode().Perm()
+	if prev == mode.Perm() {
+		return prev, false, nil
+	}
+	return prev, true, os.Chmod(path, mode.Perm())
+}
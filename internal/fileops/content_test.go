@@ -0,0 +1,67 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSameContent(t *testing.T) {
+	tmp := t.TempDir()
+	a := filepath.Join(tmp, "a")
+	b := filepath.Join(tmp, "b")
+	if err := os.WriteFile(a, []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("same"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := SameContent(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same {
+		t.Error("expected identical files to match")
+	}
+
+	if err := os.WriteFile(b, []byte("diff"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := SameContent(a, b); same {
+		t.Error("expected different files not to match")
+	}
+	if same, _ := SameContent(a, filepath.Join(tmp, "missing")); same {
+		t.Error("expected missing file not to match")
+	}
+}
+
+func TestEnsureMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not enforced on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prev, drifted, err := EnsureMode(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drifted || prev != 0o644 {
+		t.Errorf("EnsureMode() = %o, %v; want 644, true", prev, drifted)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %o, want 600", info.Mode().Perm())
+	}
+
+	if _, drifted, _ := EnsureMode(path, 0o600); drifted {
+		t.Error("expected no drift on second call")
+	}
+}
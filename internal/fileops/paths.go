@@ -2,6 +2,7 @@ package fileops
 
 import (
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -47,3 +48,27 @@ func TildePath(abs string) string {
 	}
 	return abs
 }
+
+// DefaultSource returns the repo-relative source path that mirrors abs.
+// Home-relative files are stored under home/, everything else under root/.
+func DefaultSource(abs string) string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(home, abs); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return path.Join("home", filepath.ToSlash(rel))
+		}
+	}
+	rel := strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	rel = strings.TrimLeft(filepath.ToSlash(rel), "/")
+	return path.Join("root", rel)
+}
+
+// RemoveEmptyDirs removes dir and its parents while they are empty,
+// stopping at (and never removing) stop.
+func RemoveEmptyDirs(dir, stop string) {
+	stop = filepath.Clean(stop)
+	for dir = filepath.Clean(dir); dir != stop && strings.HasPrefix(dir, stop+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
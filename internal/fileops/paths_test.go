@@ -76,3 +76,44 @@ func TestTildePath_NonHome(t *testing.T) {
 		t.Errorf("TildePath(/tmp/something) = %q", got)
 	}
 }
+
+func TestDefaultSource(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home dir")
+	}
+	got := DefaultSource(filepath.Join(home, ".config", "git", "config"))
+	if got != "home/.config/git/config" {
+		t.Errorf("DefaultSource() = %q, want %q", got, "home/.config/git/config")
+	}
+}
+
+func TestDefaultSource_NonHome(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+	got := DefaultSource("/etc/hosts")
+	if got != "root/etc/hosts" {
+		t.Errorf("DefaultSource(/etc/hosts) = %q", got)
+	}
+}
+
+func TestRemoveEmptyDirs(t *testing.T) {
+	tmp := t.TempDir()
+	deep := filepath.Join(tmp, "a", "b", "c")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "a", "keep"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	RemoveEmptyDirs(deep, tmp)
+
+	if _, err := os.Stat(filepath.Join(tmp, "a", "b")); !os.IsNotExist(err) {
+		t.Error("expected a/b to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "a")); err != nil {
+		t.Error("expected non-empty a to be kept")
+	}
+}
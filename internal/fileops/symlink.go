@@ -3,6 +3,7 @@ package fileops
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -34,6 +35,76 @@ func CopyFile(src, dst string) error {
 	return err
 }
 
+// CopyFileMode copies src to dst and sets dst's permissions to mode. A new
+// dst is created with mode directly, so it is never readable more widely.
+func CopyFileMode(src, dst string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("create parent dir: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+
+	if err := out.Chmod(mode.Perm()); err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// CopyDir recursively copies the directory src to dst, preserving file
+// modes and recreating symlinks.
+func CopyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(out, info.Mode().Perm())
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return CreateSymlink(link, out)
+		default:
+			return CopyFile(path, out)
+		}
+	})
+}
+
+// CopyPath copies src to dst, whether src is a file or a directory.
+func CopyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return CopyDir(src, dst)
+	}
+	return CopyFile(src, dst)
+}
+
 // CreateSymlink creates a symlink at linkPath pointing to target.
 // It removes any existing file at linkPath first.
 func CreateSymlink(target, linkPath string) error {
@@ -51,13 +122,14 @@ func CreateSymlink(target, linkPath string) error {
 	return os.Symlink(target, linkPath)
 }
 
-// RemoveSymlink removes a symlink and copies the target file back to the link location.
+// RemoveSymlink removes a symlink and copies the target file or directory
+// back to the link location.
 func RemoveSymlink(linkPath, repoFilePath string) error {
 	info, err := os.Lstat(linkPath)
 	if err != nil {
 		// Link doesn't exist; just copy from repo if the repo file exists.
 		if os.IsNotExist(err) {
-			return CopyFile(repoFilePath, linkPath)
+			return CopyPath(repoFilePath, linkPath)
 		}
 		return err
 	}
@@ -71,7 +143,7 @@ func RemoveSymlink(linkPath, repoFilePath string) error {
 		return fmt.Errorf("remove symlink: %w", err)
 	}
 
-	return CopyFile(repoFilePath, linkPath)
+	return CopyPath(repoFilePath, linkPath)
 }
 
 // IsSymlinkTo returns true if path is a symlink pointing to target.
@@ -153,3 +153,34 @@ func TestRemoveSymlink(t *testing.T) {
 		t.Errorf("restored content = %q, want %q", string(data), "repo content")
 	}
 }
+
+func TestCopyDir(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	if err := os.MkdirAll(filepath.Join(src, "lua", "plugins"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "init.lua"), []byte("init"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "lua", "plugins", "a.lua"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyPath(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "lua", "plugins", "a.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a" {
+		t.Errorf("copied content = %q, want %q", string(data), "a")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "init.lua")); err != nil {
+		t.Errorf("expected init.lua to be copied: %v", err)
+	}
+}
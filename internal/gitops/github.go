@@ -74,3 +74,21 @@ func GetCloneURL(user, repo string) (string, error) {
 	}
 	return result.SSHURL, nil
 }
+
+// RequiresSignatures reports whether the repo's default branch only
+// accepts signed commits, through branch protection or a ruleset. Settings
+// the gh CLI cannot read count as not required.
+func RequiresSignatures(user, repo string) bool {
+	out, err := exec.Command("gh", "repo", "view", user+"/"+repo, "--json", "defaultBranchRef", "--jq", ".defaultBranchRef.name").Output()
+	branch := strings.TrimSpace(string(out))
+	if err != nil || branch == "" {
+		return false
+	}
+	base := "repos/" + user + "/" + repo + "/"
+	out, err = exec.Command("gh", "api", base+"branches/"+branch+"/protection/required_signatures", "--jq", ".enabled").Output()
+	if err == nil && strings.TrimSpace(string(out)) == "true" {
+		return true
+	}
+	out, err = exec.Command("gh", "api", base+"rules/branches/"+branch, "--jq", `[.[] | select(.type == "required_signatures")] | length`).Output()
+	return err == nil && strings.TrimSpace(string(out)) != "0"
+}
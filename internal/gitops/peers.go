@@ -0,0 +1,44 @@
+package gitops
+
+import "sort"
+
+// Peers is how git authenticates to machines serving their repos over
+// HTTPS to their peers. See SetPeers.
+type Peers struct {
+	// Cert and Key are the PEM files of this machine's client certificate.
+	Cert, Key string
+	// Pins maps the URLs peers serve at to the fingerprints of their keys,
+	// in curl's pinned public key format.
+	Pins map[string]string
+}
+
+// peers is applied to every git command.
+var peers Peers
+
+// SetPeers makes every later git command that talks to a URL in p.Pins
+// present p's certificate and accept only the pinned key, so that peer
+// remotes work like any other. Like SetObserver, it must be called before
+// any git command runs concurrently.
+func SetPeers(p Peers) {
+	peers = p
+}
+
+// args returns the git options that apply p. The peers' certificates are
+// self-signed, so the pinned key takes the place of a CA.
+func (p Peers) args() []string {
+	urls := make([]string, 0, len(p.Pins))
+	for url := range p.Pins {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	var args []string
+	for _, url := range urls {
+		args = append(args,
+			"-c", "http."+url+".sslCert="+p.Cert,
+			"-c", "http."+url+".sslKey="+p.Key,
+			"-c", "http."+url+".pinnedPubkey="+p.Pins[url],
+			"-c", "http."+url+".sslVerify=false",
+		)
+	}
+	return args
+}
@@ -1,27 +1,91 @@
 package gitops
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Filter reports whether a repo-relative, slash-separated path should be
+// left out when staging changes.
+type Filter func(path string) bool
+
+// observer receives the duration of every git command. See SetObserver.
+var observer func(command string, d time.Duration)
+
+// SetObserver registers fn to be called with the subcommand and duration of
+// every git invocation, e.g. to export latency metrics. It must be called
+// before any git command runs concurrently.
+func SetObserver(fn func(command string, d time.Duration)) {
+	observer = fn
+}
+
+// observe reports the duration of a git command started at start.
+func observe(args []string, start time.Time) {
+	if observer != nil {
+		observer(subcommand(args), time.Since(start))
+	}
+}
+
+// subcommand returns the git subcommand in args, skipping global options.
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c" || args[i] == "-C":
+			i++ // skip the option's value
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		}
+	}
+	return ""
+}
+
 func git(dir string, args ...string) (string, error) {
+	return gitInput(dir, "", args...)
+}
+
+func gitInput(dir, input string, args ...string) (string, error) {
+	args = append(append(signing.args(), peers.args()...), args...)
 	cmd := exec.Command("git", args...)
 	cmd.Dir = dir
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+	defer observe(args, time.Now())
 	out, err := cmd.CombinedOutput()
 	return strings.TrimSpace(string(out)), err
 }
 
+// gitOutput runs git like git does, but returns its standard output as it
+// is, for output whose whitespace matters. Standard error goes into the
+// error.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	args = append(append(signing.args(), peers.args()...), args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	defer observe(args, time.Now())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
 // Clone clones a repo to the given directory.
 func Clone(url, dir string) error {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
-	out, err := exec.Command("git", "clone", url, dir).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("git clone: %s", strings.TrimSpace(string(out)))
+	if out, err := git("", "clone", url, dir); err != nil {
+		return fmt.Errorf("git clone: %s", out)
 	}
 	return nil
 }
@@ -35,6 +99,17 @@ func Add(repoDir string, files ...string) error {
 	return nil
 }
 
+// Move renames a tracked file with git mv, creating parent directories.
+func Move(repoDir, from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(repoDir, to)), 0o755); err != nil {
+		return err
+	}
+	if out, err := git(repoDir, "mv", from, to); err != nil {
+		return fmt.Errorf("git mv: %s", out)
+	}
+	return nil
+}
+
 // AddAll stages all changes.
 func AddAll(repoDir string) error {
 	if out, err := git(repoDir, "add", "-A"); err != nil {
@@ -43,12 +118,63 @@ func AddAll(repoDir string) error {
 	return nil
 }
 
+// AddFiltered stages all changes except paths rejected by skip.
+// A nil skip stages everything.
+func AddFiltered(repoDir string, skip Filter) error {
+	if skip == nil {
+		return AddAll(repoDir)
+	}
+	paths, err := changedPaths(repoDir, skip)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	input := strings.Join(paths, "\x00")
+	if out, err := gitInput(repoDir, input, "add", "-A", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return fmt.Errorf("git add: %s", out)
+	}
+	return nil
+}
+
+// changedPaths lists modified, deleted and untracked paths not rejected by skip.
+func changedPaths(repoDir string, skip Filter) ([]string, error) {
+	out, err := gitOutput(repoDir, "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+
+	var paths []string
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		entry := fields[i]
+		if len(entry) < 4 {
+			continue
+		}
+		candidates := []string{entry[3:]}
+		// Renames and copies are followed by the original path.
+		if entry[0] == 'R' || entry[0] == 'C' {
+			if i+1 < len(fields) {
+				candidates = append(candidates, fields[i+1])
+			}
+			i++
+		}
+		for _, p := range candidates {
+			if skip == nil || !skip(p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths, nil
+}
+
 // Commit creates a commit with the given message.
 // Returns false if there was nothing to commit.
 func Commit(repoDir, message string) (bool, error) {
 	out, err := git(repoDir, "commit", "-m", message)
 	if err != nil {
-		if strings.Contains(out, "nothing to commit") {
+		if strings.Contains(out, "nothing to commit") || strings.Contains(out, "no changes added to commit") {
 			return false, nil
 		}
 		return false, fmt.Errorf("git commit: %s", out)
@@ -65,24 +191,198 @@ func Push(repoDir string) error {
 	return nil
 }
 
+// Unpushed returns the number of local commits not yet on the upstream
+// branch.
+func Unpushed(repoDir string) (int, error) {
+	out, err := git(repoDir, "rev-list", "--count", "@{upstream}..HEAD")
+	if err != nil {
+		return 0, fmt.Errorf("git rev-list: %s", out)
+	}
+	return strconv.Atoi(out)
+}
+
 // Pull pulls from origin. Returns true if new changes were fetched.
+// Local modifications that were not committed (such as ignored files that
+// are still tracked) are stashed around the rebase. With verification on
+// (see SetSigning), the upstream commits are checked before rebasing onto
+// them.
 func Pull(repoDir string) (bool, error) {
-	out, err := git(repoDir, "pull", "--rebase")
+	if !signing.Verify {
+		out, err := git(repoDir, "pull", "--rebase", "--autostash")
+		if err != nil {
+			return false, fmt.Errorf("git pull: %s", out)
+		}
+		return !strings.Contains(out, "Already up to date"), nil
+	}
+	if out, err := git(repoDir, "fetch", "--quiet"); err != nil {
+		return false, fmt.Errorf("git fetch: %s", out)
+	}
+	n, err := verifyUpstream(repoDir)
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if out, err := git(repoDir, "rebase", "--autostash", "@{upstream}"); err != nil {
+		return false, fmt.Errorf("git rebase: %s", out)
+	}
+	return true, nil
+}
+
+// Fetch fetches from origin and returns the upstream commit, leaving HEAD
+// and the working tree alone so that the incoming changes can be looked at
+// before PullTo rebases onto them. With verification on, the upstream
+// commits are checked as Pull checks them.
+func Fetch(repoDir string) (string, error) {
+	if out, err := git(repoDir, "fetch", "--quiet"); err != nil {
+		return "", fmt.Errorf("git fetch: %s", out)
+	}
+	if signing.Verify {
+		if _, err := verifyUpstream(repoDir); err != nil {
+			return "", err
+		}
+	}
+	out, err := git(repoDir, "rev-parse", "@{upstream}")
 	if err != nil {
-		return false, fmt.Errorf("git pull: %s", out)
+		return "", fmt.Errorf("git rev-parse: %s", out)
 	}
-	return !strings.Contains(out, "Already up to date"), nil
+	return out, nil
 }
 
-// HasChanges returns true if there are uncommitted changes.
-func HasChanges(repoDir string) bool {
-	out, _ := git(repoDir, "status", "--porcelain")
-	return out != ""
+// Mirror makes a read-only clone match its upstream, discarding local
+// commits and edits to tracked files. It returns the discarded edits as a
+// patch and whether HEAD moved. Permission changes are ignored, since
+// applying an entry may change the mode of its source. With verification
+// on, nothing changes unless the upstream commits are signed.
+func Mirror(repoDir string) (string, bool, error) {
+	before, _ := Head(repoDir)
+	patch, err := git(repoDir, "-c", "core.fileMode=false", "diff", "HEAD")
+	if err != nil {
+		return "", false, fmt.Errorf("git diff: %s", patch)
+	}
+	if out, err := git(repoDir, "fetch", "--quiet"); err != nil {
+		return "", false, fmt.Errorf("git fetch: %s", out)
+	}
+	if signing.Verify {
+		if _, err := verifyUpstream(repoDir); err != nil {
+			return "", false, err
+		}
+	}
+	if out, err := git(repoDir, "-c", "core.fileMode=false", "reset", "--quiet", "--hard", "@{upstream}"); err != nil {
+		return "", false, fmt.Errorf("git reset: %s", out)
+	}
+	after, _ := Head(repoDir)
+	return patch, before != after, nil
 }
 
-// CommitAndPush stages all, commits, and pushes.
-func CommitAndPush(repoDir, message string) error {
-	if err := AddAll(repoDir); err != nil {
+// upstream returns the remote and the remote branch the current branch
+// tracks.
+func upstream(repoDir string) (string, string, error) {
+	head, err := git(repoDir, "symbolic-ref", "-q", "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("git symbolic-ref: not on a branch")
+	}
+	out, err := git(repoDir, "for-each-ref", "--format=%(upstream:remotename)%09%(upstream:remoteref)", head)
+	if err != nil {
+		return "", "", fmt.Errorf("git for-each-ref: %s", out)
+	}
+	remote, ref, _ := strings.Cut(out, "\t")
+	if remote == "" || ref == "" {
+		return "", "", fmt.Errorf("branch %s has no upstream", strings.TrimPrefix(head, "refs/heads/"))
+	}
+	return remote, ref, nil
+}
+
+// UpToDate reports whether HEAD already contains the tip of the remote
+// branch it tracks. It asks the remote with git ls-remote, which is much
+// cheaper than a fetch.
+func UpToDate(repoDir string) (bool, error) {
+	remote, ref, err := upstream(repoDir)
+	if err != nil {
+		return false, err
+	}
+	out, err := git(repoDir, "ls-remote", "--", remote, ref)
+	if err != nil {
+		return false, fmt.Errorf("git ls-remote: %s", out)
+	}
+	tip, _, _ := strings.Cut(out, "\t")
+	if tip == "" {
+		return false, fmt.Errorf("git ls-remote: %s not found on %s", ref, remote)
+	}
+	return IsAncestor(repoDir, tip, "HEAD"), nil
+}
+
+// RemoteURL returns the URL of the remote the current branch tracks.
+func RemoteURL(repoDir string) (string, error) {
+	remote, _, err := upstream(repoDir)
+	if err != nil {
+		return "", err
+	}
+	out, err := git(repoDir, "remote", "get-url", remote)
+	if err != nil {
+		return "", fmt.Errorf("git remote get-url: %s", out)
+	}
+	return out, nil
+}
+
+// IsConflict reports whether a Pull error was caused by conflicting changes.
+func IsConflict(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "CONFLICT") || strings.Contains(err.Error(), "could not apply"))
+}
+
+// Head returns the commit hash HEAD points to.
+func Head(repoDir string) (string, error) {
+	out, err := git(repoDir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %s", out)
+	}
+	return out, nil
+}
+
+// ChangedFiles lists repo-relative paths that differ between two commits.
+func ChangedFiles(repoDir, from, to string) ([]string, error) {
+	if from == "" || from == to {
+		return nil, nil
+	}
+	out, err := git(repoDir, "-c", "core.quotePath=false", "diff", "--name-only", "--no-renames", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %s", out)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// MergeBase returns the best common ancestor of two commits.
+func MergeBase(repoDir, a, b string) (string, error) {
+	out, err := git(repoDir, "merge-base", a, b)
+	if err != nil {
+		return "", fmt.Errorf("git merge-base: %s", out)
+	}
+	return out, nil
+}
+
+// Show returns the contents of a repo-relative, slash-separated path at
+// commit. ok is false when the path does not exist there.
+func Show(repoDir, commit, path string) (content []byte, ok bool, err error) {
+	if _, err := git(repoDir, "cat-file", "-e", commit+":"+path); err != nil {
+		return nil, false, nil
+	}
+	out, err := gitOutput(repoDir, "cat-file", "blob", commit+":"+path)
+	if err != nil {
+		return nil, false, fmt.Errorf("git cat-file: %w", err)
+	}
+	return out, true, nil
+}
+
+// HasChanges returns true if there are uncommitted changes not rejected by skip.
+func HasChanges(repoDir string, skip Filter) bool {
+	paths, _ := changedPaths(repoDir, skip)
+	return len(paths) > 0
+}
+
+// CommitAndPush stages everything not rejected by skip, commits, and pushes.
+func CommitAndPush(repoDir, message string, skip Filter) error {
+	if err := AddFiltered(repoDir, skip); err != nil {
 		return err
 	}
 	committed, err := Commit(repoDir, message)
@@ -95,6 +395,30 @@ func CommitAndPush(repoDir, message string) error {
 	return Push(repoDir)
 }
 
+// CommitPaths commits only the given paths, leaving other changes in the
+// worktree and index untouched. Returns false if they had no changes.
+func CommitPaths(repoDir, message string, paths ...string) (bool, error) {
+	args := append([]string{"add", "-A", "--"}, paths...)
+	if out, err := git(repoDir, args...); err != nil {
+		return false, fmt.Errorf("git add: %s", out)
+	}
+	args = append([]string{"diff", "--cached", "--quiet", "--"}, paths...)
+	if _, err := git(repoDir, args...); err == nil {
+		return false, nil
+	}
+	args = append([]string{"commit", "-m", message, "--"}, paths...)
+	if out, err := git(repoDir, args...); err != nil {
+		return false, fmt.Errorf("git commit: %s", out)
+	}
+	return true, nil
+}
+
+// IsAncestor reports whether commit is an ancestor of (or equal to) head.
+func IsAncestor(repoDir, commit, head string) bool {
+	_, err := git(repoDir, "merge-base", "--is-ancestor", commit, head)
+	return err == nil
+}
+
 // InitRepo initializes a new git repo if the directory is not already one.
 func InitRepo(dir string) error {
 	if out, err := git(dir, "rev-parse", "--is-inside-work-tree"); err != nil || out != "true" {
@@ -104,3 +428,62 @@ func InitRepo(dir string) error {
 	}
 	return nil
 }
+
+// SetConfig sets a git config key in the repo's local config.
+func SetConfig(repoDir, key, value string) error {
+	if out, err := git(repoDir, "config", key, value); err != nil {
+		return fmt.Errorf("git config: %s", out)
+	}
+	return nil
+}
+
+// GitDir returns the repo's .git directory.
+func GitDir(repoDir string) (string, error) {
+	out, err := git(repoDir, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %s", out)
+	}
+	return out, nil
+}
+
+// MergeFile merges the changes from base to other into current in place,
+// leaving conflict markers where they overlap. It reports whether the
+// merge was clean.
+func MergeFile(current, base, other, label string) (bool, error) {
+	args := []string{"merge-file", "-L", label + " (current)", "-L", label + " (base)", "-L", label + " (incoming)", current, base, other}
+	cmd := exec.Command("git", args...)
+	defer observe(args, time.Now())
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() > 0 && exit.ExitCode() < 128 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("git merge-file: %s", strings.TrimSpace(string(out)))
+	}
+	return true, nil
+}
+
+// DiffFiles returns a unified diff from file a to file b, with the file
+// names replaced by labelA and labelB. It is empty when they are the same.
+func DiffFiles(a, b, labelA, labelB string) (string, error) {
+	args := []string{"diff", "--no-index", "--no-color", "--no-ext-diff", "--", a, b}
+	cmd := exec.Command("git", args...)
+	defer observe(args, time.Now())
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("git diff: %w", err)
+	}
+
+	lines := strings.SplitAfter(string(out), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			return "--- " + labelA + "\n+++ " + labelB + "\n" + strings.Join(lines[i:], ""), nil
+		}
+	}
+	return "", nil
+}
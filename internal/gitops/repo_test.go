@@ -0,0 +1,72 @@
+package gitops
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitHome gives git a config of its own in a temporary HOME, which it
+// returns, and skips the test without git.
+func gitHome(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	gitconfig := "[user]\n\tname = test\n\temail = test@example.com\n[init]\n\tdefaultBranch = main\n"
+	if err := os.WriteFile(filepath.Join(dir, ".gitconfig"), []byte(gitconfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// run runs a command in dir, failing the test if it fails.
+func run(t *testing.T, dir, name string, args ...string) {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %s: %v: %s", name, strings.Join(args, " "), err, out)
+	}
+}
+
+func TestObserverSeesEveryCommand(t *testing.T) {
+	dir := gitHome(t)
+	var seen []string
+	SetObserver(func(command string, _ time.Duration) { seen = append(seen, command) })
+	t.Cleanup(func() { SetObserver(nil) })
+
+	remote := filepath.Join(dir, "remote.git")
+	run(t, dir, "git", "init", "-q", "--bare", remote)
+	repo := filepath.Join(dir, "repo")
+	if err := Clone(remote, repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "file"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFiltered(repo, func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(repo, "one"); err != nil {
+		t.Fatal(err)
+	}
+	content, ok, err := Show(repo, "HEAD", "file")
+	if err != nil || !ok || string(content) != "one\n" {
+		t.Fatalf("Show = %q, %v, %v; want the committed file", content, ok, err)
+	}
+
+	for _, command := range []string{"clone", "status", "add", "commit", "cat-file"} {
+		if !slices.Contains(seen, command) {
+			t.Errorf("observer did not see git %s; saw %v", command, seen)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package gitops
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Signing is how commits made through this package are signed, and
+// whether pulled commits are verified. See SetSigning.
+type Signing struct {
+	// Format is git's gpg.format: ssh or openpgp. Empty leaves signing to
+	// git's own config.
+	Format string
+	// Key is git's user.signingKey; empty keeps git's.
+	Key string
+	// Verify makes Pull and Mirror refuse upstream commits without a good
+	// signature.
+	Verify bool
+	// AllowedSigners is git's gpg.ssh.allowedSignersFile; empty keeps git's.
+	AllowedSigners string
+}
+
+// signing is applied to every git command.
+var signing Signing
+
+// SetSigning makes every later commit, rebase and tag be signed as s says,
+// and turns verification of pulled commits on or off. Like SetObserver, it
+// must be called before any git command runs concurrently.
+func SetSigning(s Signing) {
+	signing = s
+}
+
+// args returns the git options that apply s.
+func (s Signing) args() []string {
+	var args []string
+	if s.Format != "" {
+		args = append(args, "-c", "gpg.format="+s.Format, "-c", "commit.gpgSign=true", "-c", "tag.gpgSign=true")
+	}
+	if s.Key != "" {
+		args = append(args, "-c", "user.signingKey="+s.Key)
+	}
+	if s.AllowedSigners != "" {
+		args = append(args, "-c", "gpg.ssh.allowedSignersFile="+s.AllowedSigners)
+	}
+	return args
+}
+
+// UnverifiedError is returned by Pull and Mirror when verification is on
+// and the upstream has commits without a good signature. Nothing is pulled.
+type UnverifiedError struct {
+	// Upstream is the upstream commit that was refused.
+	Upstream string
+	// Commits are the abbreviated hashes, each with why it was refused.
+	Commits []string
+}
+
+func (e *UnverifiedError) Error() string {
+	return fmt.Sprintf("refusing %d upstream commit(s) without a good signature from an allowed key: %s",
+		len(e.Commits), strings.Join(e.Commits, ", "))
+}
+
+// signatureStatus describes git's %G? codes other than G (good).
+var signatureStatus = map[string]string{
+	"B": "bad signature",
+	"U": "unknown key",
+	"X": "expired signature",
+	"Y": "expired key",
+	"R": "revoked key",
+	"E": "cannot be checked",
+	"N": "unsigned",
+}
+
+// verifyUpstream checks the signatures of the fetched upstream commits
+// that HEAD does not have yet, returning how many there are.
+func verifyUpstream(repoDir string) (int, error) {
+	// Only stdout: git reports verification problems on stderr as well.
+	out, err := gitOutput(repoDir, "log", "--format=%h %G?", "HEAD..@{upstream}")
+	if err != nil {
+		return 0, fmt.Errorf("git log: %w", err)
+	}
+	text := strings.TrimSpace(string(out))
+	if text == "" {
+		return 0, nil
+	}
+	lines := strings.Split(text, "\n")
+	var refused []string
+	for _, line := range lines {
+		hash, status, _ := strings.Cut(line, " ")
+		if status == "G" {
+			continue
+		}
+		why, ok := signatureStatus[status]
+		if !ok {
+			why = "status " + status
+		}
+		refused = append(refused, fmt.Sprintf("%s (%s)", hash, why))
+	}
+	if len(refused) > 0 {
+		upstream, err := git(repoDir, "rev-parse", "@{upstream}")
+		if err != nil {
+			return 0, fmt.Errorf("git rev-parse: %s", upstream)
+		}
+		return 0, &UnverifiedError{Upstream: upstream, Commits: refused}
+	}
+	return len(lines), nil
+}
+
+// PullTo rebases local commits onto commit, a fetched upstream commit,
+// without verifying it. It is how refused commits are let in once approved.
+func PullTo(repoDir, commit string) error {
+	if out, err := git(repoDir, "rebase", "--autostash", commit); err != nil {
+		return fmt.Errorf("git rebase: %s", out)
+	}
+	return nil
+}
+
+// SignsByDefault reports whether git's global config signs commits without
+// being told to.
+func SignsByDefault() bool {
+	out, err := exec.Command("git", "config", "--type=bool", "commit.gpgSign").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
@@ -0,0 +1,191 @@
+package gitops
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signingRepos sets up a remote with one commit, a clone to pull into and
+// a clone to push from, and an SSH key that the allowed signers file in
+// the returned dir trusts. Git runs with a config of its own.
+func signingRepos(t *testing.T) (local, other, dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	dir = gitHome(t)
+	t.Cleanup(func() { SetSigning(Signing{}) })
+
+	for _, name := range []string{"trusted", "stranger"} {
+		run(t, dir, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", filepath.Join(dir, name))
+	}
+	pub, err := os.ReadFile(filepath.Join(dir, "trusted.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "allowed_signers"), []byte("test@example.com "+string(pub)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := filepath.Join(dir, "remote.git")
+	run(t, dir, "git", "init", "-q", "--bare", remote)
+	other = filepath.Join(dir, "other")
+	if err := Clone(remote, other); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, other, "one")
+	run(t, other, "git", "push", "-q", "-u", "origin", "main")
+	local = filepath.Join(dir, "local")
+	if err := Clone(remote, local); err != nil {
+		t.Fatal(err)
+	}
+	return local, other, dir
+}
+
+// commitFile commits content to a file in repoDir, signed as the current
+// Signing says.
+func commitFile(t *testing.T, repoDir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repoDir, "file"), []byte(content+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(repoDir, "file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(repoDir, content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pushSigned commits and pushes from other, signed with the named key, or
+// unsigned if key is empty.
+func pushSigned(t *testing.T, other, dir, key, content string) {
+	t.Helper()
+	if key == "" {
+		SetSigning(Signing{})
+	} else {
+		SetSigning(Signing{Format: "ssh", Key: filepath.Join(dir, key)})
+	}
+	commitFile(t, other, content)
+	if err := Push(other); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verifying(dir string) Signing {
+	return Signing{Verify: true, AllowedSigners: filepath.Join(dir, "allowed_signers")}
+}
+
+func TestPullVerifiesSignatures(t *testing.T) {
+	for _, tc := range []struct {
+		name, key, refused string
+	}{
+		{name: "good", key: "trusted"},
+		{name: "unsigned", refused: "unsigned"},
+		{name: "unknown key", key: "stranger", refused: "unknown key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			local, other, dir := signingRepos(t)
+			pushSigned(t, other, dir, tc.key, "two")
+			before, _ := Head(local)
+
+			SetSigning(verifying(dir))
+			changed, err := Pull(local)
+			after, _ := Head(local)
+			if tc.refused == "" {
+				if err != nil || !changed {
+					t.Fatalf("Pull = %v, %v; want the signed commit pulled", changed, err)
+				}
+				if want, _ := Head(other); after != want {
+					t.Errorf("HEAD = %s, want %s", after, want)
+				}
+				return
+			}
+
+			var unverified *UnverifiedError
+			if !errors.As(err, &unverified) {
+				t.Fatalf("Pull = %v, %v; want an UnverifiedError", changed, err)
+			}
+			if len(unverified.Commits) != 1 || !strings.Contains(unverified.Commits[0], tc.refused) {
+				t.Errorf("refused %v, want one commit that is %s", unverified.Commits, tc.refused)
+			}
+			if want, _ := Head(other); unverified.Upstream != want {
+				t.Errorf("Upstream = %s, want %s", unverified.Upstream, want)
+			}
+			if after != before {
+				t.Errorf("HEAD moved from %s to %s on refusal", before, after)
+			}
+			if data, _ := os.ReadFile(filepath.Join(local, "file")); string(data) != "one\n" {
+				t.Errorf("file = %q after refusal, want it untouched", data)
+			}
+		})
+	}
+}
+
+func TestPullRefusesOnlyWhenOneCommitIsUnsigned(t *testing.T) {
+	local, other, dir := signingRepos(t)
+	pushSigned(t, other, dir, "trusted", "two")
+	pushSigned(t, other, dir, "", "three")
+	before, _ := Head(local)
+
+	SetSigning(verifying(dir))
+	_, err := Pull(local)
+	var unverified *UnverifiedError
+	if !errors.As(err, &unverified) || len(unverified.Commits) != 1 {
+		t.Fatalf("Pull = %v, want only the unsigned commit refused", err)
+	}
+	if after, _ := Head(local); after != before {
+		t.Errorf("HEAD moved from %s to %s on refusal", before, after)
+	}
+
+	// Once approved, the refused upstream can be pulled as it is.
+	if err := PullTo(local, unverified.Upstream); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := Head(local); after != unverified.Upstream {
+		t.Errorf("HEAD = %s after PullTo, want %s", after, unverified.Upstream)
+	}
+}
+
+func TestMirrorAndFetchVerifySignatures(t *testing.T) {
+	local, other, dir := signingRepos(t)
+	pushSigned(t, other, dir, "stranger", "two")
+	before, _ := Head(local)
+
+	SetSigning(verifying(dir))
+	var unverified *UnverifiedError
+	if _, _, err := Mirror(local); !errors.As(err, &unverified) {
+		t.Errorf("Mirror = %v, want an UnverifiedError", err)
+	}
+	if _, err := Fetch(local); !errors.As(err, &unverified) {
+		t.Errorf("Fetch = %v, want an UnverifiedError", err)
+	}
+	if after, _ := Head(local); after != before {
+		t.Errorf("HEAD moved from %s to %s on refusal", before, after)
+	}
+
+	pushSigned(t, other, dir, "trusted", "three")
+	SetSigning(verifying(dir))
+	if _, err := Fetch(local); !errors.As(err, &unverified) {
+		t.Errorf("Fetch = %v, want the earlier unknown-key commit still refused", err)
+	}
+}
+
+func TestVerifyUpstreamCountsGoodCommits(t *testing.T) {
+	local, other, dir := signingRepos(t)
+	pushSigned(t, other, dir, "trusted", "two")
+	pushSigned(t, other, dir, "trusted", "three")
+
+	SetSigning(verifying(dir))
+	if _, err := git(local, "fetch", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := verifyUpstream(local)
+	if err != nil || n != 2 {
+		t.Errorf("verifyUpstream = %d, %v; want 2 good commits", n, err)
+	}
+}
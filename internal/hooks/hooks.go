@@ -0,0 +1,185 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+// Kind identifies when a hook runs.
+type Kind string
+
+const (
+	PreApply   Kind = "pre_apply"
+	PostApply  Kind = "post_apply"
+	PostChange Kind = "post_change"
+)
+
+// maxOutput caps the captured output of a single hook.
+const maxOutput = 64 * 1024
+
+// Result is the outcome of running (or skipping) one hook.
+type Result struct {
+	Name     string
+	Kind     Kind
+	Command  string
+	Output   string
+	Duration time.Duration
+	// Skipped explains why the hook did not run, e.g. because it is untrusted.
+	Skipped string
+	Err     error
+}
+
+// Runner runs entry hooks according to the local trust settings.
+type Runner struct {
+	RepoDir string
+	Enabled bool
+	Timeout time.Duration
+	Trusted map[string]string
+}
+
+// NewRunner returns a runner configured from the local state.
+func NewRunner(state *config.LocalState, repoDir string) *Runner {
+	timeout, err := time.ParseDuration(state.Hooks.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout, _ = time.ParseDuration(config.DefaultHookTimeout)
+	}
+	return &Runner{
+		RepoDir: repoDir,
+		Enabled: state.Hooks.Enabled,
+		Timeout: timeout,
+		Trusted: state.Hooks.Trusted,
+	}
+}
+
+// Command returns the command configured for kind, or "".
+func Command(h *config.Hooks, kind Kind) string {
+	if h == nil {
+		return ""
+	}
+	switch kind {
+	case PreApply:
+		return h.PreApply
+	case PostApply:
+		return h.PostApply
+	case PostChange:
+		return h.PostChange
+	}
+	return ""
+}
+
+// Fingerprint identifies an entry's hook commands. Trust is granted per
+// fingerprint, so any change to the commands has to be trusted again.
+func Fingerprint(f config.FileEntry) string {
+	if f.Hooks == nil {
+		return ""
+	}
+	sum := sha256.New()
+	for _, kind := range []Kind{PreApply, PostApply, PostChange} {
+		_, _ = fmt.Fprintf(sum, "%s\x00%s\x00", kind, Command(f.Hooks, kind))
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// IsTrusted reports whether f's current hook commands are trusted.
+func IsTrusted(trusted map[string]string, f config.FileEntry) bool {
+	fp, ok := trusted[f.Name]
+	return ok && fp == Fingerprint(f)
+}
+
+// Run runs f's hook of the given kind with vars exported as environment
+// variables. It returns nil when the entry has no such hook.
+func (r *Runner) Run(f config.FileEntry, kind Kind, vars map[string]string) *Result {
+	command := Command(f.Hooks, kind)
+	if r == nil || command == "" {
+		return nil
+	}
+	res := &Result{Name: f.Name, Kind: kind, Command: command}
+	switch {
+	case !r.Enabled:
+		res.Skipped = "hooks are disabled on this machine"
+		return res
+	case !IsTrusted(r.Trusted, f):
+		res.Skipped = fmt.Sprintf("hooks are not trusted; review them with 'synq hooks trust %s'", f.Name)
+		return res
+	}
+
+	env := map[string]string{
+		"SYNQ_HOOK": string(kind),
+		"SYNQ_NAME": f.Name,
+		"SYNQ_REPO": r.RepoDir,
+	}
+	if r.RepoDir != "" {
+		env["SYNQ_SOURCE"] = f.SourcePath(r.RepoDir)
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+
+	start := time.Now()
+	res.Output, res.Err = Exec(command, r.RepoDir, env, r.Timeout)
+	res.Duration = time.Since(start)
+	return res
+}
+
+// Exec runs command through the platform shell in dir with the given extra
+// environment, killing it after timeout. It returns the combined output.
+func Exec(command, dir string, env map[string]string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+env[k])
+	}
+	// Don't wait forever on pipes held open by background children.
+	cmd.WaitDelay = time.Second
+
+	var out limitedBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	return out.String(), err
+}
+
+// limitedBuffer keeps the first maxOutput bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	s := string(bytes.TrimSpace(b.buf.Bytes()))
+	if b.truncated {
+		s += "\n[output truncated]"
+	}
+	return s
+}
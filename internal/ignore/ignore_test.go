@@ -0,0 +1,95 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+func TestMatch_Defaults(t *testing.T) {
+	m := New()
+	for _, p := range []string{"home/.vimrc.swp", "a/b/.DS_Store", "notes~"} {
+		if !m.Ignored(p) {
+			t.Errorf("expected %q to be ignored", p)
+		}
+	}
+	if m.Ignored("home/.vimrc") {
+		t.Error("expected home/.vimrc not to be ignored")
+	}
+}
+
+func TestMatch_ScopedToBase(t *testing.T) {
+	m := New()
+	m.Add("home/.config/nvim", "lazy-lock.json", "cache/", "/spell/*.spl")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"home/.config/nvim/lazy-lock.json", false, true},
+		{"home/.config/nvim/lua/lazy-lock.json", false, true},
+		{"home/.config/other/lazy-lock.json", false, false},
+		{"home/.config/nvim/cache", true, true},
+		{"home/.config/nvim/cache/x/y.bin", false, true},
+		{"home/.config/nvim/cache", false, false},
+		{"home/.config/nvim/spell/en.spl", false, true},
+		{"home/.config/nvim/lua/spell/en.spl", false, false},
+		{"home/.config/nvim/init.lua", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestMatch_DoubleStarAndNegation(t *testing.T) {
+	m := New()
+	m.Add("", "**/logs/**/*.log", "*.log", "!keep.log")
+
+	if !m.Ignored("a/logs/x/y/z.log") {
+		t.Error("expected nested log to be ignored")
+	}
+	if !m.Ignored("debug.log") {
+		t.Error("expected debug.log to be ignored")
+	}
+	if m.Ignored("dir/keep.log") {
+		t.Error("expected keep.log to be re-included")
+	}
+}
+
+func TestForRepo(t *testing.T) {
+	tmp := t.TempDir()
+	content := "# caches\n*.log\n\n"
+	if err := os.WriteFile(filepath.Join(tmp, FileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files := []config.FileEntry{{Name: "nvim", Source: "home/.config/nvim", Ignore: []string{"lazy-lock.json"}}}
+
+	m, err := ForRepo(tmp, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Ignored("home/.zsh_history.log") {
+		t.Error("expected .synqignore pattern to apply")
+	}
+	if !m.Ignored("home/.config/nvim/lazy-lock.json") {
+		t.Error("expected entry pattern to apply")
+	}
+	if m.Ignored("lazy-lock.json") {
+		t.Error("expected entry pattern to be scoped to its source")
+	}
+}
+
+func TestForRepo_NoFile(t *testing.T) {
+	m, err := ForRepo(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Ignored("synq.yaml") {
+		t.Error("expected synq.yaml not to be ignored")
+	}
+}
@@ -0,0 +1,192 @@
+package layers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/gitops"
+)
+
+// Dir holds the clones of extended repos inside the config dir.
+const Dir = "layers"
+
+// Layer is a shared base config resolved against the configs above it.
+type Layer struct {
+	config.Layer
+	// Dir is the layer's clone.
+	Dir string
+	// Files are the layer's entries that no higher config overrides.
+	Files []config.FileEntry
+	// Overridden maps the names of the layer's overridden entries to the
+	// entry that overrides them, as "<layer>:<name>" or "<name>" for the
+	// repo's own entries.
+	Overridden map[string]string
+}
+
+// Name is a short label for the layer.
+func (l Layer) Name() string {
+	name := l.Repo
+	if l.Path != "" {
+		name += "#" + l.Path
+	}
+	return name
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Path returns the clone of the repo at url inside configDir.
+func Path(configDir, url string) string {
+	base := strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	if i := strings.LastIndexAny(base, "/:"); i != -1 {
+		base = base[i+1:]
+	}
+	base = unsafeChars.ReplaceAllString(base, "-")
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(configDir, Dir, base+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// walk calls fn for every layer cfg extends, depth first, so a layer's own
+// layers follow it. Each repo and path is visited once.
+func walk(configDir string, cfg *config.Config, fn func(l config.Layer, dir string) (*config.Config, error)) error {
+	seen := map[string]bool{}
+	var visit func(c *config.Config) error
+	visit = func(c *config.Config) error {
+		for _, l := range c.Extends {
+			if l.Repo == "" {
+				return fmt.Errorf("extends entry without a repo")
+			}
+			if l.Path != "" && l.Path != config.RepoConfigFile {
+				if err := config.ValidateSource(l.Path); err != nil {
+					return fmt.Errorf("extends %s: %w", l.Repo, err)
+				}
+			}
+			key := l.Repo + "#" + l.ConfigPath()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			lc, err := fn(l, Path(configDir, l.Repo))
+			if err != nil {
+				return err
+			}
+			if err := visit(lc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(cfg)
+}
+
+// Resolve returns the layers cfg extends, highest precedence first. An
+// entry active with profiles overrides the entries of lower layers with the
+// same name or the same target on this machine. Layers are read from their
+// clones; Fetch updates them.
+func Resolve(configDir string, cfg *config.Config, profiles []string) ([]Layer, error) {
+	names := map[string]string{}
+	targets := map[string]string{}
+	claim := func(files []config.FileEntry, label func(string) string) {
+		for _, f := range files {
+			if _, ok := names[f.Name]; !ok {
+				names[f.Name] = label(f.Name)
+			}
+			if target, ok := f.TargetKey(); ok {
+				if _, taken := targets[target]; !taken {
+					targets[target] = label(f.Name)
+				}
+			}
+		}
+	}
+	claim(cfg.ActiveFiles(profiles), func(name string) string { return name })
+
+	var list []Layer
+	err := walk(configDir, cfg, func(l config.Layer, dir string) (*config.Config, error) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+			return nil, fmt.Errorf("layer %s is not cloned yet; run 'synq sync'", l.Repo)
+		}
+		lc, err := config.LoadConfigFile(dir, l.ConfigPath())
+		if err != nil {
+			return nil, fmt.Errorf("load layer %s: %w", l.Repo, err)
+		}
+		layer := Layer{Layer: l, Dir: dir, Overridden: map[string]string{}}
+		for _, f := range lc.Files {
+			by, ok := names[f.Name]
+			if !ok {
+				if target, hasTarget := f.TargetKey(); hasTarget {
+					by, ok = targets[target]
+				}
+			}
+			if ok {
+				layer.Overridden[f.Name] = by
+				continue
+			}
+			layer.Files = append(layer.Files, f)
+		}
+		claim(layer.ActiveFiles(profiles), func(name string) string { return layer.Name() + ":" + name })
+		list = append(list, layer)
+		return lc, nil
+	})
+	return list, err
+}
+
+// ActiveFiles returns the layer's entries that apply with the active
+// profiles.
+func (l Layer) ActiveFiles(profiles []string) []config.FileEntry {
+	var files []config.FileEntry
+	for _, f := range l.Files {
+		if config.InProfiles(f.Profiles, profiles) {
+			f.ActiveOverlays = f.OverlayKeys(profiles)
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Update is the outcome of refreshing one layer clone.
+type Update struct {
+	Repo    string
+	Dir     string
+	Changed bool
+	// Discarded is the patch file holding local edits to shared files that
+	// were thrown away, if any.
+	Discarded string
+}
+
+// Fetch clones the layers cfg extends that are missing and resets the
+// others to their upstream. Layer clones are read-only: edits to them are
+// discarded, after saving them as a patch next to the clone.
+func Fetch(configDir string, cfg *config.Config) ([]Update, error) {
+	var updates []Update
+	err := walk(configDir, cfg, func(l config.Layer, dir string) (*config.Config, error) {
+		u := Update{Repo: l.Repo, Dir: dir}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+			if err := gitops.Clone(l.Repo, dir); err != nil {
+				_ = os.RemoveAll(dir)
+				return nil, fmt.Errorf("clone layer %s: %w", l.Repo, err)
+			}
+			u.Changed = true
+		} else {
+			patch, changed, err := gitops.Mirror(dir)
+			if err != nil {
+				return nil, fmt.Errorf("update layer %s: %w", l.Repo, err)
+			}
+			u.Changed = changed
+			if patch != "" {
+				u.Discarded = dir + ".discarded-" + time.Now().Format("20060102-150405") + ".patch"
+				if err := os.WriteFile(u.Discarded, []byte(patch+"\n"), 0o644); err != nil {
+					return nil, fmt.Errorf("save discarded edits: %w", err)
+				}
+			}
+		}
+		updates = append(updates, u)
+		return config.LoadConfigFile(dir, l.ConfigPath())
+	})
+	return updates, err
+}
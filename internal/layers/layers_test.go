@@ -0,0 +1,106 @@
+package layers
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+func TestPath(t *testing.T) {
+	a := Path("/cfg", "git@github.com:team/dotfiles.git")
+	b := Path("/cfg", "https://github.com/team/dotfiles")
+	if filepath.Dir(a) != filepath.Join("/cfg", Dir) {
+		t.Errorf("Path() = %s, want it under %s", a, Dir)
+	}
+	if !strings.HasPrefix(filepath.Base(a), "dotfiles-") || !strings.HasPrefix(filepath.Base(b), "dotfiles-") {
+		t.Errorf("Path() = %s, %s; want dotfiles-<hash>", a, b)
+	}
+	if a == b {
+		t.Errorf("Path() = %s for two different URLs", a)
+	}
+}
+
+// clone fakes the clone of url with the given synq.yaml.
+func clone(t *testing.T, configDir, url, cfg string) {
+	t.Helper()
+	dir := Path(configDir, url)
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, config.RepoConfigFile), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	configDir := t.TempDir()
+	goos := runtime.GOOS
+	clone(t, configDir, "team", `extends: [{repo: org}]
+files:
+  - name: gitconfig
+    source: gitconfig
+    targets: {`+goos+`: ~/.gitconfig}
+  - name: vimrc
+    source: vimrc
+    targets: {`+goos+`: ~/.vimrc}
+  - name: tmux
+    source: tmux.conf
+    targets: {`+goos+`: ~/.tmux.conf}
+`)
+	clone(t, configDir, "org", `files:
+  - name: tmux
+    source: tmux.conf
+    targets: {`+goos+`: ~/.tmux.conf}
+  - name: editorconfig
+    source: editorconfig
+    targets: {`+goos+`: ~/.editorconfig}
+`)
+
+	own := &config.Config{
+		Extends: []config.Layer{{Repo: "team"}},
+		Files: []config.FileEntry{
+			// Same name as a team entry.
+			{Name: "gitconfig", Source: "git/config", Targets: map[string]string{goos: "~/.config/git/config"}},
+			// Same target as a team entry.
+			{Name: "my-vimrc", Source: "vimrc", Targets: map[string]string{goos: "~/.vimrc"}},
+		},
+	}
+	list, err := Resolve(configDir, own, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Repo != "team" || list[1].Repo != "org" {
+		t.Fatalf("Resolve() = %+v, want team then org", list)
+	}
+
+	names := func(files []config.FileEntry) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.Name)
+		}
+		return out
+	}
+	if got := strings.Join(names(list[0].Files), ","); got != "tmux" {
+		t.Errorf("team files = %s, want tmux", got)
+	}
+	if list[0].Overridden["gitconfig"] != "gitconfig" || list[0].Overridden["vimrc"] != "my-vimrc" {
+		t.Errorf("team overridden = %v", list[0].Overridden)
+	}
+	if got := strings.Join(names(list[1].Files), ","); got != "editorconfig" {
+		t.Errorf("org files = %s, want editorconfig", got)
+	}
+	if list[1].Overridden["tmux"] != "team:tmux" {
+		t.Errorf("org overridden = %v", list[1].Overridden)
+	}
+}
+
+func TestResolveNotCloned(t *testing.T) {
+	cfg := &config.Config{Extends: []config.Layer{{Repo: "team"}}}
+	if _, err := Resolve(t.TempDir(), cfg, nil); err == nil || !strings.Contains(err.Error(), "not cloned") {
+		t.Errorf("Resolve() error = %v, want not cloned", err)
+	}
+}
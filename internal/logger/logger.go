@@ -11,11 +11,28 @@ var log zerolog.Logger
 
 func Init(verbose bool) {
 	var w io.Writer = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "15:04:05"}
-	level := zerolog.InfoLevel
+	log = zerolog.New(w).With().Timestamp().Logger().Level(level(verbose))
+}
+
+// InitFile logs to stderr like Init and additionally writes JSON lines to a
+// rotating file at path, so background daemons keep their output. The
+// caller closes the returned file on exit.
+func InitFile(verbose bool, path string) (io.Closer, error) {
+	f, err := OpenRotating(path, MaxFileSize, MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	console := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "15:04:05"}
+	w := zerolog.MultiLevelWriter(console, f)
+	log = zerolog.New(w).With().Timestamp().Logger().Level(level(verbose))
+	return f, nil
+}
+
+func level(verbose bool) zerolog.Level {
 	if verbose {
-		level = zerolog.DebugLevel
+		return zerolog.DebugLevel
 	}
-	log = zerolog.New(w).With().Timestamp().Logger().Level(level)
+	return zerolog.InfoLevel
 }
 
 func Get() *zerolog.Logger {
@@ -1,6 +1,11 @@
 package logger
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestInit(t *testing.T) {
 	Init(false)
@@ -17,3 +22,57 @@ func TestInitVerbose(t *testing.T) {
 		t.Fatal("expected non-nil logger")
 	}
 }
+
+func TestInitFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	f, err := InitFile(false, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Get().Info().Str("k", "v").Msg("hello")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	Init(false)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"message":"hello"`) {
+		t.Errorf("log file = %q, want a JSON line", string(data))
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	r, err := OpenRotating(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), string(data), want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only two backups to be kept")
+	}
+}
@@ -0,0 +1,159 @@
+package machines
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is the repo directory holding one heartbeat file per machine. Every
+// machine only ever writes its own file, so heartbeats never conflict.
+const Dir = "machines"
+
+// Heartbeat is what a machine last reported about itself.
+type Heartbeat struct {
+	ID       string   `yaml:"id"`
+	Hostname string   `yaml:"hostname"`
+	OS       string   `yaml:"os"`
+	Arch     string   `yaml:"arch"`
+	Version  string   `yaml:"version"`
+	Profiles []string `yaml:"profiles,omitempty"`
+	// LastSeen is when the heartbeat was written.
+	LastSeen time.Time `yaml:"last_seen"`
+	// LastSync is when the machine last pulled and applied successfully.
+	LastSync  time.Time `yaml:"last_sync,omitempty"`
+	SyncError string    `yaml:"sync_error,omitempty"`
+	// Commit is the repo commit the machine last applied.
+	Commit string `yaml:"commit,omitempty"`
+	// Failing lists entries that failed to apply.
+	Failing []string `yaml:"failing,omitempty"`
+	// SigningKey is the SSH public key the machine signs its commits with,
+	// published for machines that only trust signed commits.
+	SigningKey string `yaml:"signing_key,omitempty"`
+}
+
+// NewID returns a random machine ID.
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// EnsureID returns the machine ID from the local state, creating and saving
+// one if the state has none yet.
+func EnsureID(configDir string) (string, error) {
+	state, err := config.LoadLocalState(configDir)
+	if err != nil {
+		return "", fmt.Errorf("load local state: %w", err)
+	}
+	if state.MachineID != "" {
+		return state.MachineID, nil
+	}
+	id, err := NewID()
+	if err != nil {
+		return "", fmt.Errorf("generate machine ID: %w", err)
+	}
+	state.MachineID = id
+	if err := config.SaveLocalState(configDir, state); err != nil {
+		return "", fmt.Errorf("save local state: %w", err)
+	}
+	return id, nil
+}
+
+// Source returns the repo-relative path of a machine's heartbeat file.
+func Source(id string) string {
+	return path.Join(Dir, id+".yaml")
+}
+
+// IsHeartbeat reports whether a repo-relative path is a heartbeat file.
+func IsHeartbeat(source string) bool {
+	return strings.HasPrefix(source, Dir+"/")
+}
+
+// Write stores hb in the repo and returns its repo-relative path.
+func Write(repoDir string, hb *Heartbeat) (string, error) {
+	source := Source(hb.ID)
+	p := filepath.Join(repoDir, filepath.FromSlash(source))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(hb)
+	if err != nil {
+		return "", err
+	}
+	return source, os.WriteFile(p, data, 0o644)
+}
+
+// Load reads every heartbeat in the repo, sorted by hostname.
+func Load(repoDir string) ([]Heartbeat, error) {
+	entries, err := os.ReadDir(filepath.Join(repoDir, Dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var list []Heartbeat
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".yaml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(repoDir, Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var hb Heartbeat
+		if err := yaml.Unmarshal(data, &hb); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", e.Name(), err)
+		}
+		if hb.ID == "" {
+			hb.ID = strings.TrimSuffix(e.Name(), ".yaml")
+		}
+		list = append(list, hb)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Hostname != list[j].Hostname {
+			return list[i].Hostname < list[j].Hostname
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// Find returns the heartbeat whose ID or hostname is key. A unique ID
+// prefix also matches.
+func Find(list []Heartbeat, key string) (*Heartbeat, error) {
+	var found []int
+	for i, hb := range list {
+		if hb.ID == key || hb.Hostname == key {
+			return &list[i], nil
+		}
+		if strings.HasPrefix(hb.ID, key) {
+			found = append(found, i)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("machine %q not found", key)
+	case 1:
+		return &list[found[0]], nil
+	}
+	return nil, fmt.Errorf("machine ID prefix %q is ambiguous", key)
+}
+
+// Stale reports whether hb has not been seen for longer than after.
+func Stale(hb Heartbeat, now time.Time, after time.Duration) bool {
+	return now.Sub(hb.LastSeen) > after
+}
@@ -0,0 +1,70 @@
+package machines
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteAndLoad(t *testing.T) {
+	repoDir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, hb := range []*Heartbeat{
+		{ID: "b2", Hostname: "workstation", OS: "linux", LastSeen: now},
+		{ID: "a1", Hostname: "laptop", OS: "darwin", LastSeen: now, Failing: []string{"kitty"}},
+	} {
+		source, err := Write(repoDir, hb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source != "machines/"+hb.ID+".yaml" || !IsHeartbeat(source) {
+			t.Errorf("source = %q", source)
+		}
+	}
+
+	list, err := Load(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Hostname != "laptop" || list[1].Hostname != "workstation" {
+		t.Fatalf("Load() = %+v, want laptop then workstation", list)
+	}
+	if !list[0].LastSeen.Equal(now) || len(list[0].Failing) != 1 {
+		t.Errorf("laptop = %+v", list[0])
+	}
+}
+
+func TestLoad_NoMachines(t *testing.T) {
+	list, err := Load(t.TempDir())
+	if err != nil || list != nil {
+		t.Errorf("Load() = %v, %v; want nil, nil", list, err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	list := []Heartbeat{
+		{ID: "abc123", Hostname: "laptop"},
+		{ID: "abd456", Hostname: "desktop"},
+	}
+	for key, want := range map[string]string{"laptop": "abc123", "abd": "abd456", "abc123": "abc123"} {
+		hb, err := Find(list, key)
+		if err != nil || hb.ID != want {
+			t.Errorf("Find(%q) = %v, %v; want %s", key, hb, err, want)
+		}
+	}
+	if _, err := Find(list, "ab"); err == nil {
+		t.Error("expected ambiguous prefix to fail")
+	}
+	if _, err := Find(list, "server"); err == nil {
+		t.Error("expected unknown machine to fail")
+	}
+}
+
+func TestStale(t *testing.T) {
+	now := time.Now()
+	if Stale(Heartbeat{LastSeen: now.Add(-time.Hour)}, now, 24*time.Hour) {
+		t.Error("machine seen an hour ago should not be stale")
+	}
+	if !Stale(Heartbeat{LastSeen: now.Add(-48 * time.Hour)}, now, 24*time.Hour) {
+		t.Error("machine seen two days ago should be stale")
+	}
+}
@@ -0,0 +1,67 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+// Check reports whether data is a valid file of the named format. TOML
+// values are checked one by one; INI files only need to parse.
+func Check(name string, data []byte) error {
+	if err := Validate(name); err != nil {
+		return err
+	}
+	f := formats[name]
+	n, err := parseOrEmpty(f, data)
+	if err != nil {
+		return err
+	}
+	if name != config.MergeTOML {
+		return nil
+	}
+	return walkLeaves(n, nil, func(path []string, leaf *node) error {
+		if leaf.text == "\x00" {
+			return fmt.Errorf("%s: missing value", strings.Join(f.patchPath(path), "."))
+		}
+		if _, err := f.leafValue(leaf); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(f.patchPath(path), "."), err)
+		}
+		return nil
+	})
+}
+
+// ChangedKeys lists the keys whose values differ between two versions of a
+// file of the named format, as dotted paths.
+func ChangedKeys(name string, before, after []byte) ([]string, error) {
+	if err := Validate(name); err != nil {
+		return nil, err
+	}
+	f := formats[name]
+	a, err := parseOrEmpty(f, before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseOrEmpty(f, after)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, c := range diff(a, b, nil) {
+		keys = append(keys, strings.Join(f.patchPath(c.path), "."))
+	}
+	return keys, nil
+}
+
+func walkLeaves(n *node, path []string, fn func(path []string, leaf *node) error) error {
+	if !n.isMap() {
+		return fn(path, n)
+	}
+	for _, k := range n.keys {
+		if err := walkLeaves(n.fields[k], append(path[:len(path):len(path)], k), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package merge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		format, data string
+		valid        bool
+	}{
+		{"json", "{\"a\": 1}\n", true},
+		{"json", "{\"a\": 1,}\n", false},
+		{"yaml", "a:\n  b: 1\n", true},
+		{"yaml", "a: [1, 2\n", false},
+		{"toml", "a = 1\n\n[b]\nc = \"x\"\n", true},
+		{"toml", "a =\n", false},
+		{"toml", "a = \"open\n", false},
+		{"ini", "[user]\n\tname = Me\n", true},
+	}
+	for _, tt := range tests {
+		err := Check(tt.format, []byte(tt.data))
+		if (err == nil) != tt.valid {
+			t.Errorf("Check(%s, %q) = %v, want valid %v", tt.format, tt.data, err, tt.valid)
+		}
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	before := "add_newline = true\n\n[git_branch]\nstyle = \"purple\"\nsymbol = \"b\"\n"
+	after := "add_newline = true\n\n[git_branch]\nstyle = \"bold purple\"\n\n[aws]\ndisabled = true\n"
+	got, err := ChangedKeys("toml", []byte(before), []byte(after))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"git_branch.style", "git_branch.symbol", "aws"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedKeys = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package merge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+	"github.com/ihavespoons/synq/internal/gitops"
+)
+
+// DriverCommand is the hidden synq command git runs as the merge driver.
+const DriverCommand = "merge-driver"
+
+// attributesBlock marks the lines synq manages in .git/info/attributes.
+var attributesBlock = fileops.NewBlock("#", "merge")
+
+// Install points git at synq's merge driver for the sources of files with
+// a merge format. The attributes live in .git/info/attributes, so nothing
+// is committed; binary is the synq executable git should run.
+func Install(repoDir string, files []config.FileEntry, binary string) error {
+	gitDir, err := gitops.GitDir(repoDir)
+	if err != nil {
+		return err
+	}
+	attributes := filepath.Join(gitDir, "info", "attributes")
+
+	var lines []string
+	used := map[string]bool{}
+	for _, f := range files {
+		if f.Merge == "" {
+			continue
+		}
+		if err := Validate(f.Merge); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		pattern := "/" + escapePattern(f.Source)
+		driver := "merge=synq-" + f.Merge
+		lines = append(lines, pattern+" "+driver)
+		if info, err := os.Stat(f.SourcePath(repoDir)); err == nil && info.IsDir() {
+			lines = append(lines, pattern+"/** "+driver)
+		}
+		used[f.Merge] = true
+	}
+
+	if len(lines) == 0 {
+		_, err := attributesBlock.Remove(attributes, false)
+		return err
+	}
+	if _, err := attributesBlock.Write(attributes, []byte(strings.Join(lines, "\n"))); err != nil {
+		return err
+	}
+	for name := range used {
+		section := "merge.synq-" + name
+		if err := gitops.SetConfig(repoDir, section+".name", "synq "+name+" merge"); err != nil {
+			return err
+		}
+		driver := fmt.Sprintf("%s %s %s %%O %%A %%B %%P", shellQuote(binary), DriverCommand, name)
+		if err := gitops.SetConfig(repoDir, section+".driver", driver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapePattern escapes the characters gitattributes patterns treat
+// specially.
+func escapePattern(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		switch r {
+		case ' ':
+			b.WriteString("[[:space:]]")
+			continue
+		case '*', '?', '[', '\\', '!', '#':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,114 @@
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseJSON reads a JSON document. Objects keep their key order; arrays and
+// scalars are leaves.
+func parseJSON(data []byte) (*node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	n, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return n, nil
+}
+
+func decodeJSON(dec *json.Decoder) (*node, error) {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if raw[0] != '{' {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return nil, err
+		}
+		return &node{text: compact.String(), data: raw}, nil
+	}
+
+	obj := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := obj.Token(); err != nil {
+		return nil, err
+	}
+	n := newMap()
+	for obj.More() {
+		tok, err := obj.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		if _, dup := n.fields[key]; dup {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		child, err := decodeJSON(obj)
+		if err != nil {
+			return nil, err
+		}
+		n.set(key, child)
+	}
+	return n, nil
+}
+
+// renderJSON writes n with the indentation used by ours.
+func renderJSON(n *node, ours []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, n, "", jsonIndent(ours)); err != nil {
+		return nil, err
+	}
+	if len(ours) == 0 || ours[len(ours)-1] == '\n' {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, n *node, prefix, indent string) error {
+	if !n.isMap() {
+		return json.Indent(buf, n.data.(json.RawMessage), prefix, indent)
+	}
+	if len(n.keys) == 0 {
+		buf.WriteString("{}")
+		return nil
+	}
+	buf.WriteString("{\n")
+	for i, k := range n.keys {
+		var key bytes.Buffer
+		enc := json.NewEncoder(&key)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(k); err != nil {
+			return err
+		}
+		buf.WriteString(prefix + indent)
+		buf.Write(bytes.TrimSpace(key.Bytes()))
+		buf.WriteString(": ")
+		if err := writeJSON(buf, n.fields[k], prefix+indent, indent); err != nil {
+			return err
+		}
+		if i < len(n.keys)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(prefix + "}")
+	return nil
+}
+
+// jsonIndent returns the indentation of the first indented line in data,
+// or two spaces.
+func jsonIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
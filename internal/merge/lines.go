@@ -0,0 +1,192 @@
+package merge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lineSyntax describes a line-oriented format made of [section] headers
+// and key/value entries, such as INI or TOML.
+type lineSyntax struct {
+	// comment reports whether a trimmed line is a comment.
+	comment func(trimmed string) bool
+	// continues reports whether an entry spans more lines than text.
+	continues func(text string) bool
+	// split returns an entry's key and value.
+	split func(text string) (key, value string)
+}
+
+// parseLines reads a line-oriented file. The root holds the entries before
+// the first section, then one mapping per section keyed "[name]". Entries
+// keep their raw lines along with the comments and blank lines above them;
+// repeated keys and sections are numbered from the second one on.
+func parseLines(data []byte, syn lineSyntax) (*node, error) {
+	lines := strings.Split(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	root := newMap()
+	cur := root
+	var pending []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || syn.comment(trimmed):
+			pending = append(pending, line)
+		case strings.HasPrefix(trimmed, "[["):
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", i+1)
+		case strings.HasPrefix(trimmed, "["):
+			end := strings.Index(trimmed, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: unterminated section header", i+1)
+			}
+			sec := newMap()
+			sec.data = append(pending, line)
+			pending = nil
+			root.set(uniqueKey(root, "["+strings.TrimSpace(trimmed[1:end])+"]"), sec)
+			cur = sec
+		default:
+			entry := []string{line}
+			for syn.continues(strings.Join(entry, "\n")) {
+				if i+1 == len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated value", i+1)
+				}
+				i++
+				entry = append(entry, lines[i])
+			}
+			key, value := syn.split(strings.Join(entry, "\n"))
+			cur.set(uniqueKey(cur, key), &node{text: value, data: append(pending, entry...)})
+			pending = nil
+		}
+	}
+	root.data = pending
+	return root, nil
+}
+
+// uniqueKey numbers key when n already has it.
+func uniqueKey(n *node, key string) string {
+	id := key
+	for i := 2; ; i++ {
+		if _, ok := n.fields[id]; !ok {
+			return id
+		}
+		id = key + "#" + strconv.Itoa(i)
+	}
+}
+
+// renderLines writes the entries of the root, then each section with its
+// entries, then the trailing lines of ours.
+func renderLines(n *node, _ []byte) ([]byte, error) {
+	var b strings.Builder
+	write := func(lines []string) {
+		for _, l := range lines {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+	}
+	for _, k := range n.keys {
+		if child := n.fields[k]; !child.isMap() {
+			write(child.data.([]string))
+		}
+	}
+	for _, k := range n.keys {
+		sec := n.fields[k]
+		if !sec.isMap() {
+			continue
+		}
+		if header, ok := sec.data.([]string); ok {
+			write(header)
+		} else {
+			// A section added by an overlay.
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			write([]string{k})
+		}
+		for _, ek := range sec.keys {
+			write(sec.fields[ek].data.([]string))
+		}
+	}
+	if tail, ok := n.data.([]string); ok {
+		write(tail)
+	}
+	return []byte(b.String()), nil
+}
+
+var iniSyntax = lineSyntax{
+	comment: func(trimmed string) bool {
+		return strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#")
+	},
+	continues: func(text string) bool {
+		return strings.HasSuffix(strings.TrimRight(text, " \t\r"), "\\")
+	},
+	split: func(text string) (string, string) {
+		i := strings.IndexAny(text, "=:")
+		if i == -1 {
+			// A key without a value, such as a boolean in a gitconfig.
+			return strings.TrimSpace(text), "\x00"
+		}
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+	},
+}
+
+var tomlSyntax = lineSyntax{
+	comment: func(trimmed string) bool {
+		return strings.HasPrefix(trimmed, "#")
+	},
+	continues: tomlOpen,
+	split: func(text string) (string, string) {
+		i := strings.Index(text, "=")
+		if i == -1 {
+			return strings.TrimSpace(text), "\x00"
+		}
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+	},
+}
+
+func parseINI(data []byte) (*node, error) {
+	return parseLines(data, iniSyntax)
+}
+
+func parseTOML(data []byte) (*node, error) {
+	return parseLines(data, tomlSyntax)
+}
+
+// tomlOpen reports whether text ends inside a multi-line string, array or
+// inline table.
+func tomlOpen(text string) bool {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		if q := text[i:min(i+3, len(text))]; q == `"""` || q == "'''" {
+			end := strings.Index(text[i+3:], q)
+			if end == -1 {
+				return true
+			}
+			i += 3 + end + 2
+			continue
+		}
+		switch text[i] {
+		case '"':
+			for i++; i < len(text) && text[i] != '"' && text[i] != '\n'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case '\'':
+			for i++; i < len(text) && text[i] != '\'' && text[i] != '\n'; i++ {
+			}
+		case '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth > 0
+}
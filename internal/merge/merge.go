@@ -0,0 +1,200 @@
+// Package merge merges concurrent edits to structured config files key by
+// key, so that two machines changing different settings never conflict.
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+// node is a parsed document: a mapping with ordered keys, or a leaf that is
+// only ever replaced as a whole.
+type node struct {
+	keys   []string
+	fields map[string]*node
+	// text is a leaf's canonical form, used to compare leaves.
+	text string
+	// data is the format's own representation of the node and key that of
+	// its key in the parent mapping; renderers use them to keep comments
+	// and layout.
+	data any
+	key  any
+}
+
+func newMap() *node {
+	return &node{fields: map[string]*node{}}
+}
+
+func (n *node) isMap() bool {
+	return n != nil && n.fields != nil
+}
+
+// set adds or replaces a field, keeping the order keys were first set in.
+func (n *node) set(key string, child *node) {
+	if _, ok := n.fields[key]; !ok {
+		n.keys = append(n.keys, key)
+	}
+	n.fields[key] = child
+}
+
+// equal compares two nodes, ignoring key order and layout. nil is a missing
+// node.
+func equal(a, b *node) bool {
+	switch {
+	case a == nil || b == nil:
+		return a == b
+	case a.isMap() != b.isMap():
+		return false
+	case !a.isMap():
+		return a.text == b.text
+	case len(a.fields) != len(b.fields):
+		return false
+	}
+	for k, av := range a.fields {
+		if !equal(av, b.fields[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge3 merges the changes from base to ours and from base to theirs. A nil
+// result deletes the key. Keys changed differently on both sides are
+// appended to conflicts.
+func merge3(path string, base, ours, theirs *node, conflicts *[]string) *node {
+	switch {
+	case equal(ours, theirs):
+		return ours
+	case equal(base, ours):
+		return theirs
+	case equal(base, theirs):
+		return ours
+	}
+	if ours.isMap() && theirs.isMap() {
+		if !base.isMap() {
+			// Added on both sides: merge against an empty mapping.
+			base = newMap()
+		}
+		out := &node{fields: map[string]*node{}, data: ours.data, key: ours.key}
+		keys := slices.Clone(ours.keys)
+		for _, k := range theirs.keys {
+			if _, ok := ours.fields[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			if m := merge3(join(path, k), base.fields[k], ours.fields[k], theirs.fields[k], conflicts); m != nil {
+				out.set(k, m)
+			}
+		}
+		return out
+	}
+	if path == "" {
+		path = "(document)"
+	}
+	*conflicts = append(*conflicts, path)
+	return ours
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// format parses and renders one kind of file.
+type format struct {
+	parse func(data []byte) (*node, error)
+	// render writes n; ours is the local version, whose layout it follows.
+	render func(n *node, ours []byte) ([]byte, error)
+	// newLeaf builds a leaf for key from a decoded value, and leafValue
+	// decodes one; overlays use them.
+	newLeaf   func(key string, v any) (*node, error)
+	leafValue func(n *node) (any, error)
+	// sections is set for line-oriented formats, whose nested tables are
+	// "[a.b]" sections of the root.
+	sections bool
+}
+
+var formats = map[string]format{
+	config.MergeJSON: {parse: parseJSON, render: renderJSON, newLeaf: jsonLeaf, leafValue: jsonValue},
+	config.MergeYAML: {parse: parseYAML, render: renderYAML, newLeaf: yamlLeaf, leafValue: yamlValue},
+	config.MergeTOML: {parse: parseTOML, render: renderLines, newLeaf: tomlLeaf, leafValue: tomlValue, sections: true},
+	config.MergeINI:  {parse: parseINI, render: renderLines, newLeaf: iniLeaf, leafValue: iniValue, sections: true},
+}
+
+// patchPath maps a path in a parsed document to the keys of a patch.
+func (f format) patchPath(p []string) []string {
+	if f.sections {
+		return sectionPath(p)
+	}
+	return p
+}
+
+// Validate checks that name is a supported merge format.
+func Validate(name string) error {
+	if _, ok := formats[name]; !ok {
+		return fmt.Errorf("unknown merge format %q (want one of %v)", name, config.MergeFormats)
+	}
+	return nil
+}
+
+// ConflictError lists the keys both sides changed differently.
+type ConflictError struct {
+	Keys []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting changes to %v", e.Keys)
+}
+
+// Merge merges the edits made from base to ours and from base to theirs in
+// a file of the named format. An empty base stands for a file added on both
+// sides. It returns a *ConflictError when a key changed on both sides, and
+// other errors when a version cannot be parsed.
+func Merge(name string, base, ours, theirs []byte) ([]byte, error) {
+	if err := Validate(name); err != nil {
+		return nil, err
+	}
+	f := formats[name]
+	parse := func(label string, data []byte) (*node, error) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, nil
+		}
+		n, err := f.parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s version: %w", label, err)
+		}
+		return n, nil
+	}
+	b, err := parse("base", base)
+	if err != nil {
+		return nil, err
+	}
+	o, err := parse("our", ours)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parse("their", theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	m := merge3("", b, o, t, &conflicts)
+	switch {
+	case len(conflicts) > 0:
+		return nil, &ConflictError{Keys: conflicts}
+	case m == nil:
+		return nil, nil
+	case equal(m, o):
+		return ours, nil
+	case equal(m, t):
+		return theirs, nil
+	}
+	return f.render(m, ours)
+}
@@ -0,0 +1,122 @@
+package merge
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		format, base, ours, theirs, want string
+	}{
+		{
+			format: "json",
+			base:   "{\n    \"editor.fontSize\": 12,\n    \"files.autoSave\": \"off\"\n}\n",
+			ours:   "{\n    \"editor.fontSize\": 14,\n    \"files.autoSave\": \"off\"\n}\n",
+			theirs: "{\n    \"editor.fontSize\": 12,\n    \"files.autoSave\": \"afterDelay\",\n    \"editor.rulers\": [80, 120]\n}\n",
+			want:   "{\n    \"editor.fontSize\": 14,\n    \"files.autoSave\": \"afterDelay\",\n    \"editor.rulers\": [\n        80,\n        120\n    ]\n}\n",
+		},
+		{
+			format: "json",
+			base:   `{"a": {"x": 1, "y": 2}, "b": true}`,
+			ours:   `{"a": {"x": 1, "y": 3}, "b": true}`,
+			theirs: `{"a": {"x": 0, "y": 2}}`,
+			want:   "{\n  \"a\": {\n    \"x\": 0,\n    \"y\": 3\n  }\n}",
+		},
+		{
+			format: "yaml",
+			base:   "# prompt\nformat: short\ncolors:\n  user: blue\n",
+			ours:   "# prompt\nformat: long # wide terminals\ncolors:\n  user: blue\n",
+			theirs: "# prompt\nformat: short\ncolors:\n  user: red\n  host: green\n",
+			want:   "# prompt\nformat: long # wide terminals\ncolors:\n  user: red\n  host: green\n",
+		},
+		{
+			format: "toml",
+			base:   "add_newline = true\n\n[git_branch]\nsymbol = \"b \"\nstyle = \"purple\"\n",
+			ours:   "add_newline = false\n\n[git_branch]\nsymbol = \"b \"\nstyle = \"purple\"\n",
+			theirs: "add_newline = true\nformat = \"\"\"\n$all\n\"\"\"\n\n[git_branch]\nsymbol = \"b \"\nstyle = \"bold purple\"\n\n[time]\ndisabled = false\n",
+			want:   "add_newline = false\nformat = \"\"\"\n$all\n\"\"\"\n\n[git_branch]\nsymbol = \"b \"\nstyle = \"bold purple\"\n\n[time]\ndisabled = false\n",
+		},
+		{
+			format: "ini",
+			base:   "[user]\n\tname = Me\n[core]\n\teditor = vim\n",
+			ours:   "[user]\n\tname = Me\n\temail = me@example.com\n[core]\n\teditor = vim\n",
+			theirs: "[user]\n\tname = Me\n[core]\n\teditor = nvim\n\t; pager\n\tpager = less\n",
+			want:   "[user]\n\tname = Me\n\temail = me@example.com\n[core]\n\teditor = nvim\n\t; pager\n\tpager = less\n",
+		},
+		{
+			// Added on both sides.
+			format: "ini",
+			base:   "",
+			ours:   "[a]\nx = 1\n",
+			theirs: "[a]\ny = 2\n",
+			want:   "[a]\nx = 1\ny = 2\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := Merge(tt.format, []byte(tt.base), []byte(tt.ours), []byte(tt.theirs))
+		if err != nil {
+			t.Errorf("%s: Merge() error = %v", tt.format, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Merge() =\n%s\nwant:\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	tests := []struct {
+		format, base, ours, theirs string
+		keys                       []string
+	}{
+		{"json", `{"a": 1, "b": {"c": 1}}`, `{"a": 2, "b": {"c": 2}}`, `{"a": 3, "b": {"c": 3}}`, []string{"a", "b.c"}},
+		{"yaml", "a: 1\n", "a: 2\n", "b: 1\n", []string{"a"}},
+		{"ini", "[s]\nk = 1\n", "[s]\nk = 2\n", "[s]\nk = 3\n", []string{"[s].k"}},
+		{"toml", "a = [1]\n", "a = [1, 2]\n", "a = [1, 3]\n", []string{"a"}},
+	}
+	for _, tt := range tests {
+		_, err := Merge(tt.format, []byte(tt.base), []byte(tt.ours), []byte(tt.theirs))
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Errorf("%s: Merge() error = %v, want a conflict", tt.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(conflict.Keys, tt.keys) {
+			t.Errorf("%s: conflict keys = %v, want %v", tt.format, conflict.Keys, tt.keys)
+		}
+	}
+}
+
+func TestMergeUnchangedKeepsLayout(t *testing.T) {
+	ours := "{\"a\":1,   \"b\": 2}"
+	got, err := Merge("json", []byte(`{"a": 1, "b": 2}`), []byte(ours), []byte(`{"a": 1, "b": 2}`))
+	if err != nil || string(got) != ours {
+		t.Errorf("Merge() = %q, %v; want ours untouched", got, err)
+	}
+	if _, err := Merge("json", nil, []byte("{"), []byte("{}")); err == nil {
+		t.Error("Merge() of invalid JSON = nil error")
+	}
+	if _, err := Merge("xml", nil, nil, nil); err == nil {
+		t.Error("Merge() with unknown format = nil error")
+	}
+}
+
+func TestTomlOpen(t *testing.T) {
+	for text, want := range map[string]bool{
+		`a = [1,`:                true,
+		`a = [1, 2]`:             false,
+		`a = "[" # [`:            false,
+		`a = """`:                true,
+		"a = '''\n]'''":          false,
+		`a = { b = 1 }`:          false,
+		`a = ["x\"]", 'y]']`:     false,
+		"a = [\n  1, # one [\n":  true,
+		"a = [\n  1, # one [\n]": false,
+	} {
+		if got := tomlOpen(text); got != want {
+			t.Errorf("tomlOpen(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package merge
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+// Format returns the format of f's file: its merge format, or one guessed
+// from the source's extension.
+func Format(f config.FileEntry) (string, error) {
+	if f.Merge != "" {
+		return f.Merge, Validate(f.Merge)
+	}
+	switch strings.ToLower(path.Ext(f.Source)) {
+	case ".json":
+		return config.MergeJSON, nil
+	case ".yaml", ".yml":
+		return config.MergeYAML, nil
+	case ".toml":
+		return config.MergeTOML, nil
+	case ".ini", ".cfg", ".conf":
+		return config.MergeINI, nil
+	}
+	if strings.HasSuffix(f.Source, "gitconfig") {
+		return config.MergeINI, nil
+	}
+	return "", fmt.Errorf("%s: cannot tell the format of %s; set merge to json, yaml, toml or ini", f.Name, f.Source)
+}
+
+// Render applies patches, JSON Merge Patches in order, to base.
+func Render(name string, base []byte, patches []map[string]any) ([]byte, error) {
+	if err := Validate(name); err != nil {
+		return nil, err
+	}
+	f := formats[name]
+	b, err := parseOrEmpty(f, base)
+	if err != nil {
+		return nil, fmt.Errorf("parse base: %w", err)
+	}
+	r, err := applyPatches(f, b, patches)
+	if err != nil {
+		return nil, err
+	}
+	if equal(r, b) {
+		return base, nil
+	}
+	return f.render(r, base)
+}
+
+// Split works out where the edits that turned the rendered file into
+// target belong. A key set by a patch is updated in the last patch that
+// sets it; any other key is updated in base. It returns the new base and
+// patches; base is returned as is when only patches changed.
+func Split(name string, base []byte, patches []map[string]any, target []byte) ([]byte, []map[string]any, error) {
+	if err := Validate(name); err != nil {
+		return nil, nil, err
+	}
+	f := formats[name]
+	b, err := parseOrEmpty(f, base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse base: %w", err)
+	}
+	r, err := applyPatches(f, b, patches)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := parseOrEmpty(f, target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse target: %w", err)
+	}
+
+	out := make([]map[string]any, len(patches))
+	for i, p := range patches {
+		out[i] = copyPatch(p)
+	}
+	baseChanged := false
+	for _, c := range diff(r, t, nil) {
+		pp := f.patchPath(c.path)
+		i := slices.IndexFunc(reversed(out), func(p map[string]any) bool { return hasPath(p, pp) })
+		if i == -1 {
+			b = setNode(b, c.path, c.node)
+			baseChanged = true
+			continue
+		}
+		i = len(out) - 1 - i
+		if c.node != nil {
+			v, err := toValue(f, c.node)
+			if err != nil {
+				return nil, nil, err
+			}
+			setPath(out[i], pp, v)
+			continue
+		}
+		// Deleted: null the key if something below the patch sets it.
+		below, err := applyPatches(f, b, out[:i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if findNode(below, c.path) != nil {
+			setPath(out[i], pp, nil)
+		} else {
+			deletePath(out[i], pp)
+		}
+	}
+	if !baseChanged {
+		return base, out, nil
+	}
+	if b == nil {
+		return nil, out, nil
+	}
+	data, err := f.render(b, base)
+	return data, out, err
+}
+
+func parseOrEmpty(f format, data []byte) (*node, error) {
+	if strings.TrimSpace(string(data)) == "" {
+		return newMap(), nil
+	}
+	return f.parse(data)
+}
+
+func applyPatches(f format, n *node, patches []map[string]any) (*node, error) {
+	for _, p := range patches {
+		var err error
+		if f.sections {
+			p = sectionPatch(p)
+		}
+		if n, err = applyPatch(f, n, p); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// applyPatch applies a JSON Merge Patch (RFC 7396) to n without changing
+// it: null deletes a key, objects merge and anything else replaces.
+func applyPatch(f format, n *node, patch map[string]any) (*node, error) {
+	out := newMap()
+	if n.isMap() {
+		out.data, out.key = n.data, n.key
+		out.keys = slices.Clone(n.keys)
+		for k, v := range n.fields {
+			out.fields[k] = v
+		}
+	} else if n != nil {
+		out.key = n.key
+	}
+	for _, k := range sortedKeys(patch) {
+		old := out.fields[k]
+		var child *node
+		switch v := patch[k].(type) {
+		case nil:
+			out.remove(k)
+			continue
+		case map[string]any:
+			var err error
+			if child, err = applyPatch(f, old, v); err != nil {
+				return nil, err
+			}
+		default:
+			var err error
+			if child, err = f.newLeaf(k, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+		}
+		if old != nil {
+			child.key = old.key
+		} else if f.sections && !child.isMap() {
+			indentLike(child, out)
+		}
+		out.set(k, child)
+	}
+	return out, nil
+}
+
+// indentLike indents a new entry of a line-oriented file like the first
+// entry of section.
+func indentLike(entry, section *node) {
+	for _, k := range section.keys {
+		sibling, ok := section.fields[k].data.([]string)
+		if section.fields[k].isMap() || !ok {
+			continue
+		}
+		for _, line := range sibling {
+			if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" {
+				indent := line[:len(line)-len(trimmed)]
+				lines := entry.data.([]string)
+				for i := range lines {
+					lines[i] = indent + lines[i]
+				}
+				return
+			}
+		}
+	}
+}
+
+func (n *node) remove(key string) {
+	if _, ok := n.fields[key]; !ok {
+		return
+	}
+	delete(n.fields, key)
+	n.keys = slices.DeleteFunc(n.keys, func(k string) bool { return k == key })
+}
+
+// change is a key whose value differs; a nil node means it was deleted.
+type change struct {
+	path []string
+	node *node
+}
+
+// diff lists the keys that differ between a and b, descending into
+// mappings present on both sides.
+func diff(a, b *node, p []string) []change {
+	if equal(a, b) {
+		return nil
+	}
+	if !a.isMap() || !b.isMap() {
+		return []change{{path: p, node: b}}
+	}
+	var out []change
+	keys := slices.Clone(a.keys)
+	for _, k := range b.keys {
+		if _, ok := a.fields[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		out = append(out, diff(a.fields[k], b.fields[k], append(slices.Clone(p), k))...)
+	}
+	return out
+}
+
+// setNode returns n with the node at p replaced by v, or deleted when v is
+// nil. Missing mappings along p are created.
+func setNode(n *node, p []string, v *node) *node {
+	if len(p) == 0 {
+		return v
+	}
+	out := newMap()
+	if n.isMap() {
+		*out = *n
+		out.keys = slices.Clone(n.keys)
+		out.fields = make(map[string]*node, len(n.fields))
+		for k, c := range n.fields {
+			out.fields[k] = c
+		}
+	}
+	child := setNode(out.fields[p[0]], p[1:], v)
+	if child == nil {
+		out.remove(p[0])
+		return out
+	}
+	if old := out.fields[p[0]]; old != nil && child.key == nil {
+		child.key = old.key
+	}
+	out.set(p[0], child)
+	return out
+}
+
+func findNode(n *node, p []string) *node {
+	for _, k := range p {
+		if !n.isMap() {
+			return nil
+		}
+		n = n.fields[k]
+	}
+	return n
+}
+
+func toValue(f format, n *node) (any, error) {
+	if !n.isMap() {
+		return f.leafValue(n)
+	}
+	m := make(map[string]any, len(n.keys))
+	for _, k := range n.keys {
+		v, err := toValue(f, n.fields[k])
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// hasPath reports whether patch sets p, possibly to null.
+func hasPath(patch map[string]any, p []string) bool {
+	var cur any = patch
+	for _, k := range p {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return false
+		}
+		if cur, ok = m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func setPath(patch map[string]any, p []string, v any) {
+	for _, k := range p[:len(p)-1] {
+		next, ok := patch[k].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			patch[k] = next
+		}
+		patch = next
+	}
+	patch[p[len(p)-1]] = v
+}
+
+func deletePath(patch map[string]any, p []string) {
+	for _, k := range p[:len(p)-1] {
+		next, ok := patch[k].(map[string]any)
+		if !ok {
+			return
+		}
+		patch = next
+	}
+	delete(patch, p[len(p)-1])
+}
+
+func copyPatch(p map[string]any) map[string]any {
+	out := make(map[string]any, len(p))
+	for k, v := range p {
+		if m, ok := v.(map[string]any); ok {
+			v = copyPatch(m)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// sectionPatch maps a patch onto the sections of a line-oriented file:
+// nested objects become "[a.b]" sections.
+func sectionPatch(patch map[string]any) map[string]any {
+	out := map[string]any{}
+	var section func(name string, m map[string]any)
+	section = func(name string, m map[string]any) {
+		id := "[" + name + "]"
+		sec, _ := out[id].(map[string]any)
+		if sec == nil {
+			sec = map[string]any{}
+			out[id] = sec
+		}
+		for k, v := range m {
+			if mm, ok := v.(map[string]any); ok {
+				section(name+"."+k, mm)
+				continue
+			}
+			sec[k] = v
+		}
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case map[string]any:
+			section(k, v)
+		case nil:
+			out[k] = nil
+			out["["+k+"]"] = nil
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// sectionPath maps a path in a line-oriented file back to patch keys.
+func sectionPath(p []string) []string {
+	if len(p) == 0 || !strings.HasPrefix(p[0], "[") {
+		return p
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(p[0], "["), "]")
+	return append(strings.Split(name, "."), p[1:]...)
+}
+
+func reversed[T any](s []T) []T {
+	out := slices.Clone(s)
+	slices.Reverse(out)
+	return out
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,151 @@
+package merge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format, base string
+		patches      []map[string]any
+		want         string
+	}{
+		{
+			format: "json",
+			base:   "{\n    \"editor.fontSize\": 12,\n    \"window.zoomLevel\": 0\n}\n",
+			patches: []map[string]any{
+				{"editor.fontSize": 16},
+				{"window.zoomLevel": nil, "terminal": map[string]any{"shell": "/bin/zsh"}},
+			},
+			want: "{\n    \"editor.fontSize\": 16,\n    \"terminal\": {\n        \"shell\": \"/bin/zsh\"\n    }\n}\n",
+		},
+		{
+			format:  "yaml",
+			base:    "# prompt\nformat: short\ncolors:\n  user: blue\n",
+			patches: []map[string]any{{"colors": map[string]any{"host": "green"}}},
+			want:    "# prompt\nformat: short\ncolors:\n  user: blue\n  host: green\n",
+		},
+		{
+			format: "toml",
+			base:   "add_newline = true\n\n[git_branch]\nstyle = \"purple\"\n",
+			patches: []map[string]any{
+				{"add_newline": false, "git_branch": map[string]any{"style": "bold purple"}, "aws": map[string]any{"disabled": true}},
+			},
+			want: "add_newline = false\n\n[git_branch]\nstyle = \"bold purple\"\n\n[aws]\ndisabled = true\n",
+		},
+		{
+			format:  "ini",
+			base:    "[user]\n\tname = Me\n",
+			patches: []map[string]any{{"user": map[string]any{"email": "me@work.example"}}},
+			want:    "[user]\n\tname = Me\n\temail = me@work.example\n",
+		},
+		{
+			// Patches that change nothing keep the layout.
+			format:  "json",
+			base:    "{\"a\":   1}",
+			patches: []map[string]any{{"a": 1}},
+			want:    "{\"a\":   1}",
+		},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.format, []byte(tt.base), tt.patches)
+		if err != nil {
+			t.Errorf("%s: Render() error = %v", tt.format, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Render() =\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	base := "{\n  \"a\": 1,\n  \"b\": 2,\n  \"c\": 3\n}\n"
+	patches := []map[string]any{
+		{"b": 20},
+		{"c": 30, "d": map[string]any{"x": true}},
+	}
+	// a edited, b edited, c deleted, d.x edited and e added.
+	target := "{\n  \"a\": 10,\n  \"b\": 21,\n  \"d\": {\n    \"x\": false\n  },\n  \"e\": 5\n}\n"
+
+	newBase, newPatches, err := Split("json", []byte(base), patches, []byte(target))
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	wantBase := "{\n  \"a\": 10,\n  \"b\": 2,\n  \"c\": 3,\n  \"e\": 5\n}\n"
+	if string(newBase) != wantBase {
+		t.Errorf("base =\n%s\nwant\n%s", newBase, wantBase)
+	}
+	wantPatches := []map[string]any{
+		{"b": 21.0},
+		{"c": nil, "d": map[string]any{"x": false}},
+	}
+	if !reflect.DeepEqual(newPatches, wantPatches) {
+		t.Errorf("patches = %v, want %v", newPatches, wantPatches)
+	}
+	if !reflect.DeepEqual(patches[0], map[string]any{"b": 20}) {
+		t.Errorf("Split() changed its patches: %v", patches)
+	}
+
+	// The split renders back to the target, though keys from patches come
+	// after those of the base.
+	got, err := Render("json", newBase, newPatches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := parseJSON(got)
+	b, _ := parseJSON([]byte(target))
+	if !equal(a, b) {
+		t.Errorf("Render(Split()) =\n%s\nwant\n%s", got, target)
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	base := "[core]\neditor = vim\n"
+	patches := []map[string]any{{"user": map[string]any{"email": "me@work.example"}}}
+	target := "[core]\neditor = nvim\n[user]\nemail = me@home.example\n"
+
+	newBase, newPatches, err := Split("ini", []byte(base), patches, []byte(target))
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	if want := "[core]\neditor = nvim\n"; string(newBase) != want {
+		t.Errorf("base = %q, want %q", newBase, want)
+	}
+	want := []map[string]any{{"user": map[string]any{"email": "me@home.example"}}}
+	if !reflect.DeepEqual(newPatches, want) {
+		t.Errorf("patches = %v, want %v", newPatches, want)
+	}
+}
+
+func TestTomlValue(t *testing.T) {
+	tests := []struct {
+		text string
+		want any
+	}{
+		{`"a \"b\""`, `a "b"`},
+		{`'C:\path'`, `C:\path`},
+		{"1_000", int64(1000)},
+		{"0.5 # half", 0.5},
+		{"true", true},
+		{"[1, 'two', [3]]", []any{int64(1), "two", []any{int64(3)}}},
+		{`{ a = 1, "b c" = "d" }`, map[string]any{"a": int64(1), "b c": "d"}},
+		{"1979-05-27", "1979-05-27"},
+	}
+	for _, tt := range tests {
+		got, err := tomlValue(&node{text: tt.text})
+		if err != nil {
+			t.Errorf("tomlValue(%s) error = %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tomlValue(%s) = %#v, want %#v", tt.text, got, tt.want)
+		}
+		if enc, err := tomlEncode(got); err != nil {
+			t.Errorf("tomlEncode(%#v) error = %v", got, err)
+		} else if back, _ := tomlValue(&node{text: enc}); !reflect.DeepEqual(back, got) {
+			t.Errorf("tomlEncode(%#v) = %s, reads back as %#v", got, enc, back)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func jsonLeaf(_ string, v any) (*node, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	raw := bytes.TrimSpace(buf.Bytes())
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return nil, err
+	}
+	return &node{text: compact.String(), data: json.RawMessage(raw)}, nil
+}
+
+func jsonValue(n *node) (any, error) {
+	var v any
+	err := json.Unmarshal(n.data.(json.RawMessage), &v)
+	return v, err
+}
+
+func yamlLeaf(_ string, v any) (*node, error) {
+	var y yaml.Node
+	if err := y.Encode(v); err != nil {
+		return nil, err
+	}
+	return &node{text: canonicalYAML(&y), data: &y}, nil
+}
+
+func yamlValue(n *node) (any, error) {
+	var v any
+	err := n.data.(*yaml.Node).Decode(&v)
+	return v, err
+}
+
+func iniLeaf(key string, v any) (*node, error) {
+	var value string
+	switch v := v.(type) {
+	case string:
+		value = v
+	case bool, int, int64, float64:
+		value = fmt.Sprint(v)
+	default:
+		return nil, fmt.Errorf("INI values must be strings, numbers or booleans")
+	}
+	if strings.ContainsAny(value, "\n") {
+		return nil, fmt.Errorf("INI values cannot span lines")
+	}
+	return &node{text: value, data: []string{key + " = " + value}}, nil
+}
+
+func iniValue(n *node) (any, error) {
+	if n.text == "\x00" {
+		return true, nil
+	}
+	if s, err := strconv.Unquote(n.text); err == nil && strings.HasPrefix(n.text, `"`) {
+		return s, nil
+	}
+	return n.text, nil
+}
+
+func tomlLeaf(key string, v any) (*node, error) {
+	value, err := tomlEncode(v)
+	if err != nil {
+		return nil, err
+	}
+	return &node{text: value, data: []string{tomlKey(key) + " = " + value}}, nil
+}
+
+func tomlValue(n *node) (any, error) {
+	p := &tomlParser{s: n.text}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); p.i < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q after TOML value", p.s[p.i:])
+	}
+	return v, nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return strconv.Quote(k)
+}
+
+// tomlEncode writes v as a TOML value; tables become inline tables.
+func tomlEncode(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case bool, int, int64:
+		return fmt.Sprint(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := tomlEncode(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, k := range keys {
+			s, err := tomlEncode(v[k])
+			if err != nil {
+				return "", err
+			}
+			items[i] = tomlKey(k) + " = " + s
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("cannot write %T as TOML", v)
+}
+
+// tomlParser reads the TOML values found in config files: strings,
+// numbers, booleans, arrays and inline tables. Dates are kept as strings.
+type tomlParser struct {
+	s string
+	i int
+}
+
+// skip moves past whitespace, newlines and comments.
+func (p *tomlParser) skip() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\r', '\n':
+			p.i++
+		case '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) value() (any, error) {
+	p.skip()
+	if p.i == len(p.s) {
+		return nil, fmt.Errorf("missing TOML value")
+	}
+	rest := p.s[p.i:]
+	switch {
+	case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, "'''"):
+		q := rest[:3]
+		end := strings.Index(rest[3:], q)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		body := strings.TrimPrefix(strings.TrimPrefix(rest[3:3+end], "\r"), "\n")
+		p.i += 3 + end + 3
+		if q == "'''" {
+			return body, nil
+		}
+		return strconv.Unquote(`"` + strings.NewReplacer("\n", `\n`, "\r", `\r`, `"`, `\"`).Replace(body) + `"`)
+	case rest[0] == '"':
+		end := 1
+		for ; end < len(rest) && rest[end] != '"'; end++ {
+			if rest[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(rest) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		p.i += end + 1
+		return strconv.Unquote(rest[:end+1])
+	case rest[0] == '\'':
+		end := strings.IndexByte(rest[1:], '\'')
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		p.i += end + 2
+		return rest[1 : end+1], nil
+	case rest[0] == '[':
+		p.i++
+		items := []any{}
+		for {
+			if p.skip(); p.i < len(p.s) && p.s[p.i] == ']' {
+				p.i++
+				return items, nil
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if err := p.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case rest[0] == '{':
+		p.i++
+		table := map[string]any{}
+		for {
+			if p.skip(); p.i < len(p.s) && p.s[p.i] == '}' {
+				p.i++
+				return table, nil
+			}
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			table[key] = item
+			if err := p.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	end := strings.IndexAny(rest, " \t\r\n,]}#")
+	if end == -1 {
+		end = len(rest)
+	}
+	p.i += end
+	tok := rest[:end]
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.ReplaceAll(tok, "_", "")
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return tok, nil
+}
+
+// key reads an inline table key and the "=" after it.
+func (p *tomlParser) key() (string, error) {
+	p.skip()
+	eq := strings.IndexByte(p.s[p.i:], '=')
+	if eq == -1 {
+		return "", fmt.Errorf("missing = in inline table")
+	}
+	key := strings.TrimSpace(p.s[p.i : p.i+eq])
+	p.i += eq + 1
+	if s, err := strconv.Unquote(key); err == nil {
+		return s, nil
+	}
+	return strings.Trim(key, "'"), nil
+}
+
+// separator moves past the comma after an item, or stops before end.
+func (p *tomlParser) separator(end byte) error {
+	p.skip()
+	switch {
+	case p.i < len(p.s) && p.s[p.i] == ',':
+		p.i++
+		return nil
+	case p.i < len(p.s) && p.s[p.i] == end:
+		return nil
+	}
+	return fmt.Errorf("expected , or %c", end)
+}
@@ -0,0 +1,117 @@
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML reads a single YAML document. Mappings keep their key order
+// and comments; everything else is a leaf.
+func parseYAML(data []byte) (*node, error) {
+	var doc yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var extra yaml.Node
+	if err := dec.Decode(&extra); err == nil {
+		return nil, fmt.Errorf("multiple documents are not supported")
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, fmt.Errorf("unexpected document")
+	}
+	n, err := fromYAML(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func fromYAML(y *yaml.Node) (*node, error) {
+	if y.Kind != yaml.MappingNode {
+		return &node{text: canonicalYAML(y), data: y}, nil
+	}
+	n := newMap()
+	n.data = y
+	for i := 0; i+1 < len(y.Content); i += 2 {
+		k, v := y.Content[i], y.Content[i+1]
+		if k.Kind != yaml.ScalarNode || k.Value == "<<" {
+			return nil, fmt.Errorf("line %d: only plain keys are supported", k.Line)
+		}
+		if _, dup := n.fields[k.Value]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", k.Line, k.Value)
+		}
+		child, err := fromYAML(v)
+		if err != nil {
+			return nil, err
+		}
+		child.key = k
+		n.set(k.Value, child)
+	}
+	return n, nil
+}
+
+// canonicalYAML describes a node by kind, tag and value, ignoring style
+// and comments.
+func canonicalYAML(y *yaml.Node) string {
+	var b strings.Builder
+	var walk func(*yaml.Node)
+	walk = func(y *yaml.Node) {
+		fmt.Fprintf(&b, "%d%s%q[", y.Kind, y.ShortTag(), y.Value)
+		if y.Kind == yaml.AliasNode && y.Alias != nil {
+			walk(y.Alias)
+		}
+		for _, c := range y.Content {
+			walk(c)
+		}
+		b.WriteString("]")
+	}
+	walk(y)
+	return b.String()
+}
+
+// renderYAML writes n, keeping the comments of the nodes it came from and
+// the document comments of ours.
+func renderYAML(n *node, ours []byte) ([]byte, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	var prev yaml.Node
+	if err := yaml.Unmarshal(ours, &prev); err == nil && prev.Kind == yaml.DocumentNode {
+		doc.HeadComment, doc.FootComment = prev.HeadComment, prev.FootComment
+	}
+	doc.Content = []*yaml.Node{toYAML(n)}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toYAML(n *node) *yaml.Node {
+	if !n.isMap() {
+		return n.data.(*yaml.Node)
+	}
+	out := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if y, ok := n.data.(*yaml.Node); ok {
+		copied := *y
+		out = &copied
+	}
+	out.Content = nil
+	for _, k := range n.keys {
+		child := n.fields[k]
+		key, ok := child.key.(*yaml.Node)
+		if !ok {
+			key = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
+		}
+		out.Content = append(out.Content, key, toYAML(child))
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	reg := NewRegistry()
+	attempts := reg.NewCounterVec("synq_attempts_total", "Attempts by phase.", "phase")
+	attempts.Init("pull", "push")
+	attempts.Inc("pull")
+	attempts.Inc("pull")
+	reg.NewGaugeFunc("synq_watched", "Watched \"dirs\".", func() float64 { return 3 })
+	latency := reg.NewHistogramVec("synq_git_seconds", "Git latency.", "command", []float64{0.1, 1})
+	latency.Observe("pull", 0.5)
+	latency.Observe("pull", 2)
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP synq_attempts_total Attempts by phase.
+# TYPE synq_attempts_total counter
+synq_attempts_total{phase="pull"} 2
+synq_attempts_total{phase="push"} 0
+# HELP synq_watched Watched "dirs".
+# TYPE synq_watched gauge
+synq_watched 3
+# HELP synq_git_seconds Git latency.
+# TYPE synq_git_seconds histogram
+synq_git_seconds_bucket{command="pull",le="0.1"} 0
+synq_git_seconds_bucket{command="pull",le="1"} 1
+synq_git_seconds_bucket{command="pull",le="+Inf"} 2
+synq_git_seconds_sum{command="pull"} 2.5
+synq_git_seconds_count{command="pull"} 2
+`
+	if buf.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel() = %s", got)
+	}
+}
+
+func TestListen_RejectsNonLoopback(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:9464", ":9464", "192.168.1.2:9464", "example.com:80", "unix:"} {
+		if l, err := Listen(addr); err == nil {
+			_ = l.Close()
+			t.Errorf("Listen(%q) succeeded, want error", addr)
+		}
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	sock := filepath.Join(t.TempDir(), "m.sock")
+	reg := NewRegistry()
+	reg.NewCounter("synq_test_total", "Test.").Inc()
+
+	l, err := Listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := Serve(l, reg)
+	defer func() { _ = srv.Close() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://synq/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "synq_test_total 1\n") {
+		t.Errorf("body = %q", string(body))
+	}
+}
@@ -0,0 +1,123 @@
+// Package peer lets machines sync directly with each other, without a git
+// host. A machine serves its repos over git's smart HTTP protocol, with TLS
+// authenticating both sides: each presents a self-signed certificate, and
+// only the keys the other side trusts are accepted.
+package peer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeyFile and CertFile are this machine's peer key and self-signed
+// certificate in the config dir.
+const (
+	KeyFile  = "peer_key.pem"
+	CertFile = "peer_cert.pem"
+)
+
+// fingerprintPrefix starts every key fingerprint. Fingerprints are in
+// curl's pinned public key format, so git can pin them as they are.
+const fingerprintPrefix = "sha256//"
+
+// Paths returns the certificate and key files in configDir.
+func Paths(configDir string) (cert, key string) {
+	return filepath.Join(configDir, CertFile), filepath.Join(configDir, KeyFile)
+}
+
+// EnsureCert creates this machine's key and certificate unless they exist,
+// and returns the key's fingerprint. The key is ECDSA P-256, which every
+// TLS library git may be built with supports.
+func EnsureCert(configDir string) (string, error) {
+	certPath, keyPath := Paths(configDir)
+	if data, err := os.ReadFile(certPath); err == nil {
+		return certFingerprint(data)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", err
+	}
+	host, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "synq peer " + host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		// The certificate only carries the key, which is what peers check.
+		NotAfter:    time.Now().AddDate(100, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return "", err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return "", err
+	}
+	return certFingerprint(certPEM)
+}
+
+func certFingerprint(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", fmt.Errorf("%s: no certificate", CertFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", CertFile, err)
+	}
+	return Fingerprint(cert.PublicKey)
+}
+
+// Fingerprint returns the fingerprint of a public key: the SHA-256 of its
+// DER-encoded SubjectPublicKeyInfo.
+func Fingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return fingerprintPrefix + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// ParseFingerprint checks a fingerprint as shown by 'synq peer status'.
+func ParseFingerprint(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	b64, ok := strings.CutPrefix(s, fingerprintPrefix)
+	if raw, err := base64.StdEncoding.DecodeString(b64); !ok || err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("%q is not a peer key fingerprint, such as %sAbc...=", s, fingerprintPrefix)
+	}
+	return s, nil
+}
@@ -0,0 +1,205 @@
+package peer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihavespoons/synq/internal/gitops"
+)
+
+func TestEnsureCert(t *testing.T) {
+	dir := t.TempDir()
+	fp, err := EnsureCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFingerprint(fp); err != nil {
+		t.Errorf("EnsureCert returned %v", err)
+	}
+	again, err := EnsureCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != fp {
+		t.Errorf("second EnsureCert = %s, want the existing key's %s", again, fp)
+	}
+	if other, _ := EnsureCert(t.TempDir()); other == fp {
+		t.Error("two machines got the same key")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	for _, s := range []string{"", "sha256//", "sha256//notbase64!", "sha256//YWJj", "md5//x"} {
+		if _, err := ParseFingerprint(s); err == nil {
+			t.Errorf("ParseFingerprint(%q) succeeded", s)
+		}
+	}
+}
+
+func TestServerAuthenticatesPeers(t *testing.T) {
+	serverDir, trustedDir, strangerDir := t.TempDir(), t.TempDir(), t.TempDir()
+	serverFP, err := EnsureCert(serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedFP, err := EnsureCert(trustedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnsureCert(strangerDir); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Repos: map[string]string{}, Peers: map[string]string{trustedFP: "lab"}}
+	srv, err := s.Serve(l, serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = srv.Close() }()
+
+	get := func(clientDir string) (*http.Response, error) {
+		certPath, keyPath := Paths(clientDir)
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if fp, _ := Fingerprint(cs.PeerCertificates[0].PublicKey); fp != serverFP {
+					t.Errorf("server presented %s, want %s", fp, serverFP)
+				}
+				return nil
+			},
+		}}}
+		return client.Get("https://" + l.Addr().String() + "/missing/info/refs")
+	}
+
+	resp, err := get(trustedDir)
+	if err != nil {
+		t.Fatalf("trusted peer: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("trusted peer asking for a missing repo: status %d, want 404", resp.StatusCode)
+	}
+	if resp, err := get(strangerDir); err == nil {
+		_ = resp.Body.Close()
+		t.Errorf("untrusted peer got status %d", resp.StatusCode)
+	}
+}
+
+func TestGitThroughServer(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	gitconfig := "[user]\n\tname = test\n\temail = test@example.com\n[init]\n\tdefaultBranch = main\n"
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitconfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gitops.SetPeers(gitops.Peers{}) })
+
+	serverDir, clientDir, strangerDir := t.TempDir(), t.TempDir(), t.TempDir()
+	serverFP, err := EnsureCert(serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientFP, err := EnsureCert(clientDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerFP, err := EnsureCert(strangerDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := filepath.Join(home, "served")
+	if err := os.Mkdir(served, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitops.InitRepo(served); err != nil {
+		t.Fatal(err)
+	}
+	commit := func(repoDir, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, "file"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := gitops.Add(repoDir, "file"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gitops.Commit(repoDir, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(served, "one")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Repos: map[string]string{"default": served}, Peers: map[string]string{clientFP: "lab"}}
+	srv, err := s.Serve(l, serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = srv.Close() }()
+	url := "https://" + l.Addr().String() + "/"
+	certPath, keyPath := Paths(clientDir)
+	pin := func(fp string) {
+		gitops.SetPeers(gitops.Peers{Cert: certPath, Key: keyPath, Pins: map[string]string{url: fp}})
+	}
+
+	// A server presenting a key other than the pinned one is refused.
+	pin(strangerFP)
+	if err := gitops.Clone(url+"default", filepath.Join(home, "refused")); err == nil {
+		t.Error("clone succeeded with the wrong key pinned")
+	}
+
+	pin(serverFP)
+	clone := filepath.Join(home, "clone")
+	if err := gitops.Clone(url+"default", clone); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(clone, "file")); string(data) != "one" {
+		t.Errorf("cloned file = %q, want %q", data, "one")
+	}
+
+	commit(served, "two")
+	changed, err := gitops.Pull(clone)
+	if err != nil || !changed {
+		t.Fatalf("Pull = %v, %v; want the served change fetched", changed, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(clone, "file")); string(data) != "two" {
+		t.Errorf("pulled file = %q, want %q", data, "two")
+	}
+
+	// Repos are served read-only.
+	before, _ := gitops.Head(served)
+	commit(clone, "three")
+	if err := gitops.Push(clone); err == nil {
+		t.Error("push to a peer succeeded")
+	}
+	if after, _ := gitops.Head(served); after != before {
+		t.Errorf("served HEAD moved from %s to %s", before, after)
+	}
+
+	pin(strangerFP)
+	if _, err := gitops.Pull(clone); err == nil {
+		t.Error("pull succeeded with the wrong key pinned")
+	}
+}
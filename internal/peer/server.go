@@ -0,0 +1,125 @@
+package peer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Server serves repos to trusted peers over git's smart HTTP protocol, at
+// /<name>/ for every repo. Peers can fetch but not push: a push would
+// rewrite the working tree under the daemon, with commits no one verified.
+type Server struct {
+	// Repos maps the names repos are served under to their dirs.
+	Repos map[string]string
+	// Peers maps the fingerprints of trusted peers' keys to their names.
+	Peers map[string]string
+	// ErrorLog receives failed connections, such as those of untrusted
+	// peers; nil logs them to the standard logger.
+	ErrorLog *log.Logger
+}
+
+// Serve serves on l in the background, presenting the certificate in
+// configDir. Close the returned server to stop it.
+func (s *Server) Serve(l net.Listener, configDir string) (*http.Server, error) {
+	certPath, keyPath := Paths(configDir)
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load peer certificate: %w", err)
+	}
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          s.ErrorLog,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			// Peers' certificates are self-signed; their keys are checked
+			// against the trusted ones instead.
+			ClientAuth:            tls.RequireAnyClientCert,
+			VerifyPeerCertificate: s.verify,
+		},
+	}
+	go func() {
+		if err := srv.ServeTLS(l, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = l.Close()
+		}
+	}()
+	return srv, nil
+}
+
+// verify accepts a client certificate whose key is trusted.
+func (s *Server) verify(raw [][]byte, _ [][]*x509.Certificate) error {
+	if len(raw) == 0 {
+		return errors.New("no client certificate")
+	}
+	if _, err := s.peer(raw[0]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// peer returns the name of the trusted peer a certificate belongs to.
+func (s *Server) peer(der []byte) (string, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", err
+	}
+	fp, err := Fingerprint(cert.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	name, ok := s.Peers[fp]
+	if !ok {
+		return "", fmt.Errorf("untrusted peer key %s", fp)
+	}
+	return name, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		http.Error(w, "client certificate required", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.peer(r.TLS.PeerCertificates[0].Raw); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/git-receive-pack") || r.URL.Query().Get("service") == "git-receive-pack" {
+		http.Error(w, "repos are served read-only", http.StatusForbidden)
+		return
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	dir, ok := s.Repos[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	git, err := exec.LookPath("git")
+	if err != nil {
+		http.Error(w, "git not found", http.StatusInternalServerError)
+		return
+	}
+
+	// Without REMOTE_USER, http-backend refuses pushes too.
+	h := &cgi.Handler{
+		Path:       git,
+		Args:       []string{"http-backend"},
+		Root:       "/" + name,
+		Dir:        dir,
+		InheritEnv: []string{"HOME", "PATH", "SYSTEMROOT"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + dir,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,250 @@
+package scripts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/hooks"
+	"gopkg.in/yaml.v3"
+)
+
+// StateFile records which scripts have run on this machine. It lives in the
+// local config dir, never in the repo.
+const StateFile = "scripts-state.yaml"
+
+// State maps script names to their run history on this machine.
+type State map[string]*Record
+
+// Record is the run history of one script.
+type Record struct {
+	// Hash is the content hash of the last successful run.
+	Hash string `yaml:"hash"`
+	// History lists every content hash that ran successfully.
+	History []string  `yaml:"history,omitempty"`
+	LastRun time.Time `yaml:"last_run"`
+	Error   string    `yaml:"error,omitempty"`
+}
+
+// Result is the outcome of running (or skipping) one script.
+type Result struct {
+	Name     string
+	Output   string
+	Duration time.Duration
+	// Skipped explains why a pending script did not run.
+	Skipped string
+	Err     error
+}
+
+// LoadState reads the script state from configDir.
+func LoadState(configDir string) (State, error) {
+	data, err := os.ReadFile(filepath.Join(configDir, StateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return State{}, nil
+		}
+		return nil, err
+	}
+	state := State{}
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// SaveState writes the script state to configDir.
+func SaveState(configDir string, state State) error {
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(configDir, StateFile), data, 0o644)
+}
+
+// Hash returns the content hash of a script: its file for a source script,
+// or the command itself for an inline one.
+func Hash(repoDir string, s config.Script) (string, error) {
+	content := []byte(s.Command)
+	if s.Source != "" {
+		data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(s.Source)))
+		if err != nil {
+			return "", err
+		}
+		content = data
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Applies reports whether s targets this machine.
+func Applies(s config.Script, hostname string, profiles []string) bool {
+	if !config.InProfiles(s.Profiles, profiles) {
+		return false
+	}
+	if len(s.OS) > 0 && !slices.Contains(s.OS, runtime.GOOS) {
+		return false
+	}
+	if len(s.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range s.Hosts {
+		if ok, _ := path.Match(pattern, hostname); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending reports whether s with the given content hash should run.
+func Pending(s config.Script, hash string, rec *Record) bool {
+	switch s.Run {
+	case config.RunAlways:
+		return true
+	case config.RunOnChange:
+		return rec == nil || rec.Hash != hash
+	default:
+		return rec == nil || !slices.Contains(rec.History, hash)
+	}
+}
+
+// Runner runs pending scripts and records their state.
+type Runner struct {
+	ConfigDir string
+	RepoDir   string
+	Timeout   time.Duration
+	Trusted   map[string]string
+	Profiles  []string
+}
+
+// NewRunner returns a runner configured from the local state.
+func NewRunner(configDir, repoDir string, state *config.LocalState) *Runner {
+	timeout, err := time.ParseDuration(state.Scripts.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout, _ = time.ParseDuration(config.DefaultScriptTimeout)
+	}
+	return &Runner{
+		ConfigDir: configDir,
+		RepoDir:   repoDir,
+		Timeout:   timeout,
+		Trusted:   state.Scripts.Trusted,
+		Profiles:  state.Profiles,
+	}
+}
+
+// RunPending runs every pending script for this machine in order. Untrusted
+// scripts are skipped; after a failure the remaining scripts are skipped so
+// later steps never run on a half-provisioned machine.
+func (r *Runner) RunPending(list []config.Script) ([]Result, error) {
+	state, err := LoadState(r.ConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("load script state: %w", err)
+	}
+	hostname, _ := os.Hostname()
+
+	var results []Result
+	failed := ""
+	for _, s := range list {
+		if err := s.Validate(); err != nil {
+			results = append(results, Result{Name: s.Name, Err: err})
+			failed = s.Name
+			continue
+		}
+		if !Applies(s, hostname, r.Profiles) {
+			continue
+		}
+		hash, err := Hash(r.RepoDir, s)
+		if err != nil {
+			results = append(results, Result{Name: s.Name, Err: err})
+			failed = s.Name
+			continue
+		}
+		if !Pending(s, hash, state[s.Name]) {
+			continue
+		}
+
+		res := Result{Name: s.Name}
+		switch {
+		case failed != "":
+			res.Skipped = fmt.Sprintf("script %q failed", failed)
+		case r.Trusted[s.Name] != hash:
+			res.Skipped = fmt.Sprintf("not trusted; review it with 'synq scripts trust %s'", s.Name)
+		default:
+			res = r.run(s, hostname)
+			rec := state[s.Name]
+			if rec == nil {
+				rec = &Record{}
+				state[s.Name] = rec
+			}
+			rec.LastRun = time.Now()
+			rec.Error = ""
+			if res.Err != nil {
+				rec.Error = res.Err.Error()
+				failed = s.Name
+			} else {
+				rec.Hash = hash
+				if !slices.Contains(rec.History, hash) {
+					rec.History = append(rec.History, hash)
+				}
+			}
+		}
+		results = append(results, res)
+	}
+
+	if err := SaveState(r.ConfigDir, state); err != nil {
+		return results, fmt.Errorf("save script state: %w", err)
+	}
+	return results, nil
+}
+
+func (r *Runner) run(s config.Script, hostname string) Result {
+	res := Result{Name: s.Name}
+	command := s.Command
+	if s.Source != "" {
+		command = scriptCommand(filepath.Join(r.RepoDir, filepath.FromSlash(s.Source)))
+	}
+	env := map[string]string{
+		"SYNQ_SCRIPT": s.Name,
+		"SYNQ_REPO":   r.RepoDir,
+		"SYNQ_OS":     runtime.GOOS,
+		"SYNQ_HOST":   hostname,
+	}
+
+	start := time.Now()
+	res.Output, res.Err = hooks.Exec(command, r.RepoDir, env, r.Timeout)
+	res.Duration = time.Since(start)
+	return res
+}
+
+// scriptCommand returns the shell command that runs the script at p. Scripts
+// with a shebang run through their interpreter, others with sh. On Windows
+// .ps1 scripts run with PowerShell and everything else with cmd.
+func scriptCommand(p string) string {
+	if runtime.GOOS == "windows" {
+		if strings.EqualFold(filepath.Ext(p), ".ps1") {
+			return fmt.Sprintf(`powershell -NoProfile -ExecutionPolicy Bypass -File "%s"`, p)
+		}
+		return fmt.Sprintf(`"%s"`, p)
+	}
+	quoted := "'" + strings.ReplaceAll(p, "'", `'\''`) + "'"
+	// Run the interpreter named by the shebang directly, so scripts work
+	// without the executable bit (which would show up as a repo change).
+	if data, err := os.ReadFile(p); err == nil && bytes.HasPrefix(data, []byte("#!")) {
+		line, _, _ := bytes.Cut(data[2:], []byte("\n"))
+		if interpreter := strings.TrimSpace(string(line)); interpreter != "" {
+			return interpreter + " " + quoted
+		}
+	}
+	return "sh " + quoted
+}
@@ -0,0 +1,124 @@
+package scripts
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/config"
+)
+
+func TestPending(t *testing.T) {
+	once := config.Script{Name: "fonts", Command: "x", Run: config.RunOnce}
+	onchange := config.Script{Name: "defaults", Command: "x", Run: config.RunOnChange}
+	always := config.Script{Name: "brew", Command: "x", Run: config.RunAlways}
+	rec := &Record{Hash: "b", History: []string{"a", "b"}}
+
+	tests := []struct {
+		script config.Script
+		hash   string
+		rec    *Record
+		want   bool
+	}{
+		{once, "a", nil, true},
+		{once, "a", rec, false},
+		{once, "c", rec, true},
+		{onchange, "b", rec, false},
+		{onchange, "a", rec, true},
+		{always, "b", rec, true},
+	}
+	for _, tt := range tests {
+		if got := Pending(tt.script, tt.hash, tt.rec); got != tt.want {
+			t.Errorf("Pending(%s, %s) = %v, want %v", tt.script.Run, tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestApplies(t *testing.T) {
+	s := config.Script{OS: []string{runtime.GOOS}, Hosts: []string{"work-*"}}
+	if !Applies(s, "work-laptop", nil) {
+		t.Error("expected script to apply to work-laptop")
+	}
+	if Applies(s, "home-desktop", nil) {
+		t.Error("expected script not to apply to home-desktop")
+	}
+	if Applies(config.Script{OS: []string{"plan9"}}, "any", nil) {
+		t.Error("expected script not to apply to another OS")
+	}
+	gui := config.Script{Profiles: []string{"gui"}}
+	if Applies(gui, "any", nil) || !Applies(gui, "any", []string{"gui"}) {
+		t.Error("expected script to apply only with the gui profile active")
+	}
+}
+
+func TestRunPending(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	configDir := t.TempDir()
+	repoDir := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "ran")
+	script := "#!/bin/sh\necho run >> '" + marker + "'\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "setup.sh"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list := []config.Script{
+		{Name: "setup", Source: "setup.sh", Run: config.RunOnce},
+		{Name: "fail", Command: "exit 3", Run: config.RunAlways},
+		{Name: "after", Command: "true", Run: config.RunAlways},
+	}
+	r := &Runner{ConfigDir: configDir, RepoDir: repoDir, Timeout: 5 * time.Second}
+
+	// Untrusted scripts are skipped.
+	results, err := r.RunPending(list[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Skipped == "" {
+		t.Fatalf("expected untrusted script to be skipped, got %+v", results)
+	}
+
+	r.Trusted = map[string]string{}
+	for _, s := range list {
+		hash, err := Hash(repoDir, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Trusted[s.Name] = hash
+	}
+
+	results, err = r.RunPending(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Skipped == "" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	// A run-once script does not run again.
+	results, err = r.RunPending(list[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected nothing pending, got %+v", results)
+	}
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "run\n" {
+		t.Errorf("script output = %q, want a single run", string(data))
+	}
+
+	state, err := LoadState(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["fail"] == nil || state["fail"].Error == "" {
+		t.Error("expected failure to be recorded")
+	}
+}
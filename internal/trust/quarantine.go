@@ -0,0 +1,100 @@
+package trust
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ihavespoons/synq/internal/gitops"
+	"gopkg.in/yaml.v3"
+)
+
+// QuarantineFile records, per source, the upstream commits held back
+// because they were not signed by a trusted machine.
+const QuarantineFile = "quarantine.yaml"
+
+// Held is what a source holds in quarantine.
+type Held struct {
+	// Upstream is the refused upstream commit; approving it lets in every
+	// commit up to it.
+	Upstream string `yaml:"upstream"`
+	// Commits are the refused commits, each with why it was refused.
+	Commits []string  `yaml:"commits"`
+	Since   time.Time `yaml:"since"`
+}
+
+// heldMu serializes updates to the quarantine file by the daemon's source
+// loops.
+var heldMu sync.Mutex
+
+// LoadHeld returns what each source holds in quarantine.
+func LoadHeld(configDir string) (map[string]Held, error) {
+	held := map[string]Held{}
+	data, err := os.ReadFile(filepath.Join(configDir, QuarantineFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return held, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &held); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", QuarantineFile, err)
+	}
+	return held, nil
+}
+
+// Hold records the commits a pull of source refused, if err is the
+// gitops.UnverifiedError of that pull. It reports whether it was.
+func Hold(configDir, source string, err error) (bool, error) {
+	var unverified *gitops.UnverifiedError
+	if !errors.As(err, &unverified) {
+		return false, nil
+	}
+	return true, update(configDir, func(held map[string]Held) {
+		h, ok := held[source]
+		if !ok || h.Upstream != unverified.Upstream {
+			since := time.Now().UTC().Truncate(time.Second)
+			if ok {
+				since = h.Since
+			}
+			held[source] = Held{Upstream: unverified.Upstream, Commits: unverified.Commits, Since: since}
+		}
+	})
+}
+
+// Release forgets what source held, once a pull of it succeeded.
+func Release(configDir, source string) error {
+	held, err := LoadHeld(configDir)
+	if err != nil || len(held) == 0 {
+		return err
+	}
+	if _, ok := held[source]; !ok {
+		return nil
+	}
+	return update(configDir, func(held map[string]Held) { delete(held, source) })
+}
+
+func update(configDir string, fn func(map[string]Held)) error {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	held, err := LoadHeld(configDir)
+	if err != nil {
+		return err
+	}
+	fn(held)
+	p := filepath.Join(configDir, QuarantineFile)
+	if len(held) == 0 {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(held)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
@@ -0,0 +1,116 @@
+// Package trust lets a machine apply only the commits signed by machines it
+// trusts. Every machine signs its commits with an SSH key and publishes the
+// public key in its heartbeat; pulled commits signed by any other key are
+// held in quarantine until they are approved.
+package trust
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ihavespoons/synq/internal/config"
+	"github.com/ihavespoons/synq/internal/fileops"
+)
+
+// KeyFile is the machine's own signing key in the config dir, used unless
+// signing is configured with an SSH key of its own.
+const KeyFile = "machine_key"
+
+// SignersFile is the SSH allowed signers file written into the config dir
+// from the trusted machines' keys.
+const SignersFile = "trusted_signers"
+
+// KeyPath returns the private key this machine signs with.
+func KeyPath(configDir string, state *config.LocalState) string {
+	if state.Signing.Format == config.SignSSH && state.Signing.Key != "" {
+		return strings.TrimSuffix(fileops.ExpandPath(state.Signing.Key), ".pub")
+	}
+	return filepath.Join(configDir, KeyFile)
+}
+
+// EnsureKey creates the machine key unless signing uses a key of its own,
+// and returns the public key in authorized_keys format.
+func EnsureKey(configDir string, state *config.LocalState) (string, error) {
+	key := KeyPath(configDir, state)
+	if _, err := os.Stat(key + ".pub"); os.IsNotExist(err) && key == filepath.Join(configDir, KeyFile) {
+		if err := os.MkdirAll(configDir, 0o755); err != nil {
+			return "", err
+		}
+		host, _ := os.Hostname()
+		out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "synq@"+host, "-f", key).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("ssh-keygen: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	return PublicKey(key)
+}
+
+// PublicKey returns the public half of a private key path, as kept next to
+// it, without its comment.
+func PublicKey(key string) (string, error) {
+	data, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		return "", err
+	}
+	pub, err := ParseKey(string(data))
+	if err != nil {
+		return "", fmt.Errorf("%s.pub: %w", key, err)
+	}
+	return pub, nil
+}
+
+// ParseKey returns the type and base64 blob of an SSH public key in
+// authorized_keys format, dropping its comment.
+func ParseKey(s string) (string, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ssh-") && !strings.HasPrefix(fields[0], "ecdsa-") && !strings.HasPrefix(fields[0], "sk-") {
+		return "", fmt.Errorf("not an SSH public key")
+	}
+	return fields[0] + " " + fields[1], nil
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key.
+func Fingerprint(pub string) (string, error) {
+	cmd := exec.Command("ssh-keygen", "-l", "-f", "-")
+	cmd.Stdin = strings.NewReader(pub + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ssh-keygen: %s", strings.TrimSpace(string(out)))
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return "", fmt.Errorf("ssh-keygen: unexpected output %q", out)
+	}
+	return fields[1], nil
+}
+
+// WriteSigners writes the allowed signers file for the trusted machines,
+// followed by the lines of extra, an allowed signers file of the user's
+// own, if set. It returns the file's path.
+func WriteSigners(configDir string, machines map[string]string, extra string) (string, error) {
+	ids := make([]string, 0, len(machines))
+	for id := range machines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var b strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&b, "synq-%s namespaces=\"git\" %s\n", id, machines[id])
+	}
+	if extra != "" {
+		data, err := os.ReadFile(extra)
+		if err != nil {
+			return "", fmt.Errorf("read allowed signers: %w", err)
+		}
+		b.Write(data)
+	}
+	p := filepath.Join(configDir, SignersFile)
+	if err := os.WriteFile(p, []byte(b.String()), 0o644); err != nil {
+		return "", err
+	}
+	return p, nil
+}